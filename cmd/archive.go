@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// archiveCmd represents the archive command
+var archiveCmd = &cobra.Command{
+	Use:   "archive <worktree>",
+	Short: "Remove a worktree, keeping its uncommitted changes",
+	Long: `Free the disk space of a worktree whose work is not finished. Staged,
+unstaged and untracked changes are saved into a bundle in the bare repository
+(wtm/archives/), the branch and base commit are recorded, and the worktree is
+removed. The branch itself is kept. With --ignored, ignored files are saved
+as well; otherwise they are deleted with the worktree.
+
+The worktree is named as in 'wtm note'. 'wtm unarchive <name>' recreates it
+with all saved changes.
+
+Example:
+  wtm archive feature/experiments
+  wtm archive workspace --name release-prep --ignored`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		ctx := commandContext(cmd)
+
+		path, err := repo.ResolveWorktree(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		name, _ := cmd.Flags().GetString("name")
+		ignored, _ := cmd.Flags().GetBool("ignored")
+		_, err = repo.Archive(ctx, wtm.ArchiveOptions{
+			Worktree: path,
+			Name:     name,
+			Ignored:  ignored,
+		})
+		return err
+	},
+}
+
+// unarchiveCmd represents the unarchive command
+var unarchiveCmd = &cobra.Command{
+	Use:   "unarchive [name]",
+	Short: "Recreate an archived worktree",
+	Long: `Recreate a worktree removed by 'wtm archive' at its original location and
+reapply its staged, unstaged and untracked changes exactly. The branch must
+still point at the commit it was archived at. Without a name, the archives
+are listed.
+
+Example:
+  wtm unarchive                        # List archives
+  wtm unarchive feature-experiments`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			_, err := repo.Unarchive(commandContext(cmd), args[0])
+			return err
+		}
+
+		archives, err := repo.Archives()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if len(archives) == 0 {
+			fmt.Fprintln(out, "No archived worktrees")
+			return nil
+		}
+		for _, archive := range archives {
+			ref := archive.Branch
+			if ref == "" {
+				ref = fmt.Sprintf("(detached at %.7s)", archive.Base)
+			}
+			changes := "clean"
+			if archive.State != "" {
+				changes = "with changes"
+			}
+			fmt.Fprintf(out, "  %-30s %-30s %s, archived %s\n", archive.Name, ref, changes, archive.Created.Local().Format("2006-01-02"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+	rootCmd.AddCommand(unarchiveCmd)
+	archiveCmd.Flags().String("name", "", "Name of the archive (default: the worktree directory name)")
+	archiveCmd.Flags().Bool("ignored", false, "Also save ignored files")
+}
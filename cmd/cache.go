@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the shared object cache",
+	Long: `Manage the user-level object cache. The cache keeps one bare mirror per
+remote URL; repositories cloned with 'wtm clone --cache' borrow objects from
+it through git alternates instead of downloading them again.
+
+Available subcommands:
+  list        - List cached mirrors
+  update      - Fetch cached mirrors
+  gc          - Repack cached mirrors
+  dissociate  - Stop the current repository from borrowing cached objects`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached mirrors",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := objectCache(cmd)
+		if err != nil {
+			return err
+		}
+
+		mirrors, err := cache.Mirrors(commandContext(cmd))
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(mirrors) == 0 {
+			fmt.Fprintln(out, "Object cache is empty. Use 'wtm clone --cache <url>' to populate it.")
+			return nil
+		}
+
+		fmt.Fprintf(out, "Cached mirrors in %s:\n", cache.Dir)
+		fmt.Fprintln(out)
+		for _, m := range mirrors {
+			fmt.Fprintf(out, "  %s (%s, updated %s)\n", m.URL, formatSize(m.Size), m.Updated.Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+var cacheUpdateCmd = &cobra.Command{
+	Use:   "update [url...]",
+	Short: "Fetch cached mirrors",
+	Long: `Fetch the given mirrors, creating them if needed, or every cached mirror
+when no URL is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := objectCache(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx := commandContext(cmd)
+		if len(args) == 0 {
+			return cache.UpdateAll(ctx)
+		}
+		for _, url := range args {
+			if _, err := cache.Update(ctx, url); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var cacheGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Repack cached mirrors",
+	Long: `Run git gc in every cached mirror. Unreachable objects are never pruned,
+since repositories may still borrow them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := objectCache(cmd)
+		if err != nil {
+			return err
+		}
+		return cache.GC(commandContext(cmd))
+	},
+}
+
+var cacheDissociateCmd = &cobra.Command{
+	Use:   "dissociate",
+	Short: "Copy borrowed objects into the repository and stop using the cache",
+	Long: `Copy every object the current repository borrows from the object cache
+into its own object store, then remove the alternates. The alternates are only
+removed once the repository is verified to be complete without them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		return repo.Dissociate(commandContext(cmd))
+	},
+}
+
+// objectCache returns the object cache at the default location, wired to
+// the command's output streams.
+func objectCache(cmd *cobra.Command) (*wtm.ObjectCache, error) {
+	dir, err := wtm.DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &wtm.ObjectCache{Dir: dir, Stdout: cmd.OutOrStdout(), Stderr: cmd.ErrOrStderr()}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheUpdateCmd)
+	cacheCmd.AddCommand(cacheGCCmd)
+	cacheCmd.AddCommand(cacheDissociateCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheCmd(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	remoteRepo := filepath.Join(t.TempDir(), "remote.git")
+	if err := exec.Command("git", "init", "--bare", remoteRepo).Run(); err != nil {
+		t.Fatalf("Failed to init bare repo: %v", err)
+	}
+
+	var out bytes.Buffer
+	cacheListCmd.SetOut(&out)
+	defer cacheListCmd.SetOut(nil)
+
+	if err := cacheListCmd.RunE(cacheListCmd, nil); err != nil {
+		t.Fatalf("cache list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Object cache is empty") {
+		t.Errorf("Expected empty cache message, got %q", out.String())
+	}
+
+	cloneCmd.Flags().Set("cache", "true")
+	defer cloneCmd.Flags().Set("cache", "false")
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	if err := cloneCmd.RunE(cloneCmd, []string{remoteRepo, cloneDir}); err != nil {
+		t.Fatalf("cloneCmd failed: %v", err)
+	}
+
+	out.Reset()
+	if err := cacheListCmd.RunE(cacheListCmd, nil); err != nil {
+		t.Fatalf("cache list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), remoteRepo) {
+		t.Errorf("Expected %s in cache list, got %q", remoteRepo, out.String())
+	}
+
+	if err := cacheUpdateCmd.RunE(cacheUpdateCmd, nil); err != nil {
+		t.Errorf("cache update failed: %v", err)
+	}
+	if err := cacheGCCmd.RunE(cacheGCCmd, nil); err != nil {
+		t.Errorf("cache gc failed: %v", err)
+	}
+}
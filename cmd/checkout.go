@@ -1,10 +1,7 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"wtm/pkg/wtm"
 
 	"github.com/spf13/cobra"
 )
@@ -19,83 +16,27 @@ The worktree will be created in the 'tree' directory with the name of the commit
 Example:
   wtm checkout main          # Creates tree/main
   wtm checkout feature/new   # Creates tree/feature-new
-  wtm checkout abc123        # Creates tree/abc123`,
+  wtm checkout abc123        # Creates tree/abc123
+
+Remote branches are checked out on a local branch tracking them. The branch
+keeps its name when that is free, and is prefixed with the remote otherwise.
+<user>:<branch> checks out a branch of user's fork of origin, adding the fork
+as a remote on the fly:
+  wtm checkout upstream/main   # Creates branch upstream-main if main exists
+  wtm checkout alice:fix-typo  # Adds remote alice, creates tree/fix-typo`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		commitish := args[0]
-
-		// Get the current directory (should be the bare repo)
-		cwd, err := os.Getwd()
+		repo, _, err := discoverRepository(cmd)
 		if err != nil {
-			return fmt.Errorf("error getting current directory: %w", err)
-		}
-
-		// Check if we're in a bare repository
-		checkBare := exec.Command("git", "rev-parse", "--is-bare-repository")
-		output, err := checkBare.Output()
-		if err != nil || string(output) != "true\n" {
-			return fmt.Errorf("not in a bare repository. Please run this command from a bare repository")
-		}
-
-		// Sanitize the commitish for use as a directory name
-		// Replace slashes with dashes to handle branch names like "feature/new"
-		dirName := filepath.Base(commitish)
-		if commitish != dirName {
-			// If commitish contains slashes, replace them with dashes
-			dirName = ""
-			for _, char := range commitish {
-				if char == '/' {
-					dirName += "-"
-				} else {
-					dirName += string(char)
-				}
-			}
-		}
-
-		// Create the tree directory if it doesn't exist
-		treeDir := filepath.Join(cwd, "tree")
-		if err := os.MkdirAll(treeDir, 0755); err != nil {
-			return fmt.Errorf("error creating tree directory: %w", err)
-		}
-
-		// Full path for the new worktree
-		worktreePath := filepath.Join(treeDir, dirName)
-
-		// Check if worktree already exists
-		if _, err := os.Stat(worktreePath); err == nil {
-			return fmt.Errorf("worktree already exists at %s", worktreePath)
-		}
-
-		fmt.Printf("Creating worktree for '%s' at %s...\n", commitish, worktreePath)
-
-		// Create the worktree
-		addWorktree := exec.Command("git", "worktree", "add", worktreePath, commitish)
-		addWorktree.Stdout = os.Stdout
-		addWorktree.Stderr = os.Stderr
-		if err := addWorktree.Run(); err != nil {
-			return fmt.Errorf("error creating worktree: %w", err)
-		}
-
-		// Initialize and update submodules if they exist
-		submoduleCmd := exec.Command("git", "submodule", "update", "--init", "--recursive")
-		submoduleCmd.Dir = worktreePath
-		submoduleCmd.Stdout = os.Stdout
-		submoduleCmd.Stderr = os.Stderr
-		// Ignore error - command exits successfully with no action if no submodules exist
-		_ = submoduleCmd.Run()
-
-		// Restore persisted files if --restore flag is set
-		if cmd.Flags().Changed("restore") && cmd.Flag("restore").Value.String() == "true" {
-			sharedDir := filepath.Join(cwd, "shared")
-			fmt.Println("Restoring all persisted files...")
-			err := restoreAllFiles(sharedDir, worktreePath)
-			if err != nil {
-				return fmt.Errorf("error restoring persisted files: %w", err)
-			}
+			return err
 		}
 
-		fmt.Printf("Successfully created worktree at %s\n", worktreePath)
-		return nil
+		restore, _ := cmd.Flags().GetBool("restore")
+		_, err = repo.Checkout(commandContext(cmd), wtm.CheckoutOptions{
+			Commitish: args[0],
+			Restore:   restore,
+		})
+		return err
 	},
 }
 
@@ -1,10 +1,7 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-	"os/exec"
-	"strings"
+	"wtm/pkg/wtm"
 
 	"github.com/spf13/cobra"
 )
@@ -14,48 +11,87 @@ var cloneCmd = &cobra.Command{
 	Use:   "clone <repo-url> [directory]",
 	Short: "Clone a repository as a bare repository for worktree usage",
 	Long: `Clone a repository as a bare repository and configure the fetch refspec
-to fetch all remote branches. This setup is ideal for a worktree-based workflow.`,
+to fetch all remote branches. This setup is ideal for a worktree-based workflow.
+
+After cloning, all remote branches are fetched, origin/HEAD is set to the
+remote's default branch and the workspace is created on that branch (or on
+--branch). Running clone again on an existing clone completes any missing step.
+
+Use --template to seed shared/ from a directory and restore it into the new
+workspace, and --hooks to run the commands configured in wtm.postCheckout.
+
+For large repositories, --depth, --filter, --single-branch and --no-submodules
+reduce what is downloaded up front. checkout and switch later fetch missing
+branches and deepen shallow history on demand.
+
+With --cache, objects are borrowed from a mirror of <repo-url> kept in the
+user-level object cache (see 'wtm cache'), so further clones of the same
+remote download almost nothing.
+
+The clone is added to the machine-wide registry used by 'wtm repos' unless
+--no-register is given.
+
+Layouts:
+  bare     The bare repository is the project directory (default)
+  dotbare  The bare repository lives in <directory>/.bare and <directory>/.git
+           points to it, keeping the project directory clean`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		repoURL := args[0]
-		var dir string
+		layout, _ := cmd.Flags().GetString("layout")
+		branch, _ := cmd.Flags().GetString("branch")
+		runHooks, _ := cmd.Flags().GetBool("hooks")
+		template, _ := cmd.Flags().GetString("template")
+		depth, _ := cmd.Flags().GetInt("depth")
+		filter, _ := cmd.Flags().GetString("filter")
+		singleBranch, _ := cmd.Flags().GetBool("single-branch")
+		noSubmodules, _ := cmd.Flags().GetBool("no-submodules")
+		useCache, _ := cmd.Flags().GetBool("cache")
+		opts := wtm.CloneOptions{
+			URL:            args[0],
+			Layout:         wtm.Layout(layout),
+			Branch:         branch,
+			RunHooks:       runHooks,
+			SharedTemplate: template,
+			Depth:          depth,
+			Filter:         filter,
+			SingleBranch:   singleBranch,
+			NoSubmodules:   noSubmodules,
+			Stdout:         cmd.OutOrStdout(),
+			Stderr:         cmd.ErrOrStderr(),
+		}
 		if len(args) == 2 {
-			dir = args[1]
-		} else {
-			// Infer directory from repo URL
-			parts := strings.Split(repoURL, "/")
-			lastPart := parts[len(parts)-1]
-			dir = strings.TrimSuffix(lastPart, ".git")
+			opts.Dir = args[1]
 		}
-
-		fmt.Printf("Cloning %s into %s...\n", repoURL, dir)
-
-		// 1. git clone --bare --recurse-submodules <repo-url> <directory>
-		clone := exec.Command("git", "clone", "--bare", "--recurse-submodules", repoURL, dir)
-		clone.Stdout = os.Stdout
-		clone.Stderr = os.Stderr
-		if err := clone.Run(); err != nil {
-			return fmt.Errorf("error cloning repository: %w", err)
+		if noRegister, _ := cmd.Flags().GetBool("no-register"); !noRegister {
+			registry, err := repoRegistry(cmd)
+			if err != nil {
+				return err
+			}
+			opts.Registry = registry
 		}
-
-		// 2. Change directory to <directory>
-		// We can't change the process's working directory permanently for the user,
-		// but we can run subsequent commands in that directory.
-
-		// 3. git config --add remote.origin.fetch "+refs/heads/*:refs/remotes/origin/*"
-		configCmd := exec.Command("git", "config", "--add", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*")
-		configCmd.Dir = dir
-		configCmd.Stdout = os.Stdout
-		configCmd.Stderr = os.Stderr
-		if err := configCmd.Run(); err != nil {
-			return fmt.Errorf("error configuring remote fetch: %w", err)
+		if useCache {
+			cache, err := objectCache(cmd)
+			if err != nil {
+				return err
+			}
+			opts.Cache = cache
 		}
 
-		fmt.Println("Repository cloned and configured successfully.")
-		return nil
+		_, err := wtm.Clone(commandContext(cmd), opts)
+		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(cloneCmd)
+	cloneCmd.Flags().String("layout", string(wtm.LayoutBare), "Repository layout: bare or dotbare")
+	cloneCmd.Flags().StringP("branch", "b", "", "Branch to check out in the workspace (defaults to the remote's default branch)")
+	cloneCmd.Flags().Int("depth", 0, "Create a shallow clone with history truncated to this many commits")
+	cloneCmd.Flags().String("filter", "", "Partial clone filter, e.g. blob:none or tree:0")
+	cloneCmd.Flags().Bool("single-branch", false, "Only fetch the checked out branch; other branches are fetched on demand")
+	cloneCmd.Flags().Bool("no-submodules", false, "Do not clone or initialize submodules")
+	cloneCmd.Flags().Bool("cache", false, "Borrow objects from a mirror in the shared object cache")
+	cloneCmd.Flags().Bool("hooks", false, "Run the wtm.postCheckout hooks in the new workspace")
+	cloneCmd.Flags().Bool("no-register", false, "Do not add the repository to the registry used by 'wtm repos'")
+	cloneCmd.Flags().String("template", "", "Directory to copy into shared/ and restore into the workspace")
 }
@@ -48,3 +48,31 @@ func TestCloneCmd(t *testing.T) {
 		t.Errorf("Expected fetch refspec %q, got %q", expected, string(output))
 	}
 }
+
+func TestCloneCmd_DotBareLayout(t *testing.T) {
+	remoteRepo := filepath.Join(t.TempDir(), "remote.git")
+	if err := exec.Command("git", "init", "--bare", remoteRepo).Run(); err != nil {
+		t.Fatalf("Failed to init bare repo: %v", err)
+	}
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+
+	cloneCmd.Flags().Set("layout", "dotbare")
+	defer cloneCmd.Flags().Set("layout", "bare")
+
+	if err := cloneCmd.RunE(cloneCmd, []string{remoteRepo, cloneDir}); err != nil {
+		t.Fatalf("cloneCmd failed: %v", err)
+	}
+
+	// The bare repository lives in .bare and .git points to it
+	if _, err := os.Stat(filepath.Join(cloneDir, ".bare", "HEAD")); err != nil {
+		t.Errorf("Expected bare repository in .bare: %v", err)
+	}
+	gitFile, err := os.ReadFile(filepath.Join(cloneDir, ".git"))
+	if err != nil {
+		t.Fatalf("Expected .git file: %v", err)
+	}
+	if string(gitFile) != "gitdir: ./.bare\n" {
+		t.Errorf("Unexpected .git file content %q", string(gitFile))
+	}
+}
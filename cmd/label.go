@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// labelCmd represents the label command
+var labelCmd = &cobra.Command{
+	Use:   "label",
+	Short: "Manage worktree labels",
+	Long: `Tag worktrees with labels such as blocked or hotfix. Labels are shown by
+'wtm list' and select worktrees with the --label flag of 'wtm list' and
+'wtm prune'.
+
+Example:
+  wtm label add feature blocked,hotfix
+  wtm label remove feature blocked
+  wtm list --label hotfix`,
+}
+
+var labelAddCmd = &cobra.Command{
+	Use:   "add <worktree> <label>[,<label>...]",
+	Short: "Add labels to a worktree",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		path, err := repo.ResolveWorktree(commandContext(cmd), args[0])
+		if err != nil {
+			return err
+		}
+		labels, err := parseLabels(args[1:])
+		if err != nil {
+			return err
+		}
+		return repo.AddLabels(path, labels...)
+	},
+}
+
+var labelRemoveCmd = &cobra.Command{
+	Use:   "remove <worktree> <label>[,<label>...]",
+	Short: "Remove labels from a worktree",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		path, err := repo.ResolveWorktree(commandContext(cmd), args[0])
+		if err != nil {
+			return err
+		}
+		labels, err := parseLabels(args[1:])
+		if err != nil {
+			return err
+		}
+		return repo.RemoveLabels(path, labels...)
+	},
+}
+
+// parseLabels splits comma-separated label arguments
+func parseLabels(args []string) ([]string, error) {
+	var labels []string
+	for _, arg := range args {
+		for _, label := range strings.Split(arg, ",") {
+			label = strings.TrimSpace(label)
+			if label == "" {
+				continue
+			}
+			if strings.ContainsAny(label, " \t\n") {
+				return nil, fmt.Errorf("invalid label %q: labels cannot contain whitespace", label)
+			}
+			labels = append(labels, label)
+		}
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("no labels given")
+	}
+	return labels, nil
+}
+
+func init() {
+	rootCmd.AddCommand(labelCmd)
+	labelCmd.AddCommand(labelAddCmd)
+	labelCmd.AddCommand(labelRemoveCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLabelAndNoteCmd(t *testing.T) {
+	// Create a remote with a main branch and clone it
+	tempDir := t.TempDir()
+	remoteRepo := filepath.Join(tempDir, "remote.git")
+	tempClone := filepath.Join(tempDir, "temp-clone")
+	for _, args := range [][]string{
+		{"init", "--bare", remoteRepo},
+		{"clone", remoteRepo, tempClone},
+		{"-C", tempClone, "checkout", "-b", "main"},
+		{"-C", tempClone, "commit", "--allow-empty", "-m", "Initial commit"},
+		{"-C", tempClone, "push", "origin", "main"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	cloneDir := filepath.Join(tempDir, "project")
+	if err := cloneCmd.RunE(cloneCmd, []string{remoteRepo, cloneDir}); err != nil {
+		t.Fatalf("cloneCmd failed: %v", err)
+	}
+
+	repoPath = cloneDir
+	defer func() { repoPath = "" }()
+
+	if err := labelAddCmd.RunE(labelAddCmd, []string{"workspace", "blocked,hotfix"}); err != nil {
+		t.Fatalf("label add failed: %v", err)
+	}
+	if err := labelRemoveCmd.RunE(labelRemoveCmd, []string{"main", "blocked"}); err != nil {
+		t.Fatalf("label remove failed: %v", err)
+	}
+	if err := noteCmd.RunE(noteCmd, []string{"workspace", "waiting on review"}); err != nil {
+		t.Fatalf("note failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	noteCmd.SetOut(&out)
+	defer noteCmd.SetOut(nil)
+	if err := noteCmd.RunE(noteCmd, []string{"workspace"}); err != nil {
+		t.Fatalf("note failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "waiting on review") || !strings.Contains(out.String(), "Labels: hotfix") {
+		t.Errorf("Expected note and labels, got %q", out.String())
+	}
+
+	listCmd.SetOut(&out)
+	defer listCmd.SetOut(nil)
+
+	labels := listCmd.Flags().Lookup("label").Value.(pflag.SliceValue)
+	defer labels.Replace(nil)
+
+	labels.Replace([]string{"hotfix"})
+	out.Reset()
+	if err := listCmd.RunE(listCmd, nil); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "labels: hotfix") || !strings.Contains(out.String(), "note:   waiting on review") {
+		t.Errorf("Expected labeled workspace, got %q", out.String())
+	}
+
+	labels.Replace([]string{"blocked"})
+	out.Reset()
+	if err := listCmd.RunE(listCmd, nil); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "No worktrees labeled blocked") {
+		t.Errorf("Expected no blocked worktrees, got %q", out.String())
+	}
+}
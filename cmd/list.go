@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"wtm/pkg/forge"
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the worktrees of the repository",
+	Long: `List the workspace and every worktree under tree/ together with the
+branch or commit checked out in it.
+
+With --prs, the pull request of each branch is looked up on the forge hosting
+origin and shown with its state, review status and CI checks. See 'wtm prune
+--merged-prs' to remove the worktrees of merged pull requests.
+
+Labels, notes and ticket links set with 'wtm label' and 'wtm note' are shown
+below each worktree. --label only lists the worktrees carrying all of the
+given labels.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		ctx := commandContext(cmd)
+
+		worktrees, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(worktrees) == 0 {
+			fmt.Fprintln(out, "No worktrees yet. Use 'wtm checkout <branch>' or 'wtm switch <branch>' to create one.")
+			return nil
+		}
+
+		labels, _ := cmd.Flags().GetStringSlice("label")
+		if len(labels) > 0 {
+			worktrees = wtm.FilterLabels(worktrees, labels...)
+			if len(worktrees) == 0 {
+				fmt.Fprintf(out, "No worktrees labeled %s\n", strings.Join(labels, ", "))
+				return nil
+			}
+		}
+
+		if prs, _ := cmd.Flags().GetBool("prs"); prs {
+			remote, _ := cmd.Flags().GetString("remote")
+			provider, err := repo.Forge(ctx, remote)
+			if err != nil {
+				return err
+			}
+			if err := repo.AttachPullRequests(ctx, provider, worktrees); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v\n", err)
+			}
+		}
+
+		for _, wt := range worktrees {
+			name := wt.Path
+			if rel, err := filepath.Rel(repo.Root, wt.Path); err == nil {
+				name = rel
+			}
+
+			ref := wt.Branch
+			if ref == "" {
+				ref = fmt.Sprintf("(detached at %.7s)", wt.Head)
+			}
+
+			if wt.Review {
+				ref += " (review"
+				if !wt.Expires.IsZero() {
+					ref += ", expires " + wt.Expires.Local().Format("2006-01-02")
+				}
+				ref += ")"
+			}
+
+			line := fmt.Sprintf("  %-30s %s", name, ref)
+			if wt.PullRequest != nil {
+				line = fmt.Sprintf("%-65s %s", line, formatPullRequest(wt.PullRequest))
+			}
+			fmt.Fprintln(out, line)
+
+			m := wt.Metadata
+			if len(m.Labels) > 0 {
+				fmt.Fprintf(out, "      labels: %s\n", strings.Join(m.Labels, ", "))
+			}
+			if m.Note != "" {
+				fmt.Fprintf(out, "      note:   %s\n", m.Note)
+			}
+			if m.Ticket != "" {
+				fmt.Fprintf(out, "      ticket: %s\n", m.Ticket)
+			}
+		}
+
+		return nil
+	},
+}
+
+// formatPullRequest summarizes the status of pr on one line
+func formatPullRequest(pr *forge.PullRequest) string {
+	parts := []string{fmt.Sprintf("#%d %s", pr.Number, pr.State)}
+	if pr.State == forge.StateOpen {
+		parts = append(parts, strings.ReplaceAll(string(pr.Review), "_", " "))
+	}
+	if pr.Checks != forge.ChecksNone {
+		parts = append(parts, "checks "+string(pr.Checks))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().Bool("prs", false, "Show the pull request status of each branch")
+	listCmd.Flags().String("remote", "origin", "Remote whose forge is queried for pull requests")
+	listCmd.Flags().StringSlice("label", nil, "Only list worktrees with these labels (comma-separated)")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListCmd_PullRequests(t *testing.T) {
+	// Create a remote with a main branch
+	tempDir := t.TempDir()
+	remoteRepo := filepath.Join(tempDir, "remote.git")
+	tempClone := filepath.Join(tempDir, "temp-clone")
+	for _, args := range [][]string{
+		{"init", "--bare", remoteRepo},
+		{"clone", remoteRepo, tempClone},
+		{"-C", tempClone, "checkout", "-b", "main"},
+		{"-C", tempClone, "commit", "--allow-empty", "-m", "Initial commit"},
+		{"-C", tempClone, "push", "origin", "main"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	cloneDir := filepath.Join(tempDir, "project")
+	if err := cloneCmd.RunE(cloneCmd, []string{remoteRepo, cloneDir}); err != nil {
+		t.Fatalf("cloneCmd failed: %v", err)
+	}
+
+	// Stub the GitHub API for the pull request of main
+	routes := map[string]any{
+		"/repos/org/repo/pulls":                  []map[string]any{{"number": 7, "state": "open", "head": map[string]any{"ref": "main", "sha": "abc"}}},
+		"/repos/org/repo/pulls/7/reviews":        []map[string]any{{"user": map[string]any{"login": "bob"}, "state": "APPROVED"}},
+		"/repos/org/repo/commits/abc/status":     map[string]any{"state": "success", "total_count": 1},
+		"/repos/org/repo/commits/abc/check-runs": map[string]any{"check_runs": []any{}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	for _, args := range [][]string{
+		{"-C", cloneDir, "remote", "set-url", "origin", "https://github.com/org/repo.git"},
+		{"-C", cloneDir, "config", "wtm.forgeAPI", server.URL},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	repoPath = cloneDir
+	defer func() { repoPath = "" }()
+	t.Setenv("WTM_FORGE_TOKEN", "")
+
+	var out bytes.Buffer
+	listCmd.SetOut(&out)
+	defer listCmd.SetOut(nil)
+
+	if err := listCmd.RunE(listCmd, nil); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "workspace") || strings.Contains(out.String(), "#7") {
+		t.Errorf("Expected plain listing of the workspace, got %q", out.String())
+	}
+
+	listCmd.Flags().Set("prs", "true")
+	defer listCmd.Flags().Set("prs", "false")
+
+	out.Reset()
+	if err := listCmd.RunE(listCmd, nil); err != nil {
+		t.Fatalf("list --prs failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "[#7 open, approved, checks success]") {
+		t.Errorf("Expected pull request status in listing, got %q", out.String())
+	}
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain points the repository registry at a temporary directory so that
+// commands registering clones leave the user's registry alone.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "wtm-data-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("XDG_DATA_HOME", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// noteCmd represents the note command
+var noteCmd = &cobra.Command{
+	Use:   "note <worktree> [text]",
+	Short: "Attach a note and ticket link to a worktree",
+	Long: `Record why a worktree exists. The note, the labels set with 'wtm label' and
+the ticket URL are kept in the bare repository, shown by 'wtm list' and move
+with the worktree when 'wtm switch' moves it.
+
+The worktree is named by its path, its path relative to the repository root
+(such as workspace or tree/feature), its name under tree/ or its branch.
+Without text or --ticket, the current metadata is shown. An empty text clears
+the note.
+
+Example:
+  wtm note feature "waiting on the API change"
+  wtm note feature --ticket https://tracker.example.com/PROJ-123
+  wtm note feature ""                  # Clear the note`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		path, err := repo.ResolveWorktree(commandContext(cmd), args[0])
+		if err != nil {
+			return err
+		}
+
+		ticketSet := cmd.Flags().Changed("ticket")
+		if len(args) == 1 && !ticketSet {
+			m, err := repo.Metadata(path)
+			if err != nil {
+				return err
+			}
+			printMetadata(cmd, m)
+			return nil
+		}
+
+		ticket, _ := cmd.Flags().GetString("ticket")
+		return repo.UpdateMetadata(path, func(m *wtm.Metadata) {
+			if len(args) == 2 {
+				m.Note = args[1]
+			}
+			if ticketSet {
+				m.Ticket = ticket
+			}
+		})
+	},
+}
+
+// printMetadata prints the note, labels and ticket of a worktree
+func printMetadata(cmd *cobra.Command, m wtm.Metadata) {
+	out := cmd.OutOrStdout()
+	if m.IsZero() {
+		fmt.Fprintln(out, "No note, labels or ticket")
+		return
+	}
+	if m.Note != "" {
+		fmt.Fprintf(out, "Note:   %s\n", m.Note)
+	}
+	if len(m.Labels) > 0 {
+		fmt.Fprintf(out, "Labels: %s\n", strings.Join(m.Labels, ", "))
+	}
+	if m.Ticket != "" {
+		fmt.Fprintf(out, "Ticket: %s\n", m.Ticket)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(noteCmd)
+	noteCmd.Flags().String("ticket", "", "URL of the issue or ticket the worktree is for (empty to clear)")
+}
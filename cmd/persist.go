@@ -2,12 +2,13 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"wtm/pkg/wtm"
+
 	"github.com/spf13/cobra"
 )
 
@@ -18,71 +19,201 @@ var persistCmd = &cobra.Command{
 	Long: `Persist files and directories to share them across all worktrees.
 Files are stored in the shared/ directory in the bare repository root.
 
+Every entry is recorded in a manifest in the bare repository (wtm/shared.json)
+together with the worktree and branch it came from, when it was persisted, its
+size, its SHA-256 digest and how it should be restored.
+
 Available subcommands:
-  add     - Persist a file or directory
-  list    - List all persisted files
-  remove  - Remove a persisted file or directory`,
+  add      - Persist files, directories or patterns
+  sync     - Persist the files declared in .wtmpersist
+  update   - Replace a persisted file or directory with the current copy
+  diff     - Compare a persisted file or directory with the current copy
+  list     - List all persisted files
+  remove   - Remove a persisted file or directory
+  verify   - Check shared storage against the manifest
+  log      - Show the history of a persisted file or directory
+  show     - Print a persisted file as it was in a snapshot
+  rollback - Restore a persisted file or directory from a snapshot
+
+Every change to shared/ is recorded as a commit on the hidden ref
+refs/wtm/shared, so earlier versions can be inspected and restored.`,
 }
 
 var persistAddCmd = &cobra.Command{
-	Use:   "add <file|dir>",
+	Use:   "add <file|dir|pattern>...",
 	Short: "Persist a file or directory to shared storage",
 	Long: `Copy a file or directory from the current worktree to shared storage.
 The path structure is preserved, so the file can be restored to the same location.
 
+Patterns select every matching path of the worktree, relative to its root.
+They may use *, ? and [...] within a path segment, and ** for any number of
+directories. Quote them so that the shell does not expand them. --exclude
+leaves out the paths matching another pattern. Paths that are already
+persisted with the same content are skipped.
+
+--mode records how the entry is restored when 'wtm restore' is not told
+otherwise: copy (default), link, hardlink, reflink or link-files. See 'wtm
+restore'.
+
+--branch persists to the layer of the current branch (or of the branch given
+as --branch=<name>) in shared/@branches/<branch>/. 'wtm restore' restores
+the entries of that layer in the worktrees of the branch, over the common
+entries.
+
+Symlinks are persisted as symlinks; --dereference copies what they point to
+instead. Modes and modification times are kept. Sockets, named pipes and
+devices are skipped with a warning.
+
 Example:
   wtm persist add .env
   wtm persist add src/config.json
-  wtm persist add node_modules`,
-	Args: cobra.ExactArgs(1),
+  wtm persist add node_modules --mode link
+  wtm persist add .env --branch
+  wtm persist add '.env*' 'config/*.local.yml' '**/.secrets'
+  wtm persist add 'config/*.yml' --exclude config/example.yml`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		targetPath := args[0]
+		mode, _ := cmd.Flags().GetString("mode")
+		excludes, _ := cmd.Flags().GetStringSlice("exclude")
+		dereference, _ := cmd.Flags().GetBool("dereference")
+		branch, _ := cmd.Flags().GetString("branch")
 
-		// Find bare repo root and current worktree root
-		bareRepoRoot, worktreeRoot, err := findRepoRoots()
+		if len(args) == 1 && !wtm.IsPattern(args[0]) && len(excludes) == 0 {
+			repo, opts, err := persistTarget(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			opts.Mode = wtm.RestoreMode(mode)
+			opts.Dereference = dereference
+			_, err = repo.Persist(commandContext(cmd), opts)
+			return err
+		}
+
+		repo, loc, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		worktreeRoot, err := repo.TargetWorktree(loc)
 		if err != nil {
 			return err
 		}
 
-		// Get absolute path of target file
-		absTargetPath := targetPath
-		if !filepath.IsAbs(targetPath) {
-			absTargetPath = filepath.Join(worktreeRoot, targetPath)
+		// Several literal paths are usually a pattern the shell expanded
+		var patterns []string
+		for _, arg := range args {
+			pattern := worktreePattern(worktreeRoot, loc, arg)
+			if !wtm.IsPattern(arg) {
+				pattern = wtm.EscapePattern(pattern)
+			}
+			patterns = append(patterns, pattern)
+		}
+		for i, exclude := range excludes {
+			excludes[i] = worktreePattern(worktreeRoot, loc, exclude)
 		}
 
-		// Check if target exists
-		if _, err := os.Stat(absTargetPath); os.IsNotExist(err) {
-			return fmt.Errorf("file or directory does not exist: %s", targetPath)
+		rules, err := wtm.NewPersistRules(patterns, excludes, wtm.RestoreMode(mode))
+		if err != nil {
+			return err
 		}
+		return repo.SyncPersisted(commandContext(cmd), wtm.SyncOptions{Worktree: worktreeRoot, Rules: rules, Dereference: dereference, Branch: branch})
+	},
+}
 
-		// Get relative path from worktree root to preserve structure
-		relPath, err := filepath.Rel(worktreeRoot, absTargetPath)
+var persistSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Persist the files declared in .wtmpersist",
+	Long: `Persist the paths of the current worktree selected by the .wtmpersist file
+at its root, where it can be committed, and by the .wtmpersist file in the
+bare repository root, whose rules come last.
+
+Every line of a .wtmpersist file holds a pattern relative to the worktree
+root, optionally followed by the mode entries are restored in. Lines starting
+with ! exclude what their pattern matches; the last matching line decides.
+Blank lines and lines starting with # are ignored:
+
+  # local configuration
+  .env*
+  config/*.local.yml
+  !config/example.local.yml
+  node_modules link
+
+Paths not in shared storage yet are persisted. Paths whose shared copy
+differs are reported, and replaced with --update. 'wtm restore --all' restores
+the declared entries.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, loc, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		worktreeRoot, err := repo.TargetWorktree(loc)
 		if err != nil {
-			return fmt.Errorf("error determining relative path: %w", err)
+			return err
 		}
 
-		// Create destination path in shared/
-		sharedDir := filepath.Join(bareRepoRoot, "shared")
-		destPath := filepath.Join(sharedDir, relPath)
+		update, _ := cmd.Flags().GetBool("update")
+		return repo.SyncPersisted(commandContext(cmd), wtm.SyncOptions{Worktree: worktreeRoot, Update: update})
+	},
+}
 
-		// Check if already exists in shared
-		if _, err := os.Stat(destPath); err == nil {
-			return fmt.Errorf("file already exists in shared storage: %s\nUse 'wtm persist remove %s' first if you want to update it", relPath, relPath)
-		}
+var persistUpdateCmd = &cobra.Command{
+	Use:   "update <file|dir>",
+	Short: "Replace a persisted file or directory with the current copy",
+	Long: `Copy a file or directory from the current worktree over its entry in shared
+storage. The new copy is written next to the old one and swapped in, so other
+worktrees never see a partial update; the previous version is kept until the
+swap succeeded.
+
+The restore mode recorded for the entry is kept unless --mode is given.
+--branch updates the entry of a branch layer, see 'wtm persist add'.
 
-		// Create parent directories in shared/
-		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			return fmt.Errorf("error creating shared directory structure: %w", err)
+Example:
+  wtm persist diff .env
+  wtm persist update .env`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, opts, err := persistTarget(cmd, args[0])
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Persisting %s to shared/%s...\n", targetPath, relPath)
+		mode, _ := cmd.Flags().GetString("mode")
+		opts.Mode = wtm.RestoreMode(mode)
+		opts.Dereference, _ = cmd.Flags().GetBool("dereference")
+		_, err = repo.UpdatePersisted(commandContext(cmd), opts)
+		return err
+	},
+}
 
-		// Copy file or directory
-		if err := copyPath(absTargetPath, destPath); err != nil {
-			return fmt.Errorf("error copying to shared storage: %w", err)
+var persistDiffCmd = &cobra.Command{
+	Use:   "diff <file|dir>",
+	Short: "Compare a persisted file or directory with the current copy",
+	Long: `Show how the copy in the current worktree differs from shared storage.
+Files are compared as a unified diff; directories list the files that were
+added (A), deleted (D) or modified (M) in the worktree.
+--branch compares with the entry of a branch layer.
+
+Example:
+  wtm persist diff .env
+  wtm persist diff config/`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, opts, err := persistTarget(cmd, args[0])
+		if err != nil {
+			return err
+		}
+
+		diff, err := repo.DiffPersisted(commandContext(cmd), opts)
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Successfully persisted to shared/%s\n", relPath)
+		out := cmd.OutOrStdout()
+		if diff == "" {
+			fmt.Fprintf(out, "%s matches shared storage\n", args[0])
+			return nil
+		}
+		fmt.Fprintln(out, diff)
 		return nil
 	},
 }
@@ -90,55 +221,57 @@ Example:
 var persistListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all persisted files and directories",
-	Long:  `Display all files and directories stored in shared storage.`,
+	Long: `Display the entries of shared storage with their size, preferred restore
+mode and the worktree and branch they were persisted from. Paths found in
+shared/ that are not in the manifest are listed as unmanaged. The entries of
+each branch layer are listed after the common entries.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		bareRepoRoot, _, err := findRepoRoots()
+		repo, _, err := discoverRepository(cmd)
 		if err != nil {
 			return err
 		}
 
-		sharedDir := filepath.Join(bareRepoRoot, "shared")
+		out := cmd.OutOrStdout()
 
 		// Check if shared directory exists
-		if _, err := os.Stat(sharedDir); os.IsNotExist(err) {
-			fmt.Println("No persisted files yet. Use 'wtm persist add <file>' to persist files.")
+		if _, err := os.Stat(repo.SharedPath()); os.IsNotExist(err) {
+			fmt.Fprintln(out, "No persisted files yet. Use 'wtm persist add <file>' to persist files.")
 			return nil
 		}
 
-		fmt.Println("Persisted files in shared/:")
-		fmt.Println()
+		entries, err := repo.Persisted(commandContext(cmd))
+		if err != nil {
+			return err
+		}
 
-		// Walk through shared directory
-		count := 0
-		err = filepath.Walk(sharedDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+		fmt.Fprintln(out, "Persisted files in shared/:")
+		fmt.Fprintln(out)
 
-			// Skip the shared directory itself
-			if path == sharedDir {
-				return nil
+		var layers []string
+		layerEntries := map[string][]wtm.SharedEntry{}
+		for _, entry := range entries {
+			if _, ok := layerEntries[entry.Layer]; !ok {
+				layers = append(layers, entry.Layer)
 			}
+			layerEntries[entry.Layer] = append(layerEntries[entry.Layer], entry)
+		}
+		slices.Sort(layers)
 
-			relPath, _ := filepath.Rel(sharedDir, path)
-
-			if info.IsDir() {
-				fmt.Printf("  📁 %s/\n", relPath)
-			} else {
-				size := formatSize(info.Size())
-				fmt.Printf("  📄 %s (%s)\n", relPath, size)
+		for _, layer := range layers {
+			if layer != "" {
+				fmt.Fprintf(out, "\nBranch %s, in shared/%s:\n\n", layer, wtm.BranchPath(layer, ""))
+			}
+			for _, entry := range layerEntries[layer] {
+				name := "📄 " + entry.Key()
+				if entry.IsDir {
+					name = "📁 " + entry.Key() + "/"
+				}
+				fmt.Fprintf(out, "  %-40s %10s  %s\n", name, formatSize(entry.Size), describeEntry(entry))
 			}
-			count++
-
-			return nil
-		})
-
-		if err != nil {
-			return fmt.Errorf("error listing shared files: %w", err)
 		}
 
-		if count == 0 {
-			fmt.Println("  (empty)")
+		if len(entries) == 0 {
+			fmt.Fprintln(out, "  (empty)")
 		}
 
 		return nil
@@ -150,186 +283,249 @@ var persistRemoveCmd = &cobra.Command{
 	Short: "Remove a persisted file or directory",
 	Long: `Remove a file or directory from shared storage.
 
+--branch removes the entry of a branch layer, see 'wtm persist add'.
+
 Example:
   wtm persist remove .env
-  wtm persist remove src/config.json`,
+  wtm persist remove src/config.json
+  wtm persist remove --branch .env`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		targetPath := args[0]
+		if branch, _ := cmd.Flags().GetString("branch"); branch == "" {
+			repo, _, err := discoverRepository(cmd)
+			if err != nil {
+				return err
+			}
+			return repo.Unpersist(commandContext(cmd), args[0])
+		}
 
-		bareRepoRoot, _, err := findRepoRoots()
+		repo, opts, err := persistTarget(cmd, args[0])
 		if err != nil {
 			return err
 		}
-
-		sharedDir := filepath.Join(bareRepoRoot, "shared")
-		targetFullPath := filepath.Join(sharedDir, targetPath)
-
-		// Check if file exists
-		if _, err := os.Stat(targetFullPath); os.IsNotExist(err) {
-			return fmt.Errorf("file not found in shared storage: %s", targetPath)
+		ctx := commandContext(cmd)
+		path, err := repo.PersistedPath(ctx, opts)
+		if err != nil {
+			return err
 		}
+		return repo.Unpersist(ctx, path)
+	},
+}
 
-		fmt.Printf("Removing %s from shared storage...\n", targetPath)
+var persistVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check shared storage against the manifest",
+	Long: `Recompute the SHA-256 digest of every persisted entry and report entries
+that are missing or were modified outside of wtm, and paths in shared/ that
+are not in the manifest. Exits with an error when anything is reported.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
 
-		// Remove file or directory
-		if err := os.RemoveAll(targetFullPath); err != nil {
-			return fmt.Errorf("error removing from shared storage: %w", err)
+		results, err := repo.VerifyPersisted()
+		if err != nil {
+			return err
 		}
 
-		fmt.Printf("Successfully removed shared/%s\n", targetPath)
-		return nil
+		out := cmd.OutOrStdout()
+		if len(results) == 0 {
+			fmt.Fprintln(out, "All persisted entries match the manifest")
+			return nil
+		}
+		for _, result := range results {
+			fmt.Fprintf(out, "  %-40s %s\n", result.Path, result.Problem)
+		}
+		return fmt.Errorf("shared storage does not match the manifest")
 	},
 }
 
-// findRepoRoots finds the bare repo root and current worktree root
-func findRepoRoots() (bareRepoRoot string, worktreeRoot string, err error) {
-	// Check if we're in a git repository
-	gitDirCmd := []string{"git", "rev-parse", "--git-dir"}
-	gitDir, err := runCommand(gitDirCmd...)
-	if err != nil {
-		return "", "", fmt.Errorf("not in a git repository")
-	}
-
-	gitDir = strings.TrimSpace(gitDir)
+var persistLogCmd = &cobra.Command{
+	Use:   "log <file|dir>",
+	Short: "Show the history of a persisted file or directory",
+	Long: `List the snapshots of shared storage that changed a file or directory,
+newest first. Every change to shared/ made by wtm is committed on the hidden
+ref refs/wtm/shared in the bare repository, which is never fetched or pushed
+by the default refspecs.
 
-	// Check if we're in a bare repo
-	isBareCmd := []string{"git", "rev-parse", "--is-bare-repository"}
-	isBare, _ := runCommand(isBareCmd...)
+Paths are relative to shared/.
 
-	if strings.TrimSpace(isBare) == "true" {
-		return "", "", fmt.Errorf("cannot run persist from bare repository. Please run from a worktree")
-	}
+Example:
+  wtm persist log .env`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
 
-	// Get worktree root
-	worktreeRootCmd := []string{"git", "rev-parse", "--show-toplevel"}
-	worktreeRoot, err = runCommand(worktreeRootCmd...)
-	if err != nil {
-		return "", "", fmt.Errorf("error getting worktree root: %w", err)
-	}
-	worktreeRoot = strings.TrimSpace(worktreeRoot)
+		revisions, err := repo.SharedHistory(commandContext(cmd), args[0])
+		if err != nil {
+			return err
+		}
 
-	// Find bare repo root from git dir
-	if strings.Contains(gitDir, "worktrees") {
-		idx := strings.LastIndex(gitDir, "/worktrees/")
-		if idx == -1 {
-			idx = strings.LastIndex(gitDir, "\\worktrees\\")
+		out := cmd.OutOrStdout()
+		if len(revisions) == 0 {
+			fmt.Fprintf(out, "No history for %s\n", args[0])
+			return nil
 		}
-		if idx == -1 {
-			return "", "", fmt.Errorf("unexpected git directory format")
+		for _, rev := range revisions {
+			fmt.Fprintf(out, "  %.7s  %s  %s\n", rev.Commit, rev.Time.Local().Format("2006-01-02 15:04"), rev.Message)
+		}
+		return nil
+	},
+}
+
+var persistShowCmd = &cobra.Command{
+	Use:   "show <file|dir>[@<rev>]",
+	Short: "Print a persisted file as it was in a snapshot",
+	Long: `Print the content of a file in a snapshot of shared storage, or the files a
+directory contained. <rev> is a commit listed by 'wtm persist log' or ~N for
+the Nth snapshot before the latest one. Without @<rev>, the latest snapshot is
+shown.
+
+Example:
+  wtm persist show .env@~1
+  wtm persist show .env@3f2a9c1`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
 		}
-		bareRepoRoot = gitDir[:idx]
-	} else {
-		return "", "", fmt.Errorf("not in a worktree")
-	}
 
-	return bareRepoRoot, worktreeRoot, nil
+		path, rev := args[0], ""
+		if i := strings.LastIndex(path, "@"); i > 0 {
+			path, rev = path[:i], path[i+1:]
+		}
+		content, err := repo.ShowShared(commandContext(cmd), path, rev)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), content)
+		return nil
+	},
 }
 
-// copyPath copies a file or directory from src to dst
-func copyPath(src, dst string) error {
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
+var persistRollbackCmd = &cobra.Command{
+	Use:   "rollback <file|dir> <rev>",
+	Short: "Restore a persisted file or directory from a snapshot",
+	Long: `Replace a file or directory in shared storage with its content in a
+snapshot. <rev> is a commit listed by 'wtm persist log' or ~N for the Nth
+snapshot before the latest one. Entries removed from shared storage can be
+brought back the same way. The rollback is recorded as a new snapshot, so it
+can itself be undone.
 
-	if srcInfo.IsDir() {
-		return copyDir(src, dst)
-	}
-	return copyFile(src, dst)
+Example:
+  wtm persist log .env
+  wtm persist rollback .env 3f2a9c1`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		return repo.RollbackShared(commandContext(cmd), args[0], args[1])
+	},
 }
 
-// copyFile copies a single file
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
+// persistTarget opens the repository and resolves path within the target
+// worktree. Relative paths are relative to the current directory when inside
+// the worktree, and to the worktree root otherwise.
+func persistTarget(cmd *cobra.Command, path string) (*wtm.Repository, wtm.PersistOptions, error) {
+	repo, loc, err := discoverRepository(cmd)
 	if err != nil {
-		return err
+		return nil, wtm.PersistOptions{}, err
 	}
-	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	worktreeRoot, err := repo.TargetWorktree(loc)
 	if err != nil {
-		return err
+		return nil, wtm.PersistOptions{}, err
 	}
-	defer destFile.Close()
 
-	if _, err := io.Copy(destFile, sourceFile); err != nil {
-		return err
+	if !filepath.IsAbs(path) && loc.Worktree != "" {
+		if rel, err := filepath.Rel(worktreeRoot, filepath.Join(loc.Dir, path)); err == nil {
+			path = rel
+		}
 	}
+	branch, _ := cmd.Flags().GetString("branch")
+	return repo, wtm.PersistOptions{Worktree: worktreeRoot, Path: path, Branch: branch}, nil
+}
 
-	// Preserve permissions
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-	return os.Chmod(dst, srcInfo.Mode())
+// addBranchFlag adds the --branch flag selecting a branch layer to cmd. A
+// bare --branch means the branch of the current worktree.
+func addBranchFlag(cmd *cobra.Command, usage string) {
+	cmd.Flags().String("branch", "", usage)
+	cmd.Flags().Lookup("branch").NoOptDefVal = "HEAD"
 }
 
-// copyDir recursively copies a directory
-func copyDir(src, dst string) error {
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
+// worktreePattern returns pattern relative to the worktree root. Relative
+// patterns are relative to the current directory when inside the worktree.
+func worktreePattern(worktreeRoot string, loc wtm.Location, pattern string) string {
+	if filepath.IsAbs(pattern) || loc.Worktree != "" {
+		abs := pattern
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(loc.Dir, pattern)
+		}
+		if rel, err := filepath.Rel(worktreeRoot, abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
 	}
+	return filepath.ToSlash(pattern)
+}
 
-	// Create destination directory
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
-		return err
+// describeEntry summarizes where a shared entry came from and how it is
+// restored
+func describeEntry(entry wtm.SharedEntry) string {
+	if entry.Unmanaged {
+		return "unmanaged"
 	}
 
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return err
+	mode := entry.Mode
+	if mode == "" {
+		mode = wtm.RestoreCopy
 	}
-
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
-				return err
-			}
+	desc := string(mode)
+	if entry.Source != "" {
+		desc += ", from " + entry.Source
+		if entry.Branch != "" {
+			desc += " (" + entry.Branch + ")"
 		}
 	}
-
-	return nil
+	if !entry.Persisted.IsZero() {
+		desc += ", " + entry.Persisted.Local().Format("2006-01-02 15:04")
+	}
+	return desc
 }
 
 // formatSize formats bytes into human-readable format
 func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
-
-// runCommand runs a command and returns the output
-func runCommand(args ...string) (string, error) {
-	cmd := args[0]
-	cmdArgs := args[1:]
-
-	execCmd := exec.Command(cmd, cmdArgs...)
-	output, err := execCmd.Output()
-	if err != nil {
-		return "", err
-	}
-	return string(output), nil
+	return wtm.FormatSize(bytes)
 }
 
 func init() {
 	rootCmd.AddCommand(persistCmd)
 	persistCmd.AddCommand(persistAddCmd)
+	persistCmd.AddCommand(persistSyncCmd)
+	persistCmd.AddCommand(persistUpdateCmd)
+	persistCmd.AddCommand(persistDiffCmd)
 	persistCmd.AddCommand(persistListCmd)
 	persistCmd.AddCommand(persistRemoveCmd)
+	persistCmd.AddCommand(persistVerifyCmd)
+	persistCmd.AddCommand(persistLogCmd)
+	persistCmd.AddCommand(persistShowCmd)
+	persistCmd.AddCommand(persistRollbackCmd)
+	persistAddCmd.Flags().String("mode", "", "Preferred restore mode: copy, link, hardlink, reflink or link-files")
+	persistAddCmd.Flags().StringSlice("exclude", nil, "Leave out the paths matching these patterns")
+	persistAddCmd.Flags().Bool("dereference", false, "Copy what symlinks point to instead of the links")
+	persistSyncCmd.Flags().Bool("update", false, "Replace entries whose shared copy differs")
+	persistUpdateCmd.Flags().String("mode", "", "Change the preferred restore mode: copy, link, hardlink, reflink or link-files")
+	persistUpdateCmd.Flags().Bool("dereference", false, "Copy what symlinks point to instead of the links")
+	addBranchFlag(persistAddCmd, "Persist to the layer of this branch (default: the current branch)")
+	addBranchFlag(persistUpdateCmd, "Update the entry of this branch's layer (default: the current branch)")
+	addBranchFlag(persistDiffCmd, "Compare with the entry of this branch's layer (default: the current branch)")
+	addBranchFlag(persistRemoveCmd, "Remove the entry of this branch's layer (default: the current branch)")
 }
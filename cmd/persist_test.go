@@ -235,6 +235,44 @@ func TestPersistAdd(t *testing.T) {
 		}
 	})
 
+	t.Run("persist file to the branch layer", func(t *testing.T) {
+		defer persistAddCmd.Flags().Set("branch", "")
+
+		if err := os.WriteFile(filepath.Join(worktreeDir, "branch.env"), []byte("DB=branch"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		branch, err := exec.Command("git", "-C", worktreeDir, "branch", "--show-current").Output()
+		if err != nil {
+			t.Fatalf("Failed to get branch: %v", err)
+		}
+
+		originalDir, _ := os.Getwd()
+		defer os.Chdir(originalDir)
+		os.Chdir(worktreeDir)
+
+		rootCmd.SetArgs([]string{"persist", "add", "branch.env", "--branch"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to persist file: %v", err)
+		}
+
+		layerFile := filepath.Join(bareRepoDir, "shared", "@branches", strings.TrimSpace(string(branch)), "branch.env")
+		if _, err := os.Stat(layerFile); err != nil {
+			t.Errorf("Expected the file in the branch layer: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(bareRepoDir, "shared", "branch.env")); !os.IsNotExist(err) {
+			t.Errorf("Expected no common entry, got %v", err)
+		}
+
+		defer persistRemoveCmd.Flags().Set("branch", "")
+		rootCmd.SetArgs([]string{"persist", "remove", "branch.env", "--branch"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to remove the layer entry: %v", err)
+		}
+		if _, err := os.Stat(layerFile); !os.IsNotExist(err) {
+			t.Errorf("Expected the layer entry to be removed, got %v", err)
+		}
+	})
+
 	t.Run("error when file does not exist", func(t *testing.T) {
 		originalDir, _ := os.Getwd()
 		defer os.Chdir(originalDir)
@@ -462,47 +500,6 @@ func TestPersistRemove(t *testing.T) {
 	})
 }
 
-func TestFindRepoRoots(t *testing.T) {
-	t.Run("error when not in worktree", func(t *testing.T) {
-		// Create a normal (non-worktree) repo
-		tempDir := t.TempDir()
-		cmd := exec.Command("git", "init", tempDir)
-		if err := cmd.Run(); err != nil {
-			t.Fatalf("Failed to create repo: %v", err)
-		}
-
-		originalDir, _ := os.Getwd()
-		defer os.Chdir(originalDir)
-		os.Chdir(tempDir)
-
-		_, _, err := findRepoRoots()
-		if err == nil {
-			t.Error("Expected error when not in worktree, got none")
-		}
-	})
-
-	t.Run("error when in bare repository", func(t *testing.T) {
-		// Create bare repo
-		bareDir := t.TempDir()
-		cmd := exec.Command("git", "init", "--bare", bareDir)
-		if err := cmd.Run(); err != nil {
-			t.Fatalf("Failed to create bare repo: %v", err)
-		}
-
-		originalDir, _ := os.Getwd()
-		defer os.Chdir(originalDir)
-		os.Chdir(bareDir)
-
-		_, _, err := findRepoRoots()
-		if err == nil {
-			t.Error("Expected error when in bare repository, got none")
-		}
-		if !strings.Contains(err.Error(), "bare repository") {
-			t.Errorf("Expected 'bare repository' error, got: %v", err)
-		}
-	})
-}
-
 func TestFormatSize(t *testing.T) {
 	tests := []struct {
 		bytes    int64
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// prCmd represents the pr command
+var prCmd = &cobra.Command{
+	Use:   "pr [number]",
+	Short: "Check out a pull or merge request in tree/pr-<number>",
+	Long: `Fetch the head of a pull request into branch pr-<number> and create a
+worktree for it in tree/pr-<number>.
+
+Pull requests are fetched from refs/pull/<number>/head, or from
+refs/merge-requests/<number>/head when the remote is hosted on GitLab. Set
+wtm.prRef to use another pattern, with * standing for the number:
+  git config wtm.prRef 'refs/merge-requests/*/head'
+
+Example:
+  wtm pr 42             # Creates tree/pr-42
+  wtm pr 42 --update    # Moves tree/pr-42 to the current head of the PR
+  wtm pr --cleanup      # Removes PR worktrees whose refs are gone`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		update, _ := cmd.Flags().GetBool("update")
+		cleanup, _ := cmd.Flags().GetBool("cleanup")
+		restore, _ := cmd.Flags().GetBool("restore")
+		remote, _ := cmd.Flags().GetString("remote")
+
+		if cleanup && len(args) > 0 {
+			return fmt.Errorf("--cleanup does not take a pull request number")
+		}
+		if !cleanup && len(args) == 0 {
+			return fmt.Errorf("a pull request number is required")
+		}
+
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		ctx := commandContext(cmd)
+
+		if cleanup {
+			removed, err := repo.CleanupPullRequests(ctx, remote)
+			if err != nil {
+				return err
+			}
+			if len(removed) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No pull request worktrees to clean up")
+			}
+			return nil
+		}
+
+		number, err := strconv.Atoi(args[0])
+		if err != nil || number <= 0 {
+			return fmt.Errorf("invalid pull request number %q", args[0])
+		}
+
+		_, err = repo.PullRequest(ctx, wtm.PROptions{
+			Number:  number,
+			Remote:  remote,
+			Update:  update,
+			Restore: restore,
+		})
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(prCmd)
+	prCmd.Flags().Bool("update", false, "Refresh an existing pull request worktree")
+	prCmd.Flags().Bool("cleanup", false, "Remove pull request worktrees whose refs no longer exist")
+	prCmd.Flags().Bool("restore", false, "Restore all persisted files after checkout")
+	prCmd.Flags().String("remote", "origin", "Remote the pull request belongs to")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove worktrees that are no longer needed",
+	Long: `Remove stale worktree metadata and expired review worktrees (see 'wtm
+review'). With --merged-prs, also remove the worktrees whose branch has a
+merged pull request on the forge hosting origin, along with their branches.
+A worktree whose branch has commits the pull request did not merge is kept,
+unless the branch is contained in the default branch.
+
+The workspace, worktrees with uncommitted changes and locked worktrees other
+than review worktrees are never removed. With --label, only worktrees
+carrying all of the given labels are considered.
+
+Example:
+  wtm prune                          # Remove expired review worktrees
+  wtm prune --merged-prs --dry-run   # Show what would be removed
+  wtm prune --merged-prs
+  wtm prune --merged-prs --label hotfix`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		mergedPRs, _ := cmd.Flags().GetBool("merged-prs")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		labels, _ := cmd.Flags().GetStringSlice("label")
+
+		removed, err := repo.Prune(commandContext(cmd), wtm.PruneOptions{
+			MergedPRs: mergedPRs,
+			Labels:    labels,
+			DryRun:    dryRun,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(removed) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "Nothing to prune")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().Bool("merged-prs", false, "Remove worktrees whose pull request is merged")
+	pruneCmd.Flags().StringSlice("label", nil, "Only prune worktrees with these labels (comma-separated)")
+	pruneCmd.Flags().Bool("dry-run", false, "Show what would be removed without removing anything")
+}
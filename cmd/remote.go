@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// remoteCmd represents the remote command
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Manage remotes for fork workflows",
+	Long: `Manage the remotes of the repository. Remotes added with wtm fetch all
+branches, so they can be checked out as <remote>/<branch>.
+
+Available subcommands:
+  add   - Add a remote and fetch its branches
+  list  - List configured remotes`,
+}
+
+var remoteAddCmd = &cobra.Command{
+	Use:   "add <name> <url>",
+	Short: "Add a remote and fetch its branches",
+	Long: `Add a remote configured to fetch all of its branches, then fetch them.
+
+Example:
+  wtm remote add upstream https://github.com/org/repo.git
+  wtm checkout upstream/main   # Creates branch upstream-main if main exists`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+		return repo.AddRemote(commandContext(cmd), args[0], args[1])
+	},
+}
+
+var remoteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured remotes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		remotes, err := repo.Remotes(commandContext(cmd))
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		for _, remote := range remotes {
+			fmt.Fprintf(out, "%s\t%s\n", remote.Name, remote.URL)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(remoteCmd)
+	remoteCmd.AddCommand(remoteAddCmd)
+	remoteCmd.AddCommand(remoteListCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// renameCmd represents the rename command
+var renameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a branch together with its worktree",
+	Long: `Rename a local branch. When the branch has a worktree in tree/<old>, the
+worktree moves to tree/<new> along with its note and labels, so that 'wtm
+switch <new>' finds it. A branch checked out in the workspace keeps its place.
+
+The branch keeps tracking its upstream. --push publishes the branch under the
+new name and tracks that instead, and --delete-remote then deletes the
+previous upstream branch on the remote.
+
+Example:
+  wtm rename feature/login feature/sign-in
+  wtm rename wip fix-cache --push --delete-remote`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		push, _ := cmd.Flags().GetBool("push")
+		deleteRemote, _ := cmd.Flags().GetBool("delete-remote")
+		return repo.Rename(commandContext(cmd), wtm.RenameOptions{
+			Old:          args[0],
+			New:          args[1],
+			Push:         push,
+			DeleteRemote: deleteRemote,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renameCmd)
+	renameCmd.Flags().Bool("push", false, "Push the branch under its new name and track it")
+	renameCmd.Flags().Bool("delete-remote", false, "Delete the previous upstream branch after pushing (requires --push)")
+}
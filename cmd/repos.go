@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// reposCmd represents the repos command
+var reposCmd = &cobra.Command{
+	Use:   "repos",
+	Short: "Manage the registry of wtm repositories",
+	Long: `Manage the machine-wide registry of wtm repositories, kept in
+$XDG_DATA_HOME/wtm/repos.json (~/.local/share/wtm/repos.json by default).
+'wtm clone' registers new repositories automatically.
+
+Available subcommands:
+  add     - Register repositories
+  remove  - Unregister repositories
+  list    - List registered repositories
+  status  - Show the worktrees and uncommitted changes of every repository
+  sync    - Fetch every repository in parallel`,
+}
+
+var reposAddCmd = &cobra.Command{
+	Use:   "add [path...]",
+	Short: "Register repositories",
+	Long: `Register the repositories at the given paths, or the current repository
+when no path is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := repoRegistry(cmd)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			repo, _, err := discoverRepository(cmd)
+			if err != nil {
+				return err
+			}
+			args = []string{repo.Root}
+		}
+		for _, path := range args {
+			repo, _, err := wtm.Discover(path)
+			if err != nil {
+				return err
+			}
+			if err := registry.Add(repo.Root); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Registered %s\n", repo.Root)
+		}
+		return nil
+	},
+}
+
+var reposRemoveCmd = &cobra.Command{
+	Use:   "remove <path|name>...",
+	Short: "Unregister repositories",
+	Long: `Remove repositories from the registry, by path or by directory name. The
+repositories themselves are left alone.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := repoRegistry(cmd)
+		if err != nil {
+			return err
+		}
+		for _, path := range args {
+			if err := registry.Remove(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Unregistered %s\n", path)
+		}
+		return nil
+	},
+}
+
+var reposListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered repositories",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := repoRegistry(cmd)
+		if err != nil {
+			return err
+		}
+		repos, err := registry.Repos()
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(repos) == 0 {
+			fmt.Fprintln(out, "No repositories registered. Use 'wtm repos add' or 'wtm clone' to register one.")
+			return nil
+		}
+		for _, repo := range repos {
+			fmt.Fprintf(out, "  %-20s %s\n", repo.Name(), repo.Root)
+		}
+		return nil
+	},
+}
+
+var reposStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the worktrees and uncommitted changes of every repository",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := repoRegistry(cmd)
+		if err != nil {
+			return err
+		}
+		statuses, err := registry.Status(commandContext(cmd))
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if len(statuses) == 0 {
+			fmt.Fprintln(out, "No repositories registered. Use 'wtm repos add' or 'wtm clone' to register one.")
+			return nil
+		}
+		for _, status := range statuses {
+			fmt.Fprintf(out, "%s (%s)\n", status.Name(), status.Root)
+			if status.Err != nil {
+				fmt.Fprintf(out, "  error: %v\n", status.Err)
+				continue
+			}
+			for _, wt := range status.Worktrees {
+				name := wt.Path
+				if rel, err := filepath.Rel(status.Root, wt.Path); err == nil {
+					name = rel
+				}
+				ref := wt.Branch
+				if ref == "" {
+					ref = fmt.Sprintf("(detached at %.7s)", wt.Head)
+				}
+				state := "clean"
+				if wt.Changes > 0 {
+					state = fmt.Sprintf("%d changed", wt.Changes)
+				}
+				fmt.Fprintf(out, "  %-30s %-30s %s\n", name, ref, state)
+			}
+		}
+		return nil
+	},
+}
+
+var reposSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Fetch every repository in parallel",
+	Long: `Fetch all remotes of every registered repository, running up to --jobs
+fetches at once.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		registry, err := repoRegistry(cmd)
+		if err != nil {
+			return err
+		}
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		return registry.Sync(commandContext(cmd), jobs)
+	},
+}
+
+// repoRegistry returns the registry at the default location, wired to the
+// command's output.
+func repoRegistry(cmd *cobra.Command) (*wtm.Registry, error) {
+	path, err := wtm.DefaultRegistryPath()
+	if err != nil {
+		return nil, err
+	}
+	return &wtm.Registry{Path: path, Stdout: cmd.OutOrStdout()}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(reposCmd)
+	reposCmd.AddCommand(reposAddCmd)
+	reposCmd.AddCommand(reposRemoveCmd)
+	reposCmd.AddCommand(reposListCmd)
+	reposCmd.AddCommand(reposStatusCmd)
+	reposCmd.AddCommand(reposSyncCmd)
+	reposSyncCmd.Flags().IntP("jobs", "j", wtm.DefaultSyncJobs, "Number of repositories fetched at once")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestReposCmd(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	tempDir := t.TempDir()
+	remoteRepo := filepath.Join(tempDir, "remote.git")
+	tempClone := filepath.Join(tempDir, "temp-clone")
+	for _, args := range [][]string{
+		{"init", "--bare", remoteRepo},
+		{"clone", remoteRepo, tempClone},
+		{"-C", tempClone, "checkout", "-b", "main"},
+		{"-C", tempClone, "commit", "--allow-empty", "-m", "Initial commit"},
+		{"-C", tempClone, "push", "origin", "main"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	cloneDir := filepath.Join(tempDir, "project")
+	if err := cloneCmd.RunE(cloneCmd, []string{remoteRepo, cloneDir}); err != nil {
+		t.Fatalf("cloneCmd failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	for _, c := range []*cobra.Command{reposListCmd, reposStatusCmd, reposSyncCmd, reposRemoveCmd} {
+		c.SetOut(&out)
+		defer c.SetOut(nil)
+	}
+
+	if err := reposListCmd.RunE(reposListCmd, nil); err != nil {
+		t.Fatalf("repos list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), cloneDir) {
+		t.Errorf("Expected clone to be registered, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := reposStatusCmd.RunE(reposStatusCmd, nil); err != nil {
+		t.Fatalf("repos status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "workspace") || !strings.Contains(out.String(), "clean") {
+		t.Errorf("Expected clean workspace, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := reposSyncCmd.RunE(reposSyncCmd, nil); err != nil {
+		t.Fatalf("repos sync failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Fetched "+cloneDir) {
+		t.Errorf("Expected fetch report, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := reposRemoveCmd.RunE(reposRemoveCmd, []string{cloneDir}); err != nil {
+		t.Fatalf("repos remove failed: %v", err)
+	}
+	out.Reset()
+	if err := reposListCmd.RunE(reposListCmd, nil); err != nil {
+		t.Fatalf("repos list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "No repositories registered") {
+		t.Errorf("Expected empty registry, got %q", out.String())
+	}
+}
@@ -2,215 +2,160 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
-	"github.com/spf13/cobra"
-)
+	"wtm/pkg/wtm"
 
-var (
-	restoreLink  bool
-	restoreTo    string
-	restoreForce bool
-	restoreAll   bool
+	"github.com/spf13/cobra"
 )
 
 // restoreCmd represents the restore command
 var restoreCmd = &cobra.Command{
-	Use:   "restore <file|dir>",
+	Use:   "restore <file|dir|pattern>",
 	Short: "Restore persisted files to the current worktree",
 	Long: `Copy or link a persisted file/directory from shared storage to the current worktree.
-By default, files are copied. Use --link to create a symlink instead.
+Each entry is restored in the mode recorded for it, or copied. --mode picks
+another mode and records it for the restored entries:
+
+  copy      independent copy (default)
+  link      a single symlink to shared storage
+  hardlink  real directories with hard linked files; the files share their
+            inode with shared storage, so editing one in place changes it
+            in every worktree restored with hard links
+  reflink   real directories with copy-on-write clones of the files (btrfs,
+            xfs), copied on other file systems
+  link-files
+            real directories with a symlink for each file, like GNU stow;
+            files that tools add stay local to the worktree
+
+--link is a shorthand for --mode link, --link=files for --mode link-files.
+Use 'wtm unrestore' to remove the links again.
 
 The file is restored to its original relative path unless --to is specified.
+--all restores every persisted entry at its exact path. Copied directories are
+merged into existing ones; --force overwrites the files present in both. When
+the worktree or the bare repository root has a .wtmpersist file (see 'wtm
+persist sync'), --all only restores the entries it declares, in the modes it
+declares.
+
+Entries persisted with 'wtm persist add --branch' in the layer of the branch
+checked out in the worktree take precedence: an entry of the layer replaces
+the common entry at the same path, and is restored over the common directory
+containing it.
+
+A pattern restores every matching entry of shared/. Patterns may use *, ? and
+[...] within a path segment, and ** for any number of directories. --exclude
+leaves out the entries matching another pattern.
 
 Examples:
   wtm restore .env                    # Copy .env to current worktree
   wtm restore node_modules --link     # Symlink node_modules (saves space)
+  wtm restore node_modules --mode reflink
+  wtm restore config --link=files     # Link each file of config/
   wtm restore config.json --to custom/path/config.json
   wtm restore .env --force            # Overwrite if exists
-  wtm restore --all                   # Restore all persisted files`,
+  wtm restore --all                   # Restore all persisted files
+  wtm restore 'config/*.local.yml'    # Restore matching files
+  wtm restore --all --exclude node_modules`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		link, _ := cmd.Flags().GetString("link")
+		mode, _ := cmd.Flags().GetString("mode")
+		to, _ := cmd.Flags().GetString("to")
+		force, _ := cmd.Flags().GetBool("force")
+		exclude, _ := cmd.Flags().GetStringSlice("exclude")
+
 		// Validate arguments
-		if restoreAll && len(args) > 0 {
+		if all && len(args) > 0 {
 			return fmt.Errorf("cannot specify file with --all flag")
 		}
-		if !restoreAll && len(args) == 0 {
+		if !all && len(args) == 0 {
 			return fmt.Errorf("must specify a file/directory or use --all flag")
 		}
 
-		bareRepoRoot, worktreeRoot, err := findRepoRoots()
+		opts := wtm.RestoreOptions{
+			All:     all,
+			Exclude: exclude,
+			To:      to,
+			Mode:    wtm.RestoreMode(mode),
+			Force:   force,
+		}
+		switch link {
+		case "", "false":
+		case "dir", "true":
+			opts.Link = true
+		case "files":
+			if opts.Mode != "" {
+				return fmt.Errorf("cannot use --link=files with --mode")
+			}
+			opts.Mode = wtm.RestoreLinkFiles
+		default:
+			return fmt.Errorf("invalid --link %q: expected dir or files", link)
+		}
+
+		repo, loc, err := discoverRepository(cmd)
 		if err != nil {
 			return err
 		}
 
-		sharedDir := filepath.Join(bareRepoRoot, "shared")
-
-		// Check if shared directory exists
-		if _, err := os.Stat(sharedDir); os.IsNotExist(err) {
-			return fmt.Errorf("no persisted files found. Use 'wtm persist add <file>' to persist files first")
+		if opts.Worktree, err = repo.TargetWorktree(loc); err != nil {
+			return err
 		}
-
-		if restoreAll {
-			return restoreAllFiles(sharedDir, worktreeRoot)
+		if len(args) > 0 {
+			opts.Path = args[0]
 		}
-
-		targetPath := args[0]
-		return restoreFile(targetPath, sharedDir, worktreeRoot)
+		return repo.Restore(commandContext(cmd), opts)
 	},
 }
 
-func restoreFile(targetPath, sharedDir, worktreeRoot string) error {
-	sourcePath := filepath.Join(sharedDir, targetPath)
-
-	// Check if file exists in shared
-	sourceInfo, err := os.Stat(sourcePath)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("file not found in shared storage: %s\nUse 'wtm persist list' to see available files", targetPath)
-	}
-	if err != nil {
-		return fmt.Errorf("error accessing shared file: %w", err)
-	}
-
-	// Determine destination path
-	var destPath string
-	if restoreTo != "" {
-		destPath = restoreTo
-		if !filepath.IsAbs(destPath) {
-			destPath = filepath.Join(worktreeRoot, destPath)
-		}
-	} else {
-		// Restore to same relative path
-		destPath = filepath.Join(worktreeRoot, targetPath)
-	}
-
-	// Check if destination exists
-	if _, err := os.Stat(destPath); err == nil && !restoreForce {
-		return fmt.Errorf("file already exists: %s\nUse --force to overwrite", destPath)
-	}
-
-	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-		return fmt.Errorf("error creating parent directories: %w", err)
-	}
-
-	action := "Copying"
-	if restoreLink {
-		action = "Linking"
-	}
-
-	relDestPath, _ := filepath.Rel(worktreeRoot, destPath)
-	fmt.Printf("%s shared/%s to %s...\n", action, targetPath, relDestPath)
-
-	if restoreLink {
-		// Remove existing file if --force
-		if restoreForce {
-			os.RemoveAll(destPath)
-		}
-
-		// Create symlink (use relative path for portability)
-		relLink, err := filepath.Rel(filepath.Dir(destPath), sourcePath)
-		if err != nil {
-			return fmt.Errorf("error calculating relative link path: %w", err)
-		}
+var unrestoreCmd = &cobra.Command{
+	Use:   "unrestore <file|dir|pattern>",
+	Short: "Remove the symlinks restore created in the current worktree",
+	Long: `Remove the symlinks into shared storage that 'wtm restore' created for a
+persisted entry, whether it was linked as a whole (--link) or file by file
+(--link=files), together with the directories left empty. Local files,
+including copies of persisted files and files that tools added next to the
+links, are left alone.
 
-		if err := os.Symlink(relLink, destPath); err != nil {
-			return fmt.Errorf("error creating symlink: %w", err)
-		}
-	} else {
-		// Remove existing file if --force
-		if restoreForce {
-			os.RemoveAll(destPath)
-		}
-
-		// Copy file or directory
-		if sourceInfo.IsDir() {
-			if err := copyDir(sourcePath, destPath); err != nil {
-				return fmt.Errorf("error copying directory: %w", err)
-			}
-		} else {
-			if err := copyFile(sourcePath, destPath); err != nil {
-				return fmt.Errorf("error copying file: %w", err)
-			}
+Examples:
+  wtm unrestore config
+  wtm unrestore --all`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) > 0) {
+			return fmt.Errorf("must specify a file/directory or use --all flag")
 		}
-	}
-
-	fmt.Printf("Successfully restored to %s\n", relDestPath)
-	return nil
-}
 
-func restoreAllFiles(sharedDir, worktreeRoot string) error {
-	fmt.Println("Restoring all persisted files...")
-
-	count := 0
-	errors := []string{}
-
-	// Walk through shared directory
-	err := filepath.Walk(sharedDir, func(path string, info os.FileInfo, err error) error {
+		repo, loc, err := discoverRepository(cmd)
 		if err != nil {
 			return err
 		}
 
-		// Skip the shared directory itself
-		if path == sharedDir {
-			return nil
-		}
-
-		// Get relative path from shared directory
-		relPath, err := filepath.Rel(sharedDir, path)
+		worktreeRoot, err := repo.TargetWorktree(loc)
 		if err != nil {
 			return err
 		}
 
-		// Only process top-level entries (files and direct subdirectories)
-		// This prevents processing nested items twice
-		if filepath.Dir(relPath) != "." {
-			// Skip nested entries; they'll be handled by their parent directory copy
-			return nil
-		}
-
-		// Try to restore this file/directory
-		fmt.Printf("\nRestoring %s...\n", relPath)
-		if err := restoreFile(relPath, sharedDir, worktreeRoot); err != nil {
-			errMsg := fmt.Sprintf("  ❌ %s: %v", relPath, err)
-			fmt.Println(errMsg)
-			errors = append(errors, errMsg)
-		} else {
-			fmt.Printf("  ✓ %s\n", relPath)
-			count++
-		}
-
-		// If it's a directory, skip walking into it
-		if info.IsDir() {
-			return filepath.SkipDir
+		opts := wtm.UnrestoreOptions{Worktree: worktreeRoot, All: all}
+		if len(args) > 0 {
+			opts.Path = args[0]
 		}
-
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("error walking shared directory: %w", err)
-	}
-
-	fmt.Printf("\nRestored %d file(s)\n", count)
-
-	if len(errors) > 0 {
-		fmt.Printf("\nErrors encountered:\n")
-		for _, errMsg := range errors {
-			fmt.Println(errMsg)
-		}
-		return fmt.Errorf("some files failed to restore")
-	}
-
-	return nil
+		return repo.Unrestore(commandContext(cmd), opts)
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(unrestoreCmd)
+
+	restoreCmd.Flags().String("link", "", "Create a symlink instead of copying, or one symlink per file with --link=files")
+	restoreCmd.Flags().Lookup("link").NoOptDefVal = "dir"
+	restoreCmd.Flags().String("mode", "", "Restore mode: copy, link, hardlink, reflink or link-files (default: the mode recorded for each entry)")
+	restoreCmd.Flags().String("to", "", "Restore to a different path")
+	restoreCmd.Flags().Bool("force", false, "Overwrite if file exists")
+	restoreCmd.Flags().Bool("all", false, "Restore all persisted files")
+	restoreCmd.Flags().StringSlice("exclude", nil, "Leave out the entries matching these patterns")
 
-	restoreCmd.Flags().BoolVar(&restoreLink, "link", false, "Create symlink instead of copying")
-	restoreCmd.Flags().StringVar(&restoreTo, "to", "", "Restore to a different path")
-	restoreCmd.Flags().BoolVar(&restoreForce, "force", false, "Overwrite if file exists")
-	restoreCmd.Flags().BoolVar(&restoreAll, "all", false, "Restore all persisted files")
+	unrestoreCmd.Flags().Bool("all", false, "Remove the links of all persisted entries")
 }
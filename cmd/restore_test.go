@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/spf13/pflag"
 )
 
 func TestRestoreFile(t *testing.T) {
@@ -68,11 +70,7 @@ func TestRestoreFile(t *testing.T) {
 	}
 
 	t.Run("restore file by copying", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		// Create shared file
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -111,11 +109,7 @@ func TestRestoreFile(t *testing.T) {
 	})
 
 	t.Run("restore file with symlink", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		// Create shared file
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -163,11 +157,46 @@ func TestRestoreFile(t *testing.T) {
 		}
 	})
 
+	t.Run("restore directory with a symlink per file", func(t *testing.T) {
+		resetRestoreFlags()
+
+		sharedDir := filepath.Join(bareRepoDir, "shared", "stow")
+		os.MkdirAll(filepath.Join(sharedDir, "nested"), 0755)
+		os.WriteFile(filepath.Join(sharedDir, "nested", "file.txt"), []byte("content"), 0644)
+
+		originalDir, _ := os.Getwd()
+		defer os.Chdir(originalDir)
+		os.Chdir(worktreeDir)
+
+		rootCmd.SetArgs([]string{"restore", "stow", "--link=files"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to restore with --link=files: %v", err)
+		}
+
+		dirInfo, err := os.Lstat(filepath.Join(worktreeDir, "stow", "nested"))
+		if err != nil || !dirInfo.IsDir() {
+			t.Fatalf("Expected a real directory, got %v, %v", dirInfo, err)
+		}
+		if _, err := os.Readlink(filepath.Join(worktreeDir, "stow", "nested", "file.txt")); err != nil {
+			t.Errorf("Expected the file to be linked: %v", err)
+		}
+
+		rootCmd.SetArgs([]string{"unrestore", "stow"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to unrestore: %v", err)
+		}
+		if _, err := os.Lstat(filepath.Join(worktreeDir, "stow")); !os.IsNotExist(err) {
+			t.Errorf("Expected the links and their directories to be removed, got %v", err)
+		}
+
+		rootCmd.SetArgs([]string{"restore", "stow", "--link=everything"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "expected dir or files") {
+			t.Errorf("Expected an invalid --link error, got: %v", err)
+		}
+	})
+
 	t.Run("restore file to custom path", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
+		resetRestoreFlags()
 
 		// Create shared file
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -199,10 +228,7 @@ func TestRestoreFile(t *testing.T) {
 	})
 
 	t.Run("restore with force flag overwrites existing", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
+		resetRestoreFlags()
 
 		// Create shared file
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -232,10 +258,7 @@ func TestRestoreFile(t *testing.T) {
 	})
 
 	t.Run("restore directory recursively", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
+		resetRestoreFlags()
 
 		// Create shared directory with files
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -267,10 +290,7 @@ func TestRestoreFile(t *testing.T) {
 	})
 
 	t.Run("error when file not in shared", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
+		resetRestoreFlags()
 
 		originalDir, _ := os.Getwd()
 		defer os.Chdir(originalDir)
@@ -287,10 +307,7 @@ func TestRestoreFile(t *testing.T) {
 	})
 
 	t.Run("error when file exists without force", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
+		resetRestoreFlags()
 
 		// Create shared file
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -373,11 +390,7 @@ func TestRestoreAll(t *testing.T) {
 	}
 
 	t.Run("restore all files by copying", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		// Create multiple shared files
 		sharedDir := filepath.Join(bareRepoDir, "shared")
@@ -409,11 +422,7 @@ func TestRestoreAll(t *testing.T) {
 	})
 
 	t.Run("restore all with symlinks", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		// Clean worktree
 		os.RemoveAll(filepath.Join(worktreeDir, ".env"))
@@ -445,11 +454,7 @@ func TestRestoreAll(t *testing.T) {
 	})
 
 	t.Run("error when no shared directory", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		// Create new bare repo without shared directory
 		newBareRepo := t.TempDir()
@@ -518,11 +523,7 @@ func TestRestoreAll(t *testing.T) {
 	})
 
 	t.Run("error when specifying file with --all", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		originalDir, _ := os.Getwd()
 		defer os.Chdir(originalDir)
@@ -539,11 +540,7 @@ func TestRestoreAll(t *testing.T) {
 	})
 
 	t.Run("error when no file specified and no --all", func(t *testing.T) {
-		// Reset flags
-		restoreTo = ""
-		restoreLink = false
-		restoreForce = false
-		restoreAll = false
+		resetRestoreFlags()
 
 		originalDir, _ := os.Getwd()
 		defer os.Chdir(originalDir)
@@ -640,11 +637,7 @@ func TestRestoreIntegration(t *testing.T) {
 	// Restore in worktree2
 	os.Chdir(worktree2)
 
-	// Reset flags
-	restoreTo = ""
-	restoreLink = false
-	restoreForce = false
-	restoreAll = false
+	resetRestoreFlags()
 
 	rootCmd.SetArgs([]string{"restore", "shared.txt"})
 	if err := rootCmd.Execute(); err != nil {
@@ -661,3 +654,16 @@ func TestRestoreIntegration(t *testing.T) {
 		t.Errorf("Content mismatch in worktree2: got %q, want %q", string(restoredContent), sharedContent)
 	}
 }
+
+// resetRestoreFlags puts the flags of restore back to their defaults, since
+// they keep their values between executions of rootCmd.
+func resetRestoreFlags() {
+	restoreCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	})
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"wtm/pkg/wtm"
+
+	"github.com/spf13/cobra"
+)
+
+// reviewCmd represents the review command
+var reviewCmd = &cobra.Command{
+	Use:   "review <ref>",
+	Short: "Create a read-only review worktree in tree/review-<ref>",
+	Long: `Create a worktree for reviewing a branch, commit or remote branch without
+risking commits to it. The worktree is detached, locked with 'git worktree lock'
+and guarded by a pre-commit hook that blocks commits in it.
+
+Review worktrees expire after 7 days by default. Once expired, 'wtm prune'
+removes them if they have no uncommitted changes.
+
+Example:
+  wtm review feature/login             # Creates tree/review-feature-login
+  wtm review alice:fix-typo            # Reviews a branch of alice's fork
+  wtm review upstream/main --expires 2d`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expiresFlag, _ := cmd.Flags().GetString("expires")
+		expires, err := wtm.ParseExpiry(expiresFlag)
+		if err != nil {
+			return err
+		}
+
+		repo, _, err := discoverRepository(cmd)
+		if err != nil {
+			return err
+		}
+
+		restore, _ := cmd.Flags().GetBool("restore")
+		_, err = repo.Review(commandContext(cmd), wtm.ReviewOptions{
+			Ref:     args[0],
+			Expires: expires,
+			Restore: restore,
+		})
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reviewCmd)
+	reviewCmd.Flags().String("expires", "7d", "How long to keep the review worktree, e.g. 7d, 12h or never")
+	reviewCmd.Flags().Bool("restore", false, "Restore all persisted files after checkout")
+}
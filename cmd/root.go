@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+
+	"wtm/pkg/wtm"
 
 	"github.com/spf13/cobra"
 )
 
+// repoPath is the value of the global -C flag
+var repoPath string
+
 var rootCmd = &cobra.Command{
 	Use:   "wtm",
 	Short: "Worktree Manager - A CLI for managing git worktrees",
@@ -15,18 +23,62 @@ to quickly create a Cobra application.`,
 }
 
 func Execute() {
-	err := rootCmd.Execute()
+	// The first Ctrl-C cancels the command's context so that it can clean
+	// up, for example partially copied files; a second one exits at once.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// commandContext returns the context of cmd, falling back to the background
+// context when the command is invoked directly rather than through Execute.
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// discoverRepository finds the repository the command operates on, starting
+// from the -C flag, then $WTM_ROOT, then the current directory. The
+// repository output is wired to the command's output streams.
+func discoverRepository(cmd *cobra.Command) (*wtm.Repository, wtm.Location, error) {
+	start := repoPath
+	if start == "" {
+		start = os.Getenv(wtm.RootEnv)
+	}
+	if start == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, wtm.Location{}, fmt.Errorf("error getting current directory: %w", err)
+		}
+		start = cwd
+	}
+
+	repo, loc, err := wtm.Discover(start)
+	if err != nil {
+		return nil, wtm.Location{}, err
+	}
+	repo.Stdout = cmd.OutOrStdout()
+	repo.Stderr = cmd.ErrOrStderr()
+	return repo, loc, nil
+}
+
 func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.wtm.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&repoPath, "repo", "C", "", "Run as if wtm was started in <path> (defaults to $"+wtm.RootEnv+" or the current directory)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wtm/pkg/wtm"
+)
+
+func TestDiscoverRepository(t *testing.T) {
+	// Create a bare repository with an initial commit and a workspace
+	tempDir := t.TempDir()
+	bareRepoPath := filepath.Join(tempDir, "test-bare-repo")
+	if err := exec.Command("git", "init", "--bare", bareRepoPath).Run(); err != nil {
+		t.Fatalf("Failed to init bare repo: %v", err)
+	}
+
+	tempClone := filepath.Join(tempDir, "temp-clone")
+	if err := exec.Command("git", "clone", bareRepoPath, tempClone).Run(); err != nil {
+		t.Fatalf("Failed to clone bare repo: %v", err)
+	}
+	for _, args := range [][]string{
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test User"},
+		{"commit", "--allow-empty", "-m", "Initial commit"},
+		{"push", "origin", "HEAD"},
+	} {
+		gitCmd := exec.Command("git", args...)
+		gitCmd.Dir = tempClone
+		if output, err := gitCmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	workspacePath := filepath.Join(bareRepoPath, "workspace")
+	addWorktreeCmd := exec.Command("git", "worktree", "add", workspacePath, worktreeBranch(t, tempClone))
+	addWorktreeCmd.Dir = bareRepoPath
+	if output, err := addWorktreeCmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to add workspace: %v\n%s", err, output)
+	}
+
+	nestedPath := filepath.Join(workspacePath, "src")
+	if err := os.MkdirAll(nestedPath, 0755); err != nil {
+		t.Fatalf("Failed to create nested directory: %v", err)
+	}
+
+	outsideDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	defer func() { repoPath = "" }()
+
+	t.Run("discovers from nested directory", func(t *testing.T) {
+		repoPath = ""
+		os.Chdir(nestedPath)
+
+		repo, loc, err := discoverRepository(rootCmd)
+		if err != nil {
+			t.Fatalf("discoverRepository failed: %v", err)
+		}
+		if repo.Root != bareRepoPath {
+			t.Errorf("Expected root %q, got %q", bareRepoPath, repo.Root)
+		}
+		if loc.Kind != wtm.LocationWorkspace {
+			t.Errorf("Expected workspace location, got %q", loc.Kind)
+		}
+	})
+
+	t.Run("uses WTM_ROOT", func(t *testing.T) {
+		repoPath = ""
+		os.Chdir(outsideDir)
+		t.Setenv(wtm.RootEnv, bareRepoPath)
+
+		repo, loc, err := discoverRepository(rootCmd)
+		if err != nil {
+			t.Fatalf("discoverRepository failed: %v", err)
+		}
+		if repo.Root != bareRepoPath || loc.Kind != wtm.LocationRoot {
+			t.Errorf("Expected repository root, got %q (%s)", repo.Root, loc.Kind)
+		}
+	})
+
+	t.Run("-C takes precedence over WTM_ROOT", func(t *testing.T) {
+		os.Chdir(outsideDir)
+		t.Setenv(wtm.RootEnv, outsideDir)
+		repoPath = workspacePath
+
+		repo, loc, err := discoverRepository(rootCmd)
+		if err != nil {
+			t.Fatalf("discoverRepository failed: %v", err)
+		}
+		if repo.Root != bareRepoPath || loc.Kind != wtm.LocationWorkspace {
+			t.Errorf("Expected workspace of %q, got %q (%s)", bareRepoPath, repo.Root, loc.Kind)
+		}
+	})
+
+	t.Run("error outside a repository", func(t *testing.T) {
+		repoPath = ""
+		os.Chdir(outsideDir)
+
+		_, _, err := discoverRepository(rootCmd)
+		if err == nil || !strings.Contains(err.Error(), "not in a git repository") {
+			t.Errorf("Expected 'not in a git repository' error, got: %v", err)
+		}
+	})
+
+	t.Run("persist add with -C from anywhere", func(t *testing.T) {
+		repoPath = ""
+		os.Chdir(outsideDir)
+		if err := os.WriteFile(filepath.Join(workspacePath, ".env"), []byte("KEY=value"), 0644); err != nil {
+			t.Fatalf("Failed to write .env: %v", err)
+		}
+
+		rootCmd.SetArgs([]string{"-C", bareRepoPath, "persist", "add", ".env"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("persist add failed: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(bareRepoPath, "shared", ".env")); err != nil {
+			t.Errorf("Expected .env to be persisted from the workspace: %v", err)
+		}
+	})
+
+	t.Run("persist add resolves paths from nested directory", func(t *testing.T) {
+		repoPath = ""
+		os.Chdir(nestedPath)
+		if err := os.WriteFile(filepath.Join(nestedPath, "local.json"), []byte("{}"), 0644); err != nil {
+			t.Fatalf("Failed to write local.json: %v", err)
+		}
+
+		rootCmd.SetArgs([]string{"persist", "add", "local.json"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("persist add failed: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(bareRepoPath, "shared", "src", "local.json")); err != nil {
+			t.Errorf("Expected src/local.json to be persisted: %v", err)
+		}
+	})
+}
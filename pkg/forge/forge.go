@@ -0,0 +1,214 @@
+// Package forge looks up pull requests on code hosting services.
+//
+// A Provider answers which pull request belongs to a branch and what state
+// it is in: open, merged or closed, how far its review got and whether its
+// checks pass. GitHub and GitLab are supported through their REST APIs; the
+// API base URL is configurable so that self-hosted instances and local stub
+// servers work as well.
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Kind identifies a forge implementation.
+type Kind string
+
+const (
+	GitHub Kind = "github"
+	GitLab Kind = "gitlab"
+)
+
+// TokenEnv is the environment variable holding the API token. When it is
+// unset, GITHUB_TOKEN or GITLAB_TOKEN is used depending on the forge.
+const TokenEnv = "WTM_FORGE_TOKEN"
+
+// State is the state of a pull request.
+type State string
+
+const (
+	StateOpen   State = "open"
+	StateMerged State = "merged"
+	StateClosed State = "closed"
+)
+
+// ReviewState summarizes the reviews of a pull request.
+type ReviewState string
+
+const (
+	ReviewPending          ReviewState = "pending"
+	ReviewApproved         ReviewState = "approved"
+	ReviewChangesRequested ReviewState = "changes_requested"
+)
+
+// ChecksState summarizes the CI checks of a pull request's head commit.
+type ChecksState string
+
+const (
+	ChecksNone    ChecksState = ""
+	ChecksPending ChecksState = "pending"
+	ChecksSuccess ChecksState = "success"
+	ChecksFailure ChecksState = "failure"
+)
+
+// PullRequest is a pull request, or merge request, and its status.
+type PullRequest struct {
+	Number int
+	Title  string
+	URL    string
+	Branch string
+	State  State
+	Review ReviewState
+	Checks ChecksState
+
+	// HeadSHA is the commit the head branch pointed to when the pull request
+	// was last updated, or merged.
+	HeadSHA string
+}
+
+// Provider looks up pull requests on a forge.
+type Provider interface {
+	// PullRequest returns pull request number.
+	PullRequest(ctx context.Context, number int) (*PullRequest, error)
+
+	// PullRequestForBranch returns the most recent pull request whose head
+	// is branch, or nil when there is none. Owner is the owner of the
+	// repository holding branch, such as a fork of the project; the owner
+	// of the project itself when empty.
+	PullRequestForBranch(ctx context.Context, owner, branch string) (*PullRequest, error)
+}
+
+// Config configures a Provider.
+type Config struct {
+	Kind Kind
+
+	// BaseURL is the REST API root, such as https://api.github.com. It
+	// defaults to the public API of the forge on Host.
+	BaseURL string
+
+	// Host is the forge host name, used to derive BaseURL.
+	Host string
+
+	// Project is the repository path on the forge, such as owner/repo.
+	Project string
+
+	// Token authenticates API requests. Requests are anonymous when empty.
+	Token string
+
+	// Client sends the requests. http.DefaultClient is used when nil.
+	Client *http.Client
+}
+
+// New returns the provider described by cfg.
+func New(cfg Config) (Provider, error) {
+	if cfg.Project == "" {
+		return nil, fmt.Errorf("forge project is not set")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	switch cfg.Kind {
+	case GitHub:
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = "https://api.github.com"
+			if cfg.Host != "" && cfg.Host != "github.com" {
+				cfg.BaseURL = "https://" + cfg.Host + "/api/v3"
+			}
+		}
+		return &gitHub{cfg: cfg}, nil
+	case GitLab:
+		if cfg.BaseURL == "" {
+			host := cfg.Host
+			if host == "" {
+				host = "gitlab.com"
+			}
+			cfg.BaseURL = "https://" + host + "/api/v4"
+		}
+		return &gitLab{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown forge %q (expected %q or %q)", cfg.Kind, GitHub, GitLab)
+	}
+}
+
+// ParseRemoteURL splits a git remote URL into the forge host and the
+// project path, without a .git suffix. Both scheme URLs and scp-like URLs
+// such as git@github.com:owner/repo.git are understood.
+func ParseRemoteURL(url string) (host, project string, err error) {
+	rest := url
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+		host, project, _ = strings.Cut(rest, "/")
+	} else if h, p, ok := strings.Cut(rest, ":"); ok && !strings.HasPrefix(rest, "/") {
+		host, project = h, p
+	}
+
+	// Drop credentials and ports
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	host, _, _ = strings.Cut(host, ":")
+
+	project = strings.TrimSuffix(strings.Trim(project, "/"), ".git")
+	if host == "" || !strings.Contains(project, "/") {
+		return "", "", fmt.Errorf("cannot determine the forge project of %s", url)
+	}
+	return host, project, nil
+}
+
+// DetectKind guesses the forge from its host name. It returns an empty Kind
+// when the host is not recognized.
+func DetectKind(host string) Kind {
+	switch {
+	case strings.Contains(host, "github"):
+		return GitHub
+	case strings.Contains(host, "gitlab"):
+		return GitLab
+	default:
+		return ""
+	}
+}
+
+// TokenFromEnv returns the API token for kind from the environment.
+func TokenFromEnv(kind Kind) string {
+	if token := os.Getenv(TokenEnv); token != "" {
+		return token
+	}
+	switch kind {
+	case GitHub:
+		return os.Getenv("GITHUB_TOKEN")
+	case GitLab:
+		return os.Getenv("GITLAB_TOKEN")
+	}
+	return ""
+}
+
+// getJSON fetches url and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, url string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: error decoding response: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitHub implements Provider with the GitHub REST API.
+type gitHub struct {
+	cfg Config
+}
+
+type gitHubPull struct {
+	Number   int     `json:"number"`
+	Title    string  `json:"title"`
+	HTMLURL  string  `json:"html_url"`
+	State    string  `json:"state"`
+	MergedAt *string `json:"merged_at"`
+	Head     struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+func (g *gitHub) PullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	var pull gitHubPull
+	if err := g.get(ctx, fmt.Sprintf("/repos/%s/pulls/%d", g.cfg.Project, number), &pull); err != nil {
+		return nil, err
+	}
+	return g.status(ctx, pull)
+}
+
+func (g *gitHub) PullRequestForBranch(ctx context.Context, owner, branch string) (*PullRequest, error) {
+	if owner == "" {
+		owner, _, _ = strings.Cut(g.cfg.Project, "/")
+	}
+	query := url.Values{"head": {owner + ":" + branch}, "state": {"all"}, "sort": {"created"}, "direction": {"desc"}}
+
+	var pulls []gitHubPull
+	if err := g.get(ctx, "/repos/"+g.cfg.Project+"/pulls?"+query.Encode(), &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return g.status(ctx, pulls[0])
+}
+
+// status completes pull with its review and checks state.
+func (g *gitHub) status(ctx context.Context, pull gitHubPull) (*PullRequest, error) {
+	pr := &PullRequest{
+		Number:  pull.Number,
+		Title:   pull.Title,
+		URL:     pull.HTMLURL,
+		Branch:  pull.Head.Ref,
+		State:   StateOpen,
+		HeadSHA: pull.Head.SHA,
+	}
+	switch {
+	case pull.MergedAt != nil:
+		pr.State = StateMerged
+	case pull.State == "closed":
+		pr.State = StateClosed
+	}
+
+	var reviews []struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		State string `json:"state"`
+	}
+	if err := g.get(ctx, fmt.Sprintf("/repos/%s/pulls/%d/reviews", g.cfg.Project, pull.Number), &reviews); err != nil {
+		return nil, err
+	}
+
+	// Only the latest approving or blocking review of each reviewer counts
+	latest := map[string]string{}
+	for _, review := range reviews {
+		if review.State == "APPROVED" || review.State == "CHANGES_REQUESTED" || review.State == "DISMISSED" {
+			latest[review.User.Login] = review.State
+		}
+	}
+	pr.Review = ReviewPending
+	for _, state := range latest {
+		if state == "CHANGES_REQUESTED" {
+			pr.Review = ReviewChangesRequested
+			break
+		}
+		if state == "APPROVED" {
+			pr.Review = ReviewApproved
+		}
+	}
+
+	checks, err := g.checks(ctx, pull.Head.SHA)
+	if err != nil {
+		return nil, err
+	}
+	pr.Checks = checks
+	return pr, nil
+}
+
+// checks combines the commit statuses and check runs of sha.
+func (g *gitHub) checks(ctx context.Context, sha string) (ChecksState, error) {
+	var status struct {
+		State      string `json:"state"`
+		TotalCount int    `json:"total_count"`
+	}
+	if err := g.get(ctx, "/repos/"+g.cfg.Project+"/commits/"+sha+"/status", &status); err != nil {
+		return ChecksNone, err
+	}
+
+	var runs struct {
+		CheckRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	if err := g.get(ctx, "/repos/"+g.cfg.Project+"/commits/"+sha+"/check-runs", &runs); err != nil {
+		return ChecksNone, err
+	}
+
+	var states []ChecksState
+	if status.TotalCount > 0 {
+		switch status.State {
+		case "success":
+			states = append(states, ChecksSuccess)
+		case "pending":
+			states = append(states, ChecksPending)
+		default:
+			states = append(states, ChecksFailure)
+		}
+	}
+	for _, run := range runs.CheckRuns {
+		switch {
+		case run.Status != "completed":
+			states = append(states, ChecksPending)
+		case run.Conclusion == "success" || run.Conclusion == "neutral" || run.Conclusion == "skipped":
+			states = append(states, ChecksSuccess)
+		default:
+			states = append(states, ChecksFailure)
+		}
+	}
+	return combineChecks(states), nil
+}
+
+func (g *gitHub) get(ctx context.Context, path string, v any) error {
+	header := http.Header{"Accept": {"application/vnd.github+json"}}
+	if g.cfg.Token != "" {
+		header.Set("Authorization", "Bearer "+g.cfg.Token)
+	}
+	return getJSON(ctx, g.cfg.Client, strings.TrimSuffix(g.cfg.BaseURL, "/")+path, header, v)
+}
+
+// combineChecks reduces individual check results to a single state: any
+// failure fails, otherwise anything pending is pending.
+func combineChecks(states []ChecksState) ChecksState {
+	combined := ChecksNone
+	for _, state := range states {
+		switch {
+		case state == ChecksFailure:
+			return ChecksFailure
+		case state == ChecksPending:
+			combined = ChecksPending
+		case combined == ChecksNone:
+			combined = ChecksSuccess
+		}
+	}
+	return combined
+}
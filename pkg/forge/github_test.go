@@ -0,0 +1,67 @@
+package forge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGitHub(t *testing.T) {
+	ctx := context.Background()
+	server, header := newStub(t, map[string]any{
+		"/repos/org/repo/pulls?direction=desc&head=org%3Afeature&sort=created&state=all": []map[string]any{
+			{"number": 12, "title": "Add feature", "html_url": "https://github.com/org/repo/pull/12", "state": "closed", "merged_at": "2024-01-01T00:00:00Z", "head": map[string]any{"ref": "feature", "sha": "abc"}},
+		},
+		"/repos/org/repo/pulls?direction=desc&head=org%3Anone&sort=created&state=all": []map[string]any{},
+		"/repos/org/repo/pulls?direction=desc&head=alice%3Afix&sort=created&state=all": []map[string]any{
+			{"number": 13, "state": "open", "head": map[string]any{"ref": "fix", "sha": "def"}},
+		},
+		"/repos/org/repo/pulls/12/reviews": []map[string]any{
+			{"user": map[string]any{"login": "bob"}, "state": "CHANGES_REQUESTED"},
+			{"user": map[string]any{"login": "bob"}, "state": "APPROVED"},
+			{"user": map[string]any{"login": "eve"}, "state": "COMMENTED"},
+		},
+		"/repos/org/repo/commits/abc/status":     map[string]any{"state": "success", "total_count": 1},
+		"/repos/org/repo/commits/abc/check-runs": map[string]any{"check_runs": []map[string]any{{"status": "completed", "conclusion": "failure"}}},
+		"/repos/org/repo/pulls/13":               map[string]any{"number": 13, "state": "open", "head": map[string]any{"ref": "wip", "sha": "def"}},
+		"/repos/org/repo/pulls/13/reviews":       []map[string]any{},
+		"/repos/org/repo/commits/def/status":     map[string]any{"state": "pending", "total_count": 0},
+		"/repos/org/repo/commits/def/check-runs": map[string]any{"check_runs": []map[string]any{{"status": "in_progress"}}},
+	})
+
+	provider, err := New(Config{Kind: GitHub, BaseURL: server.URL, Project: "org/repo", Token: "secret"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	pr, err := provider.PullRequestForBranch(ctx, "", "feature")
+	if err != nil {
+		t.Fatalf("PullRequestForBranch failed: %v", err)
+	}
+	expected := PullRequest{Number: 12, Title: "Add feature", URL: "https://github.com/org/repo/pull/12", Branch: "feature", State: StateMerged, Review: ReviewApproved, Checks: ChecksFailure, HeadSHA: "abc"}
+	if pr == nil || *pr != expected {
+		t.Errorf("Expected %+v, got %+v", expected, pr)
+	}
+	if auth := header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Expected bearer token, got %q", auth)
+	}
+
+	pr, err = provider.PullRequest(ctx, 13)
+	if err != nil {
+		t.Fatalf("PullRequest failed: %v", err)
+	}
+	if pr.State != StateOpen || pr.Review != ReviewPending || pr.Checks != ChecksPending {
+		t.Errorf("Unexpected status %+v", pr)
+	}
+
+	if pr, err := provider.PullRequestForBranch(ctx, "alice", "fix"); err != nil || pr == nil || pr.Number != 13 {
+		t.Errorf("Expected the pull request from the fork of alice, got %+v, %v", pr, err)
+	}
+
+	if pr, err := provider.PullRequestForBranch(ctx, "", "none"); err != nil || pr != nil {
+		t.Errorf("Expected no pull request, got %+v, %v", pr, err)
+	}
+
+	if _, err := provider.PullRequest(ctx, 99); err == nil {
+		t.Error("Expected error for unknown pull request")
+	}
+}
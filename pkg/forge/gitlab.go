@@ -0,0 +1,104 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitLab implements Provider with the GitLab REST API.
+type gitLab struct {
+	cfg Config
+}
+
+type gitLabMergeRequest struct {
+	IID          int    `json:"iid"`
+	Title        string `json:"title"`
+	WebURL       string `json:"web_url"`
+	State        string `json:"state"`
+	SourceBranch string `json:"source_branch"`
+	SHA          string `json:"sha"`
+	HeadPipeline *struct {
+		Status string `json:"status"`
+	} `json:"head_pipeline"`
+}
+
+func (g *gitLab) PullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	var mr gitLabMergeRequest
+	if err := g.get(ctx, fmt.Sprintf("/merge_requests/%d", number), &mr); err != nil {
+		return nil, err
+	}
+	return g.status(ctx, mr)
+}
+
+// PullRequestForBranch ignores owner: the merge requests of a project list
+// their source branch by name only, whichever fork it is in.
+func (g *gitLab) PullRequestForBranch(ctx context.Context, owner, branch string) (*PullRequest, error) {
+	query := url.Values{"source_branch": {branch}, "state": {"all"}, "order_by": {"created_at"}, "sort": {"desc"}}
+
+	var mrs []gitLabMergeRequest
+	if err := g.get(ctx, "/merge_requests?"+query.Encode(), &mrs); err != nil {
+		return nil, err
+	}
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+
+	// The list endpoint omits the pipeline, so fetch the merge request itself
+	return g.PullRequest(ctx, mrs[0].IID)
+}
+
+// status completes mr with its approval state.
+func (g *gitLab) status(ctx context.Context, mr gitLabMergeRequest) (*PullRequest, error) {
+	pr := &PullRequest{
+		Number:  mr.IID,
+		Title:   mr.Title,
+		URL:     mr.WebURL,
+		Branch:  mr.SourceBranch,
+		State:   StateOpen,
+		HeadSHA: mr.SHA,
+	}
+	switch mr.State {
+	case "merged":
+		pr.State = StateMerged
+	case "closed", "locked":
+		pr.State = StateClosed
+	}
+
+	var approvals struct {
+		Approved bool `json:"approved"`
+	}
+	if err := g.get(ctx, fmt.Sprintf("/merge_requests/%d/approvals", mr.IID), &approvals); err != nil {
+		return nil, err
+	}
+	pr.Review = ReviewPending
+	if approvals.Approved {
+		pr.Review = ReviewApproved
+	}
+
+	if mr.HeadPipeline != nil {
+		switch mr.HeadPipeline.Status {
+		case "success":
+			pr.Checks = ChecksSuccess
+		case "failed", "canceled":
+			pr.Checks = ChecksFailure
+		case "skipped":
+			pr.Checks = ChecksNone
+		default:
+			pr.Checks = ChecksPending
+		}
+	}
+	return pr, nil
+}
+
+// get fetches path relative to the project's API root.
+func (g *gitLab) get(ctx context.Context, path string, v any) error {
+	var header http.Header
+	if g.cfg.Token != "" {
+		header = http.Header{"Private-Token": {g.cfg.Token}}
+	}
+	project := url.PathEscape(g.cfg.Project)
+	return getJSON(ctx, g.cfg.Client, strings.TrimSuffix(g.cfg.BaseURL, "/")+"/projects/"+project+path, header, v)
+}
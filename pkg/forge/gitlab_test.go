@@ -0,0 +1,49 @@
+package forge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGitLab(t *testing.T) {
+	ctx := context.Background()
+	server, header := newStub(t, map[string]any{
+		"/projects/group%2Frepo/merge_requests?order_by=created_at&sort=desc&source_branch=feature&state=all": []map[string]any{
+			{"iid": 5},
+		},
+		"/projects/group%2Frepo/merge_requests/5": map[string]any{
+			"iid": 5, "title": "Add feature", "web_url": "https://gitlab.com/group/repo/-/merge_requests/5",
+			"state": "opened", "source_branch": "feature", "sha": "abc", "head_pipeline": map[string]any{"status": "running"},
+		},
+		"/projects/group%2Frepo/merge_requests/5/approvals": map[string]any{"approved": true},
+		"/projects/group%2Frepo/merge_requests/6": map[string]any{
+			"iid": 6, "state": "merged", "source_branch": "done", "head_pipeline": map[string]any{"status": "failed"},
+		},
+		"/projects/group%2Frepo/merge_requests/6/approvals": map[string]any{"approved": false},
+	})
+
+	provider, err := New(Config{Kind: GitLab, BaseURL: server.URL, Project: "group/repo", Token: "secret"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	pr, err := provider.PullRequestForBranch(ctx, "", "feature")
+	if err != nil {
+		t.Fatalf("PullRequestForBranch failed: %v", err)
+	}
+	expected := PullRequest{Number: 5, Title: "Add feature", URL: "https://gitlab.com/group/repo/-/merge_requests/5", Branch: "feature", State: StateOpen, Review: ReviewApproved, Checks: ChecksPending, HeadSHA: "abc"}
+	if pr == nil || *pr != expected {
+		t.Errorf("Expected %+v, got %+v", expected, pr)
+	}
+	if token := header.Get("Private-Token"); token != "secret" {
+		t.Errorf("Expected private token header, got %q", token)
+	}
+
+	pr, err = provider.PullRequest(ctx, 6)
+	if err != nil {
+		t.Fatalf("PullRequest failed: %v", err)
+	}
+	if pr.State != StateMerged || pr.Review != ReviewPending || pr.Checks != ChecksFailure {
+		t.Errorf("Unexpected status %+v", pr)
+	}
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Exec is a Runner that runs the git executable.
+type Exec struct {
+	// Stdout and Stderr receive the output of commands started with Run.
+	// Output is discarded when nil.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// New returns a Git backed by the git executable, streaming the output of
+// commands started with Run to stdout and stderr.
+func New(stdout, stderr io.Writer) Git {
+	return Commands{Runner: &Exec{Stdout: stdout, Stderr: stderr}}
+}
+
+func (e *Exec) Run(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = e.Stdout
+	cmd.Stderr = e.Stderr
+	if err := cmd.Run(); err != nil {
+		return &Error{Args: args, Err: err}
+	}
+	return nil
+}
+
+func (e *Exec) Output(ctx context.Context, dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return string(output), &Error{Args: args, Err: err, Stderr: strings.TrimSpace(stderr.String())}
+	}
+	return string(output), nil
+}
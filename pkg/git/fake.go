@@ -0,0 +1,82 @@
+package git
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Call is a git command received by Fake.
+type Call struct {
+	Dir  string
+	Args []string
+}
+
+// String returns the arguments of the call joined by spaces.
+func (c Call) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Fake is an in-memory Git that records every command it receives instead
+// of running it. Typed operations are recorded as the git commands they
+// would run, e.g. "worktree move <src> <dst>".
+type Fake struct {
+	Commands
+
+	// Outputs maps the arguments of a command, joined by spaces, to the
+	// output returned for it. Commands without an entry return no output.
+	Outputs map[string]string
+
+	// Errors maps the arguments of a command, joined by spaces, to the error
+	// returned for it.
+	Errors map[string]error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewFake returns a Fake that records commands and returns no output.
+func NewFake() *Fake {
+	f := &Fake{Outputs: map[string]string{}, Errors: map[string]error{}}
+	f.Commands = Commands{Runner: f}
+	return f
+}
+
+func (f *Fake) Run(ctx context.Context, dir string, args ...string) error {
+	_, err := f.Output(ctx, dir, args...)
+	return err
+}
+
+func (f *Fake) Output(ctx context.Context, dir string, args ...string) (string, error) {
+	call := Call{Dir: dir, Args: append([]string(nil), args...)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err, ok := f.Errors[call.String()]; ok {
+		return "", err
+	}
+	return f.Outputs[call.String()], nil
+}
+
+// Calls returns the commands received so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Called reports whether a command with the given arguments was received.
+func (f *Fake) Called(args ...string) bool {
+	want := strings.Join(args, " ")
+	for _, call := range f.Calls() {
+		if call.String() == want {
+			return true
+		}
+	}
+	return false
+}
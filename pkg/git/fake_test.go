@@ -0,0 +1,68 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("records typed operations as commands", func(t *testing.T) {
+		fake := NewFake()
+		fake.Outputs["branch --show-current"] = "feature/x\n"
+
+		branch, err := fake.CurrentBranch(ctx, "/repo/workspace")
+		if err != nil || branch != "feature/x" {
+			t.Errorf("Expected branch feature/x, got %q (%v)", branch, err)
+		}
+		if err := fake.WorktreeMove(ctx, "/repo", "/repo/workspace", "/repo/tree/feature-x"); err != nil {
+			t.Fatalf("WorktreeMove failed: %v", err)
+		}
+		if err := fake.WorktreeRemove(ctx, "/repo", "/repo/tree/old", true); err != nil {
+			t.Fatalf("WorktreeRemove failed: %v", err)
+		}
+
+		calls := fake.Calls()
+		expected := []Call{
+			{Dir: "/repo/workspace", Args: []string{"branch", "--show-current"}},
+			{Dir: "/repo", Args: []string{"worktree", "move", "/repo/workspace", "/repo/tree/feature-x"}},
+			{Dir: "/repo", Args: []string{"worktree", "remove", "--force", "/repo/tree/old"}},
+		}
+		if len(calls) != len(expected) {
+			t.Fatalf("Expected %d calls, got %d: %v", len(expected), len(calls), calls)
+		}
+		for i := range expected {
+			if calls[i].Dir != expected[i].Dir || calls[i].String() != expected[i].String() {
+				t.Errorf("Call %d: expected %v in %s, got %v in %s", i, expected[i], expected[i].Dir, calls[i], calls[i].Dir)
+			}
+		}
+		if !fake.Called("worktree", "move", "/repo/workspace", "/repo/tree/feature-x") {
+			t.Error("Expected Called to report the worktree move")
+		}
+	})
+
+	t.Run("returns configured errors", func(t *testing.T) {
+		fake := NewFake()
+		boom := errors.New("boom")
+		fake.Errors["worktree add /repo/workspace main"] = boom
+
+		if err := fake.WorktreeAdd(ctx, "/repo", "/repo/workspace", "main"); !errors.Is(err, boom) {
+			t.Errorf("Expected configured error, got %v", err)
+		}
+	})
+
+	t.Run("parses configured output", func(t *testing.T) {
+		fake := NewFake()
+		fake.Outputs["worktree list --porcelain"] = "worktree /repo\nbare\n\nworktree /repo/workspace\nHEAD abc\nbranch refs/heads/main\n"
+
+		worktrees, err := fake.WorktreeList(ctx, "/repo")
+		if err != nil {
+			t.Fatalf("WorktreeList failed: %v", err)
+		}
+		if len(worktrees) != 2 || worktrees[1].Branch != "main" {
+			t.Errorf("Unexpected worktrees: %+v", worktrees)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+// Package git defines the git operations wtm relies on.
+//
+// The Git interface can be backed by the git executable (see New) or by any
+// other implementation. Fake records the commands it receives so that code
+// built on top of Git can be tested without real repositories.
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Runner runs raw git commands.
+type Runner interface {
+	// Run runs git with args in dir, streaming its output.
+	Run(ctx context.Context, dir string, args ...string) error
+
+	// Output runs git with args in dir and returns its standard output.
+	Output(ctx context.Context, dir string, args ...string) (string, error)
+}
+
+// Git is the set of git operations used by wtm. An empty dir means the
+// current working directory.
+type Git interface {
+	Runner
+
+	// RevParse runs git rev-parse and returns its trimmed output.
+	RevParse(ctx context.Context, dir string, args ...string) (string, error)
+
+	// WorktreeAdd creates a worktree at path with commitish checked out.
+	WorktreeAdd(ctx context.Context, dir, path, commitish string) error
+
+	// WorktreeMove moves the worktree at src to dst.
+	WorktreeMove(ctx context.Context, dir, src, dst string) error
+
+	// WorktreeRepair repairs the administrative files of the worktree at path.
+	WorktreeRepair(ctx context.Context, dir, path string) error
+
+	// WorktreeRemove removes the worktree at path.
+	WorktreeRemove(ctx context.Context, dir, path string, force bool) error
+
+	// WorktreeList returns the worktrees of the repository, including the
+	// main or bare worktree.
+	WorktreeList(ctx context.Context, dir string) ([]Worktree, error)
+
+	// CurrentBranch returns the branch checked out in dir, or an empty
+	// string when HEAD is detached.
+	CurrentBranch(ctx context.Context, dir string) (string, error)
+
+	// CreateBranch creates branch name pointing at start.
+	CreateBranch(ctx context.Context, dir, name, start string) error
+
+	// Status returns the changed and untracked files of the worktree in dir.
+	Status(ctx context.Context, dir string) ([]StatusEntry, error)
+}
+
+// Worktree is an entry of `git worktree list`.
+type Worktree struct {
+	Path string
+	Head string
+
+	// Branch is the short name of the checked out branch. It is empty when
+	// the worktree is detached.
+	Branch string
+
+	Bare     bool
+	Detached bool
+	Locked   bool
+	Prunable bool
+}
+
+// StatusEntry is a changed or untracked file reported by `git status`.
+type StatusEntry struct {
+	// Code is the two-letter status code, e.g. " M" or "??".
+	Code string
+	Path string
+
+	// OrigPath is the source path of a rename or copy.
+	OrigPath string
+}
+
+// Error is returned when a git command fails.
+type Error struct {
+	Args   []string
+	Err    error
+	Stderr string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("git %s: %v", strings.Join(e.Args, " "), e.Err)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Commands implements Git on top of a Runner by issuing the corresponding
+// git commands.
+type Commands struct {
+	Runner
+}
+
+func (c Commands) RevParse(ctx context.Context, dir string, args ...string) (string, error) {
+	output, err := c.Output(ctx, dir, append([]string{"rev-parse"}, args...)...)
+	return strings.TrimSpace(output), err
+}
+
+func (c Commands) WorktreeAdd(ctx context.Context, dir, path, commitish string) error {
+	return c.Run(ctx, dir, "worktree", "add", path, commitish)
+}
+
+func (c Commands) WorktreeMove(ctx context.Context, dir, src, dst string) error {
+	_, err := c.Output(ctx, dir, "worktree", "move", src, dst)
+	return err
+}
+
+func (c Commands) WorktreeRepair(ctx context.Context, dir, path string) error {
+	_, err := c.Output(ctx, dir, "worktree", "repair", path)
+	return err
+}
+
+func (c Commands) WorktreeRemove(ctx context.Context, dir, path string, force bool) error {
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	_, err := c.Output(ctx, dir, append(args, path)...)
+	return err
+}
+
+func (c Commands) WorktreeList(ctx context.Context, dir string) ([]Worktree, error) {
+	output, err := c.Output(ctx, dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	return ParseWorktreeList(output), nil
+}
+
+func (c Commands) CurrentBranch(ctx context.Context, dir string) (string, error) {
+	output, err := c.Output(ctx, dir, "branch", "--show-current")
+	return strings.TrimSpace(output), err
+}
+
+func (c Commands) CreateBranch(ctx context.Context, dir, name, start string) error {
+	_, err := c.Output(ctx, dir, "branch", name, start)
+	return err
+}
+
+func (c Commands) Status(ctx context.Context, dir string) ([]StatusEntry, error) {
+	output, err := c.Output(ctx, dir, "status", "--porcelain", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return ParseStatus(output), nil
+}
+
+// ParseWorktreeList parses the output of `git worktree list --porcelain`.
+func ParseWorktreeList(output string) []Worktree {
+	var worktrees []Worktree
+	for _, block := range strings.Split(strings.TrimSpace(output), "\n\n") {
+		var wt Worktree
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				wt.Path = value
+			case "HEAD":
+				wt.Head = value
+			case "branch":
+				wt.Branch = strings.TrimPrefix(value, "refs/heads/")
+			case "bare":
+				wt.Bare = true
+			case "detached":
+				wt.Detached = true
+			case "locked":
+				wt.Locked = true
+			case "prunable":
+				wt.Prunable = true
+			}
+		}
+		if wt.Path != "" {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	return worktrees
+}
+
+// ParseStatus parses the output of `git status --porcelain -z`.
+func ParseStatus(output string) []StatusEntry {
+	var entries []StatusEntry
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 4 {
+			continue
+		}
+		entry := StatusEntry{Code: field[:2], Path: field[3:]}
+		// Renames and copies are followed by their source path
+		if (entry.Code[0] == 'R' || entry.Code[0] == 'C') && i+1 < len(fields) {
+			i++
+			entry.OrigPath = fields[i]
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,162 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseWorktreeList(t *testing.T) {
+	output := `worktree /repo
+bare
+
+worktree /repo/workspace
+HEAD 1111111111111111111111111111111111111111
+branch refs/heads/feature/x
+
+worktree /repo/tree/old
+HEAD 2222222222222222222222222222222222222222
+detached
+locked reason
+prunable gitdir file points to non-existent location
+`
+
+	worktrees := ParseWorktreeList(output)
+	if len(worktrees) != 3 {
+		t.Fatalf("Expected 3 worktrees, got %d", len(worktrees))
+	}
+	if !worktrees[0].Bare || worktrees[0].Path != "/repo" {
+		t.Errorf("Unexpected bare entry: %+v", worktrees[0])
+	}
+	if worktrees[1].Branch != "feature/x" || worktrees[1].Head != "1111111111111111111111111111111111111111" {
+		t.Errorf("Unexpected workspace entry: %+v", worktrees[1])
+	}
+	if !worktrees[2].Detached || !worktrees[2].Locked || !worktrees[2].Prunable {
+		t.Errorf("Unexpected detached entry: %+v", worktrees[2])
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	output := " M modified.go\x00?? new file.txt\x00R  renamed.go\x00original.go\x00A  added.go\x00"
+
+	entries := ParseStatus(output)
+	expected := []StatusEntry{
+		{Code: " M", Path: "modified.go"},
+		{Code: "??", Path: "new file.txt"},
+		{Code: "R ", Path: "renamed.go", OrigPath: "original.go"},
+		{Code: "A ", Path: "added.go"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], entries[i])
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	ctx := context.Background()
+	g := New(nil, nil)
+
+	repoDir := t.TempDir()
+	if err := g.Run(ctx, repoDir, "init", "--initial-branch=main"); err != nil {
+		t.Fatalf("git init failed: %v", err)
+	}
+	for _, args := range [][]string{
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test User"},
+	} {
+		if err := g.Run(ctx, repoDir, args...); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# Test\n"), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+
+	t.Run("status reports untracked files", func(t *testing.T) {
+		entries, err := g.Status(ctx, repoDir)
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if len(entries) != 1 || entries[0].Code != "??" || entries[0].Path != "README.md" {
+			t.Errorf("Unexpected status: %+v", entries)
+		}
+	})
+
+	if err := g.Run(ctx, repoDir, "add", "README.md"); err != nil {
+		t.Fatalf("git add failed: %v", err)
+	}
+	if err := g.Run(ctx, repoDir, "commit", "-m", "Initial commit"); err != nil {
+		t.Fatalf("git commit failed: %v", err)
+	}
+
+	t.Run("rev-parse and current branch", func(t *testing.T) {
+		isBare, err := g.RevParse(ctx, repoDir, "--is-bare-repository")
+		if err != nil || isBare != "false" {
+			t.Errorf("Expected non-bare repository, got %q (%v)", isBare, err)
+		}
+
+		branch, err := g.CurrentBranch(ctx, repoDir)
+		if err != nil || branch != "main" {
+			t.Errorf("Expected branch main, got %q (%v)", branch, err)
+		}
+	})
+
+	t.Run("worktree lifecycle", func(t *testing.T) {
+		if err := g.CreateBranch(ctx, repoDir, "feature", "main"); err != nil {
+			t.Fatalf("CreateBranch failed: %v", err)
+		}
+
+		worktreeDir := filepath.Join(t.TempDir(), "feature")
+		if err := g.WorktreeAdd(ctx, repoDir, worktreeDir, "feature"); err != nil {
+			t.Fatalf("WorktreeAdd failed: %v", err)
+		}
+
+		movedDir := worktreeDir + "-moved"
+		if err := g.WorktreeMove(ctx, repoDir, worktreeDir, movedDir); err != nil {
+			t.Fatalf("WorktreeMove failed: %v", err)
+		}
+
+		worktrees, err := g.WorktreeList(ctx, repoDir)
+		if err != nil {
+			t.Fatalf("WorktreeList failed: %v", err)
+		}
+		if len(worktrees) != 2 || worktrees[1].Path != movedDir || worktrees[1].Branch != "feature" {
+			t.Errorf("Unexpected worktrees: %+v", worktrees)
+		}
+
+		if err := g.WorktreeRemove(ctx, repoDir, movedDir, false); err != nil {
+			t.Fatalf("WorktreeRemove failed: %v", err)
+		}
+		if _, err := os.Stat(movedDir); !os.IsNotExist(err) {
+			t.Error("Worktree directory still exists after removal")
+		}
+	})
+
+	t.Run("errors include stderr", func(t *testing.T) {
+		_, err := g.RevParse(ctx, repoDir, "--verify", "does-not-exist")
+		if err == nil {
+			t.Fatal("Expected error for unknown revision, got nil")
+		}
+
+		var gitErr *Error
+		if !errors.As(err, &gitErr) {
+			t.Fatalf("Expected *Error, got %T", err)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Errorf("Expected error to wrap *exec.ExitError")
+		}
+		if !strings.Contains(err.Error(), "rev-parse --verify does-not-exist") {
+			t.Errorf("Expected command in error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,317 @@
+package wtm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveRefPrefix is where archives keep the refs they need. The base ref
+// keeps the commit the saved changes apply to from being garbage collected;
+// the state ref only exists while a bundle is written or read.
+const archiveRefPrefix = "refs/wtm/archive/"
+
+// Archive is a worktree removed by Repository.Archive together with its
+// uncommitted changes.
+type Archive struct {
+	Name string `json:"name"`
+
+	// Path is the location of the worktree relative to the root, or the
+	// absolute path for worktrees outside of it.
+	Path string `json:"path"`
+
+	// Branch is the branch checked out in the worktree. It is empty when
+	// the worktree was detached.
+	Branch string `json:"branch,omitempty"`
+
+	// Base is the commit checked out in the worktree.
+	Base string `json:"base"`
+
+	// State is the stash commit holding the staged, unstaged and untracked
+	// changes. It is empty when the worktree was clean.
+	State string `json:"state,omitempty"`
+
+	// Ignored reports whether ignored files were saved as well.
+	Ignored bool `json:"ignored,omitempty"`
+
+	Created  time.Time `json:"created"`
+	Metadata Metadata  `json:"metadata,omitzero"`
+}
+
+// ArchiveOptions configures Repository.Archive.
+type ArchiveOptions struct {
+	// Worktree is the path of the worktree to archive.
+	Worktree string
+
+	// Name names the archive. It defaults to the worktree's directory name,
+	// or the sanitized branch name for the workspace.
+	Name string
+
+	// Ignored saves ignored files in addition to untracked ones.
+	Ignored bool
+}
+
+// Archive saves the uncommitted changes of a worktree into a bundle under
+// the bare repository, records its branch and base commit and removes the
+// worktree. Unarchive brings it back.
+func (r *Repository) Archive(ctx context.Context, opts ArchiveOptions) (*Archive, error) {
+	g := r.backend()
+
+	worktrees, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var wt *Worktree
+	for i := range worktrees {
+		if samePath(worktrees[i].Path, opts.Worktree) {
+			wt = &worktrees[i]
+		}
+	}
+	if wt == nil {
+		return nil, fmt.Errorf("%s is not a worktree of %s", opts.Worktree, r.Root)
+	}
+	if wt.Locked {
+		return nil, fmt.Errorf("worktree %s is locked", wt.Path)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(wt.Path)
+		if samePath(wt.Path, r.WorkspacePath()) && wt.Branch != "" {
+			name = SanitizeBranchName(wt.Branch)
+		}
+	}
+	if _, err := g.Output(ctx, r.gitDir(), "check-ref-format", archiveRefPrefix+name+"/base"); err != nil || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid archive name %q", name)
+	}
+	if _, err := os.Stat(r.archivePath(name, ".json")); err == nil {
+		return nil, fmt.Errorf("archive %s already exists", name)
+	}
+
+	archive := &Archive{
+		Name:     name,
+		Path:     r.metadataKey(wt.Path),
+		Branch:   wt.Branch,
+		Base:     wt.Head,
+		Ignored:  opts.Ignored,
+		Created:  time.Now().UTC().Truncate(time.Second),
+		Metadata: wt.Metadata,
+	}
+
+	status, err := g.Status(ctx, wt.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error checking worktree status: %w", err)
+	}
+	if len(status) > 0 || opts.Ignored {
+		if archive.State, err = r.saveArchiveState(ctx, archive, wt.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := g.Output(ctx, r.gitDir(), "update-ref", archiveRefPrefix+name+"/base", archive.Base); err != nil {
+		return nil, fmt.Errorf("error recording base commit: %w", err)
+	}
+	content, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(r.archivePath(name, ".json"), append(content, '\n')); err != nil {
+		return nil, fmt.Errorf("error writing archive: %w", err)
+	}
+
+	r.printf("Removing %s...\n", wt.Path)
+	if err := g.WorktreeRemove(ctx, r.gitDir(), wt.Path, false); err != nil {
+		if archive.State != "" {
+			if _, err := g.Output(ctx, wt.Path, "stash", "apply", "--index", archive.State); err != nil {
+				return nil, fmt.Errorf("error removing worktree %s, its changes are saved in archive %s: %w", wt.Path, name, err)
+			}
+		}
+		r.deleteArchive(ctx, name)
+		return nil, fmt.Errorf("error removing worktree %s: %w", wt.Path, err)
+	}
+	if err := r.deleteMetadata(wt.Path); err != nil {
+		r.printf("Warning: could not delete metadata of %s: %v\n", wt.Path, err)
+	}
+
+	r.printf("Successfully archived %s as %s\n", wt.Path, name)
+	return archive, nil
+}
+
+// saveArchiveState stashes the changes of the worktree at path and writes
+// the stash commit into the archive's bundle, leaving refs/stash as it was.
+// It returns the stash commit, or an empty string when there was nothing to
+// save.
+func (r *Repository) saveArchiveState(ctx context.Context, archive *Archive, path string) (string, error) {
+	g := r.backend()
+
+	untracked := "--include-untracked"
+	if archive.Ignored {
+		untracked = "--all"
+	}
+
+	// stash push leaves refs/stash alone when there is nothing to save
+	previous, _ := g.RevParse(ctx, path, "--verify", "--quiet", "refs/stash")
+	if _, err := g.Output(ctx, path, "stash", "push", "--quiet", untracked, "--message", "wtm archive "+archive.Name); err != nil {
+		return "", fmt.Errorf("error saving changes: %w", err)
+	}
+	state, _ := g.RevParse(ctx, path, "--verify", "--quiet", "refs/stash")
+	if state == "" || state == previous {
+		return "", nil
+	}
+	if _, err := g.Output(ctx, path, "stash", "drop", "--quiet"); err != nil {
+		r.printf("Warning: could not drop stash entry %s: %v\n", state, err)
+	}
+
+	// restore puts the changes back if the bundle cannot be written
+	restore := func(cause error) error {
+		if _, err := g.Output(ctx, path, "stash", "apply", "--index", state); err != nil {
+			return fmt.Errorf("%w; the changes are in stash commit %s", cause, state)
+		}
+		return cause
+	}
+
+	stateRef := archiveRefPrefix + archive.Name + "/state"
+	if _, err := g.Output(ctx, r.gitDir(), "update-ref", stateRef, state); err != nil {
+		return "", restore(fmt.Errorf("error saving changes: %w", err))
+	}
+	defer g.Output(ctx, r.gitDir(), "update-ref", "-d", stateRef)
+
+	bundle := r.archivePath(archive.Name, ".bundle")
+	if err := os.MkdirAll(filepath.Dir(bundle), 0755); err != nil {
+		return "", restore(fmt.Errorf("error creating archive directory: %w", err))
+	}
+	if _, err := g.Output(ctx, r.gitDir(), "bundle", "create", "--quiet", bundle, stateRef, "^"+archive.Base); err != nil {
+		return "", restore(fmt.Errorf("error writing bundle: %w", err))
+	}
+	return state, nil
+}
+
+// Unarchive recreates the worktree saved as archive name at its original
+// location, reapplies its staged, unstaged and untracked changes and
+// returns its path. The archive is deleted afterwards.
+func (r *Repository) Unarchive(ctx context.Context, name string) (string, error) {
+	g := r.backend()
+
+	archive, err := r.readArchive(name)
+	if err != nil {
+		return "", err
+	}
+
+	path := archive.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Root, filepath.FromSlash(path))
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+
+	if archive.Branch != "" {
+		head, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", "refs/heads/"+archive.Branch)
+		switch {
+		case err != nil:
+			if _, err := g.Output(ctx, r.gitDir(), "branch", archive.Branch, archive.Base); err != nil {
+				return "", fmt.Errorf("error recreating branch %s: %w", archive.Branch, err)
+			}
+		case head != archive.Base:
+			return "", fmt.Errorf("branch %s moved from %.7s to %.7s since it was archived, reset it to restore the changes exactly", archive.Branch, archive.Base, head)
+		}
+	}
+
+	// Fetch the saved changes before creating the worktree, so a damaged
+	// bundle leaves nothing behind
+	stateRef := archiveRefPrefix + name + "/state"
+	if archive.State != "" {
+		bundle := r.archivePath(name, ".bundle")
+		if _, err := g.Output(ctx, r.gitDir(), "fetch", "--quiet", bundle, stateRef+":"+stateRef); err != nil {
+			return "", fmt.Errorf("error reading bundle %s: %w", bundle, err)
+		}
+		defer g.Output(ctx, r.gitDir(), "update-ref", "-d", stateRef)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
+	}
+	r.printf("Recreating %s...\n", path)
+	if archive.Branch != "" {
+		err = g.WorktreeAdd(ctx, r.gitDir(), path, archive.Branch)
+	} else {
+		err = g.Run(ctx, r.gitDir(), "worktree", "add", "--detach", path, archive.Base)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error creating worktree: %w", err)
+	}
+
+	if archive.State != "" {
+		if _, err := g.Output(ctx, path, "stash", "apply", "--quiet", "--index", archive.State); err != nil {
+			return "", fmt.Errorf("error reapplying changes (archive %s is kept): %w", name, err)
+		}
+	}
+	if !archive.Metadata.IsZero() {
+		if err := r.UpdateMetadata(path, func(m *Metadata) { *m = archive.Metadata }); err != nil {
+			return "", err
+		}
+	}
+
+	r.deleteArchive(ctx, name)
+	r.printf("Successfully restored %s from archive %s\n", path, name)
+	return path, nil
+}
+
+// Archives returns the archives of the repository, sorted by name.
+func (r *Repository) Archives() ([]Archive, error) {
+	matches, err := filepath.Glob(r.archivePath("*", ".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []Archive
+	for _, match := range matches {
+		archive, err := r.readArchive(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, *archive)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Name < archives[j].Name })
+	return archives, nil
+}
+
+// deleteArchive deletes the ref and files of archive name, warning about
+// anything it cannot delete.
+func (r *Repository) deleteArchive(ctx context.Context, name string) {
+	if _, err := r.backend().Output(ctx, r.gitDir(), "update-ref", "-d", archiveRefPrefix+name+"/base"); err != nil {
+		r.printf("Warning: could not delete archive ref: %v\n", err)
+	}
+	for _, ext := range []string{".bundle", ".json"} {
+		if err := os.Remove(r.archivePath(name, ext)); err != nil && !os.IsNotExist(err) {
+			r.printf("Warning: could not delete archive file: %v\n", err)
+		}
+	}
+}
+
+// readArchive reads the record of archive name.
+func (r *Repository) readArchive(name string) (*Archive, error) {
+	content, err := os.ReadFile(r.archivePath(name, ".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no archive named %s. Use 'wtm unarchive' to list the archives", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive %s: %w", name, err)
+	}
+
+	var archive Archive
+	if err := json.Unmarshal(content, &archive); err != nil {
+		return nil, fmt.Errorf("error parsing archive %s: %w", name, err)
+	}
+	return &archive, nil
+}
+
+// archivePath returns the file of archive name with the given extension.
+func (r *Repository) archivePath(name, ext string) string {
+	return filepath.Join(r.gitDir(), "wtm", "archives", name+ext)
+}
@@ -0,0 +1,111 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if err := repo.AddLabels(path, "paused"); err != nil {
+		t.Fatalf("AddLabels failed: %v", err)
+	}
+
+	// Staged, unstaged, untracked and ignored changes
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(path, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "*.log\n")
+	write("feature.txt", "staged\n")
+	runGit(t, path, "add", "feature.txt", ".gitignore")
+	write("feature.txt", "unstaged\n")
+	write("notes.txt", "untracked\n")
+	write("debug.log", "ignored\n")
+	wantStatus := runGit(t, path, "status", "--porcelain", "--ignored")
+
+	archive, err := repo.Archive(ctx, ArchiveOptions{Worktree: path, Ignored: true})
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if archive.Name != "feature-branch" || archive.Branch != "feature-branch" || archive.State == "" {
+		t.Errorf("Unexpected archive %+v", archive)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected worktree to be removed")
+	}
+	if _, err := os.Stat(repo.archivePath("feature-branch", ".bundle")); err != nil {
+		t.Errorf("Expected bundle: %v", err)
+	}
+	if out := runGit(t, repo.Root, "for-each-ref", "refs/stash"); out != "" {
+		t.Errorf("Expected stash list to be left alone, got %q", out)
+	}
+
+	archives, err := repo.Archives()
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("Expected 1 archive, got %v, %v", archives, err)
+	}
+
+	// The saved state must not depend on the objects in the repository
+	runGit(t, repo.Root, "reflog", "expire", "--expire-unreachable=now", "--all")
+	runGit(t, repo.Root, "gc", "--prune=now", "--quiet")
+
+	restored, err := repo.Unarchive(ctx, "feature-branch")
+	if err != nil {
+		t.Fatalf("Unarchive failed: %v", err)
+	}
+	if !samePath(restored, path) {
+		t.Errorf("Expected worktree at %s, got %s", path, restored)
+	}
+	if status := runGit(t, path, "status", "--porcelain", "--ignored"); status != wantStatus {
+		t.Errorf("Expected status %q, got %q", wantStatus, status)
+	}
+	if staged := runGit(t, path, "show", ":feature.txt"); staged != "staged" {
+		t.Errorf("Expected staged content, got %q", staged)
+	}
+	if content, _ := os.ReadFile(filepath.Join(path, "feature.txt")); string(content) != "unstaged\n" {
+		t.Errorf("Expected unstaged content, got %q", content)
+	}
+	if m, _ := repo.Metadata(path); !m.HasLabels("paused") {
+		t.Errorf("Expected labels to be restored, got %+v", m)
+	}
+	if archives, _ := repo.Archives(); len(archives) != 0 {
+		t.Errorf("Expected archive to be deleted, got %+v", archives)
+	}
+
+	t.Run("clean worktree", func(t *testing.T) {
+		runGit(t, path, "reset", "--hard")
+		runGit(t, path, "clean", "-fdx")
+
+		archive, err := repo.Archive(ctx, ArchiveOptions{Worktree: path, Name: "clean"})
+		if err != nil {
+			t.Fatalf("Archive failed: %v", err)
+		}
+		if archive.State != "" {
+			t.Errorf("Expected no saved state, got %q", archive.State)
+		}
+		if _, err := repo.Unarchive(ctx, "clean"); err != nil {
+			t.Fatalf("Unarchive failed: %v", err)
+		}
+	})
+
+	t.Run("branch moved", func(t *testing.T) {
+		if _, err := repo.Archive(ctx, ArchiveOptions{Worktree: path, Name: "moved"}); err != nil {
+			t.Fatalf("Archive failed: %v", err)
+		}
+		runGit(t, repo.Root, "branch", "--force", "feature-branch", "main")
+		if _, err := repo.Unarchive(ctx, "moved"); err == nil {
+			t.Error("Expected error when the branch moved")
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package wtm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wtm/pkg/git"
+)
+
+// ObjectCache is a user-level store of bare mirrors, one per remote URL.
+// Clones made with a cache borrow objects from the mirror through git
+// alternates instead of downloading them again.
+type ObjectCache struct {
+	// Dir holds the mirrors.
+	Dir string
+
+	// Stdout and Stderr receive progress output. Nothing is written when
+	// they are nil.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Git runs the git operations. The git executable is used when nil.
+	Git git.Git
+}
+
+// Mirror describes a bare mirror in the object cache.
+type Mirror struct {
+	URL  string
+	Path string
+	Size int64
+
+	// Updated is when the mirror was last fetched.
+	Updated time.Time
+}
+
+// DefaultCacheDir returns the default object cache directory,
+// $XDG_CACHE_HOME/wtm/objects or its platform equivalent.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating cache directory: %w", err)
+	}
+	return filepath.Join(dir, "wtm", "objects"), nil
+}
+
+// MirrorPath returns the path of the mirror for url. The path combines the
+// repository name with a hash of the URL so that forks sharing a name get
+// separate mirrors.
+func (c *ObjectCache) MirrorPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, RepoNameFromURL(url)+"-"+hex.EncodeToString(sum[:6])+".git")
+}
+
+// Update creates the mirror for url, or fetches it when it already exists,
+// and returns its path.
+func (c *ObjectCache) Update(ctx context.Context, url string) (string, error) {
+	path := c.MirrorPath(url)
+	mirror := c.mirror(path)
+	g := mirror.backend()
+
+	if isBareRepository(ctx, g, path) {
+		mirror.printf("Updating object cache for %s...\n", url)
+		if err := g.Run(ctx, path, "fetch", "origin"); err != nil {
+			return "", fmt.Errorf("error updating object cache: %w", err)
+		}
+		return path, nil
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating object cache directory: %w", err)
+	}
+
+	mirror.printf("Populating object cache for %s...\n", url)
+	if err := g.Run(ctx, "", "clone", "--mirror", url, path); err != nil {
+		return "", fmt.Errorf("error populating object cache: %w", err)
+	}
+
+	// Clones borrow objects from the mirror, so nothing may ever be pruned
+	// from it, neither by automatic nor by manual garbage collection
+	for _, kv := range [][2]string{{"gc.auto", "0"}, {"gc.pruneExpire", "never"}, {"gc.reflogExpireUnreachable", "never"}} {
+		if err := g.Run(ctx, path, "config", kv[0], kv[1]); err != nil {
+			return "", fmt.Errorf("error configuring object cache: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// Mirrors returns the mirrors in the cache. It returns nil when the cache
+// directory does not exist.
+func (c *ObjectCache) Mirrors(ctx context.Context) ([]Mirror, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading object cache: %w", err)
+	}
+
+	var mirrors []Mirror
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".git") {
+			continue
+		}
+		path := filepath.Join(c.Dir, entry.Name())
+
+		url, err := c.mirror(path).backend().Output(ctx, path, "config", "--get", "remote.origin.url")
+		if err != nil {
+			continue
+		}
+
+		m := Mirror{URL: strings.TrimSpace(url), Path: path, Size: dirSize(path)}
+		if info, err := os.Stat(filepath.Join(path, "FETCH_HEAD")); err == nil {
+			m.Updated = info.ModTime()
+		} else if info, err := entry.Info(); err == nil {
+			m.Updated = info.ModTime()
+		}
+		mirrors = append(mirrors, m)
+	}
+	return mirrors, nil
+}
+
+// UpdateAll fetches every mirror in the cache.
+func (c *ObjectCache) UpdateAll(ctx context.Context) error {
+	mirrors, err := c.Mirrors(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range mirrors {
+		if _, err := c.Update(ctx, m.URL); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.URL, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GC repacks every mirror in the cache. Unreachable objects are kept since
+// clones may still borrow them.
+func (c *ObjectCache) GC(ctx context.Context) error {
+	mirrors, err := c.Mirrors(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range mirrors {
+		mirror := c.mirror(m.Path)
+		mirror.printf("Collecting garbage in %s...\n", m.URL)
+		if err := mirror.backend().Run(ctx, m.Path, "gc", "--prune=never"); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.URL, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mirror returns a Repository for the mirror at path, sharing the cache's
+// output and git backend.
+func (c *ObjectCache) mirror(path string) *Repository {
+	return &Repository{Root: path, GitDir: path, Stdout: c.Stdout, Stderr: c.Stderr, Git: c.Git}
+}
+
+// alternatesPath returns the path of the file listing the object stores the
+// repository borrows from.
+func (r *Repository) alternatesPath() string {
+	return filepath.Join(r.gitDir(), "objects", "info", "alternates")
+}
+
+// Dissociate copies all objects the repository borrows from the object
+// cache into its own object store and stops using the cache. The borrowed
+// stores are only dropped once the repository is verified to be complete
+// without them.
+func (r *Repository) Dissociate(ctx context.Context) error {
+	alternates := r.alternatesPath()
+	if _, err := os.Stat(alternates); os.IsNotExist(err) {
+		return fmt.Errorf("repository does not use an object cache")
+	}
+
+	g := r.backend()
+	r.printf("Copying borrowed objects into the repository...\n")
+	if err := g.Run(ctx, r.gitDir(), "repack", "-a", "-d"); err != nil {
+		return fmt.Errorf("error repacking repository: %w", err)
+	}
+
+	backup := alternates + ".wtm-backup"
+	if err := os.Rename(alternates, backup); err != nil {
+		return fmt.Errorf("error removing alternates: %w", err)
+	}
+	if _, err := g.Output(ctx, r.gitDir(), "fsck", "--connectivity-only"); err != nil {
+		if restoreErr := os.Rename(backup, alternates); restoreErr != nil {
+			return fmt.Errorf("repository is incomplete without the object cache and alternates could not be restored from %s: %w", backup, restoreErr)
+		}
+		return fmt.Errorf("repository is incomplete without the object cache, alternates kept: %w", err)
+	}
+	if err := os.Remove(backup); err != nil {
+		return fmt.Errorf("error removing %s: %w", backup, err)
+	}
+
+	r.printf("Successfully dissociated repository from the object cache\n")
+	return nil
+}
+
+// dirSize returns the total size of the regular files under path.
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,109 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestObjectCache(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRepo(t).Root
+	cache := &ObjectCache{Dir: filepath.Join(t.TempDir(), "objects")}
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	repo, err := Clone(ctx, CloneOptions{URL: remote, Dir: cloneDir, Cache: cache})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	mirror := cache.MirrorPath(remote)
+	alternates, err := os.ReadFile(repo.alternatesPath())
+	if err != nil {
+		t.Fatalf("Expected clone to use alternates: %v", err)
+	}
+	if !strings.Contains(string(alternates), mirror) {
+		t.Errorf("Expected alternates to point into %s, got %q", mirror, alternates)
+	}
+	if prune := runGit(t, mirror, "config", "gc.pruneExpire"); prune != "never" {
+		t.Errorf("Expected mirror to never prune objects, got %q", prune)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		mirrors, err := cache.Mirrors(ctx)
+		if err != nil {
+			t.Fatalf("Mirrors failed: %v", err)
+		}
+		if len(mirrors) != 1 || mirrors[0].URL != remote || mirrors[0].Path != mirror || mirrors[0].Size == 0 {
+			t.Errorf("Unexpected mirrors %+v", mirrors)
+		}
+	})
+
+	t.Run("update and gc", func(t *testing.T) {
+		runGit(t, remote, "branch", "new-branch", "main")
+		if err := cache.UpdateAll(ctx); err != nil {
+			t.Fatalf("UpdateAll failed: %v", err)
+		}
+		runGit(t, mirror, "rev-parse", "--verify", "refs/heads/new-branch")
+
+		if err := cache.GC(ctx); err != nil {
+			t.Fatalf("GC failed: %v", err)
+		}
+	})
+
+	t.Run("second clone of the same remote reuses the mirror", func(t *testing.T) {
+		other, err := Clone(ctx, CloneOptions{URL: remote, Dir: filepath.Join(t.TempDir(), "other"), Cache: cache})
+		if err != nil {
+			t.Fatalf("Clone failed: %v", err)
+		}
+		if _, err := os.Stat(other.alternatesPath()); err != nil {
+			t.Errorf("Expected second clone to use alternates: %v", err)
+		}
+		if mirrors, _ := cache.Mirrors(ctx); len(mirrors) != 1 {
+			t.Errorf("Expected a single mirror, got %+v", mirrors)
+		}
+	})
+
+	t.Run("dissociate", func(t *testing.T) {
+		if err := repo.Dissociate(ctx); err != nil {
+			t.Fatalf("Dissociate failed: %v", err)
+		}
+		if _, err := os.Stat(repo.alternatesPath()); !os.IsNotExist(err) {
+			t.Errorf("Expected alternates to be removed, got %v", err)
+		}
+
+		// The clone must be complete without the cache
+		if err := os.RemoveAll(cache.Dir); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, cloneDir, "fsck", "--connectivity-only")
+
+		if err := repo.Dissociate(ctx); err == nil {
+			t.Error("Expected error when dissociating a repository without a cache")
+		}
+	})
+}
+
+func TestObjectCache_MirrorPath(t *testing.T) {
+	cache := &ObjectCache{Dir: "/cache"}
+
+	fork := cache.MirrorPath("https://github.com/alice/repo.git")
+	upstream := cache.MirrorPath("https://github.com/org/repo.git")
+
+	if fork == upstream {
+		t.Errorf("Expected distinct mirrors for distinct URLs, got %q", fork)
+	}
+	if !strings.HasPrefix(filepath.Base(fork), "repo-") || filepath.Ext(fork) != ".git" {
+		t.Errorf("Unexpected mirror path %q", fork)
+	}
+}
+
+func TestObjectCache_MirrorsEmpty(t *testing.T) {
+	cache := &ObjectCache{Dir: filepath.Join(t.TempDir(), "missing")}
+	mirrors, err := cache.Mirrors(context.Background())
+	if err != nil || mirrors != nil {
+		t.Errorf("Expected no mirrors and no error, got %+v, %v", mirrors, err)
+	}
+}
@@ -0,0 +1,76 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// CheckoutOptions configures Repository.Checkout.
+type CheckoutOptions struct {
+	// Commitish is the branch, tag or commit to check out.
+	Commitish string
+
+	// Restore restores all persisted files into the new worktree.
+	Restore bool
+}
+
+// Checkout creates a worktree for opts.Commitish in tree/<name>, where name
+// is the sanitized commitish, and returns the path of the new worktree.
+// Remote branches given as <remote>/<branch> or <user>:<branch> are checked
+// out on a local branch tracking them, which names the worktree.
+func (r *Repository) Checkout(ctx context.Context, opts CheckoutOptions) (string, error) {
+	// Create the tree directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Join(r.Root, TreeDir), 0755); err != nil {
+		return "", fmt.Errorf("error creating tree directory: %w", err)
+	}
+
+	commitish, err := r.localBranchFor(ctx, opts.Commitish)
+	if err != nil {
+		return "", err
+	}
+
+	worktreePath := r.TreePath(commitish)
+	if _, err := os.Stat(worktreePath); err == nil {
+		return "", fmt.Errorf("worktree already exists at %s", worktreePath)
+	}
+
+	r.printf("Creating worktree for '%s' at %s...\n", commitish, worktreePath)
+
+	if err := r.createWorktree(ctx, worktreePath, commitish); err != nil {
+		return "", fmt.Errorf("error creating worktree: %w", err)
+	}
+
+	if opts.Restore {
+		if err := r.Restore(ctx, RestoreOptions{Worktree: worktreePath, All: true}); err != nil {
+			return "", fmt.Errorf("error restoring persisted files: %w", err)
+		}
+	}
+
+	r.printf("Successfully created worktree at %s\n", worktreePath)
+	return worktreePath, nil
+}
+
+// createWorktree creates a new worktree at path, fetching commitish first
+// when it is missing locally, and initializes its submodules.
+func (r *Repository) createWorktree(ctx context.Context, path, commitish string) error {
+	if err := r.ensureCommitish(ctx, commitish); err != nil {
+		return err
+	}
+
+	g := r.backend()
+	if err := g.WorktreeAdd(ctx, r.gitDir(), path, commitish); err != nil {
+		return err
+	}
+
+	if submodules, _ := r.configValues(ctx, SubmodulesKey); slices.Contains(submodules, "false") {
+		return nil
+	}
+
+	// Ignore error - command exits successfully with no action if no submodules exist
+	_ = g.Run(ctx, path, "submodule", "update", "--init", "--recursive")
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckout(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	t.Run("creates worktree in tree", func(t *testing.T) {
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+
+		if path != filepath.Join(repo.Root, "tree", "feature-branch") {
+			t.Errorf("Unexpected worktree path %q", path)
+		}
+		if _, err := os.Stat(filepath.Join(path, "feature.txt")); err != nil {
+			t.Errorf("Expected checked out file in worktree: %v", err)
+		}
+	})
+
+	t.Run("error when worktree already exists", func(t *testing.T) {
+		_, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected 'already exists' error, got: %v", err)
+		}
+	})
+
+	t.Run("restores persisted files", func(t *testing.T) {
+		sharedDir := repo.SharedPath()
+		if err := os.MkdirAll(sharedDir, 0755); err != nil {
+			t.Fatalf("Failed to create shared dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(sharedDir, ".env"), []byte("KEY=value"), 0644); err != nil {
+			t.Fatalf("Failed to write shared file: %v", err)
+		}
+
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "main", Restore: true})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(path, ".env"))
+		if err != nil {
+			t.Fatalf("Expected restored file: %v", err)
+		}
+		if string(content) != "KEY=value" {
+			t.Errorf("Content mismatch: got %q", string(content))
+		}
+	})
+}
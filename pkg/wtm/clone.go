@@ -0,0 +1,335 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"wtm/pkg/git"
+)
+
+const (
+	// DepthKey is the git config key recording the depth of a shallow clone.
+	// Branches fetched on demand are fetched with the same depth.
+	DepthKey = "wtm.depth"
+
+	// SubmodulesKey is the git config key controlling whether submodules are
+	// initialized in new worktrees. Only the value false disables them.
+	SubmodulesKey = "wtm.submodules"
+)
+
+// CloneOptions configures Clone.
+type CloneOptions struct {
+	// URL is the repository to clone.
+	URL string
+
+	// Dir is the directory to clone into. When empty it is inferred from
+	// the last component of URL.
+	Dir string
+
+	// Layout is the on-disk layout to create. LayoutBare is used when empty.
+	Layout Layout
+
+	// Branch is checked out in the workspace. The remote's default branch
+	// is used when empty.
+	Branch string
+
+	// Depth creates a shallow clone with history truncated to that many
+	// commits. Zero clones the full history.
+	Depth int
+
+	// Filter is a partial clone filter such as blob:none or tree:0. Objects
+	// left out are fetched from the promisor remote when needed.
+	Filter string
+
+	// SingleBranch only fetches Branch, or the remote's default branch.
+	// Other branches are fetched on demand by Checkout and Switch.
+	SingleBranch bool
+
+	// NoSubmodules skips cloning submodules, and initializing them in
+	// worktrees created later.
+	NoSubmodules bool
+
+	// Cache, when set, keeps a mirror of URL in the object cache and makes
+	// the clone borrow objects from it.
+	Cache *ObjectCache
+
+	// RunHooks runs the wtm.postCheckout hooks in the new workspace.
+	RunHooks bool
+
+	// SharedTemplate is a directory whose contents are copied into shared/
+	// and restored into the new workspace.
+	SharedTemplate string
+
+	// Registry, when set, records the clone in the machine-wide registry.
+	Registry *Registry
+
+	// Stdout and Stderr are assigned to the returned Repository and receive
+	// the clone progress.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Git runs the git operations. The git executable is used when nil.
+	Git git.Git
+}
+
+// Clone clones a repository as a bare repository and bootstraps it for wtm:
+// it configures the fetch refspec so that all remote branches are fetched,
+// fetches them, sets origin/HEAD and creates the workspace on the default
+// branch. Running Clone again on an existing clone completes any step that
+// is missing.
+func Clone(ctx context.Context, opts CloneOptions) (*Repository, error) {
+	dir := opts.Dir
+	if dir == "" {
+		dir = RepoNameFromURL(opts.URL)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving clone directory: %w", err)
+	}
+	r := &Repository{Root: root, GitDir: root, Stdout: opts.Stdout, Stderr: opts.Stderr, Git: opts.Git}
+
+	switch opts.Layout {
+	case "", LayoutBare:
+	case LayoutDotBare:
+		r.GitDir = filepath.Join(root, DotBareDir)
+	default:
+		return nil, fmt.Errorf("unknown layout %q (expected %q or %q)", opts.Layout, LayoutBare, LayoutDotBare)
+	}
+
+	g := r.backend()
+
+	if isBareRepository(ctx, g, r.GitDir) {
+		r.printf("Repository already cloned at %s, completing setup...\n", dir)
+	} else {
+		r.printf("Cloning %s into %s...\n", opts.URL, dir)
+
+		reference := ""
+		if opts.Cache != nil {
+			if reference, err = opts.Cache.Update(ctx, opts.URL); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := g.Run(ctx, "", cloneArgs(opts, r.GitDir, reference)...); err != nil {
+			return nil, fmt.Errorf("error cloning repository: %w", err)
+		}
+	}
+
+	if r.Layout() == LayoutDotBare {
+		gitFile := filepath.Join(root, ".git")
+		if err := os.WriteFile(gitFile, []byte("gitdir: ./"+DotBareDir+"\n"), 0644); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", gitFile, err)
+		}
+	}
+
+	if err := r.configureClone(ctx, opts); err != nil {
+		return nil, err
+	}
+
+	fetchArgs := []string{"fetch"}
+	if opts.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(opts.Depth))
+	}
+	r.printf("Fetching remote branches...\n")
+	if err := g.Run(ctx, r.gitDir(), append(fetchArgs, "origin")...); err != nil {
+		return nil, fmt.Errorf("error fetching remote branches: %w", err)
+	}
+
+	if _, err := g.Output(ctx, r.gitDir(), "remote", "set-head", "origin", "--auto"); err != nil {
+		r.printf("Warning: could not determine the remote default branch: %v\n", err)
+	}
+
+	workspacePath, err := r.bootstrapWorkspace(ctx, opts.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	if workspacePath != "" && opts.SharedTemplate != "" {
+		r.printf("Copying shared template from %s...\n", opts.SharedTemplate)
+		if err := copyTemplate(ctx, opts.SharedTemplate, r.SharedPath()); err != nil {
+			return nil, fmt.Errorf("error copying shared template: %w", err)
+		}
+		if err := r.Restore(ctx, RestoreOptions{Worktree: workspacePath, All: true}); err != nil {
+			return nil, fmt.Errorf("error restoring shared template: %w", err)
+		}
+	}
+
+	if workspacePath != "" && opts.RunHooks {
+		if err := r.RunPostCheckoutHooks(ctx, workspacePath); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Registry != nil {
+		if err := opts.Registry.Add(r.Root); err != nil {
+			r.printf("Warning: could not register repository: %v\n", err)
+		}
+	}
+
+	r.printf("Repository cloned and configured successfully.\n")
+	return r, nil
+}
+
+// cloneArgs returns the git clone arguments for opts, cloning into gitDir
+// and borrowing objects from reference when it is not empty.
+func cloneArgs(opts CloneOptions, gitDir, reference string) []string {
+	args := []string{"clone", "--bare"}
+	if !opts.NoSubmodules {
+		args = append(args, "--recurse-submodules")
+	}
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch)
+	}
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Filter != "" {
+		args = append(args, "--filter="+opts.Filter)
+	}
+	if opts.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if reference != "" {
+		args = append(args, "--reference", reference)
+	}
+	return append(args, opts.URL, gitDir)
+}
+
+// configureClone writes the configuration wtm relies on after cloning: the
+// origin fetch refspec and the settings later checkouts need to honor the
+// clone options.
+func (r *Repository) configureClone(ctx context.Context, opts CloneOptions) error {
+	g := r.backend()
+
+	branch := "*"
+	if opts.SingleBranch {
+		branch = opts.Branch
+		if branch == "" {
+			// A bare clone points HEAD at the branch it cloned
+			head, err := g.Output(ctx, r.gitDir(), "symbolic-ref", "--short", "HEAD")
+			if err != nil {
+				return fmt.Errorf("error determining cloned branch: %w", err)
+			}
+			branch = strings.TrimSpace(head)
+		}
+	}
+	if err := r.ensureFetchRefspec(ctx, "origin", branch); err != nil {
+		return err
+	}
+
+	if opts.Depth > 0 {
+		if err := g.Run(ctx, r.gitDir(), "config", DepthKey, strconv.Itoa(opts.Depth)); err != nil {
+			return fmt.Errorf("error configuring clone depth: %w", err)
+		}
+	}
+	if opts.NoSubmodules {
+		if err := g.Run(ctx, r.gitDir(), "config", SubmodulesKey, "false"); err != nil {
+			return fmt.Errorf("error disabling submodules: %w", err)
+		}
+	}
+	return nil
+}
+
+// ensureFetchRefspec adds the fetch refspec mapping branch of remote to its
+// remote-tracking branch unless it is already configured. A branch of "*"
+// fetches all branches.
+func (r *Repository) ensureFetchRefspec(ctx context.Context, remote, branch string) error {
+	key := "remote." + remote + ".fetch"
+	refspec := "+refs/heads/" + branch + ":refs/remotes/" + remote + "/" + branch
+
+	refspecs, err := r.configValues(ctx, key)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(refspecs, refspec) {
+		return nil
+	}
+
+	if err := r.backend().Run(ctx, r.gitDir(), "config", "--add", key, refspec); err != nil {
+		return fmt.Errorf("error configuring remote fetch: %w", err)
+	}
+	return nil
+}
+
+// bootstrapWorkspace creates the workspace on branch, or on the default
+// branch when branch is empty, and returns its path. It returns an empty
+// path when the repository has no branch to check out yet.
+func (r *Repository) bootstrapWorkspace(ctx context.Context, branch string) (string, error) {
+	workspacePath := r.WorkspacePath()
+	if _, err := os.Stat(workspacePath); err == nil {
+		r.printf("Workspace already exists, skipping creation\n")
+		return workspacePath, nil
+	}
+
+	if branch == "" {
+		branch = r.defaultBranch(ctx)
+	}
+	if branch == "" {
+		r.printf("Repository has no branches yet, skipping workspace creation\n")
+		return "", nil
+	}
+
+	r.printf("Creating workspace on %s...\n", branch)
+	if err := r.createWorktree(ctx, workspacePath, branch); err != nil {
+		return "", fmt.Errorf("error creating workspace: %w", err)
+	}
+	return workspacePath, nil
+}
+
+// defaultBranch returns the remote default branch when origin/HEAD is set,
+// falling back to the branch HEAD points to. It returns an empty string
+// when that branch does not exist.
+func (r *Repository) defaultBranch(ctx context.Context) string {
+	g := r.backend()
+
+	branch := ""
+	if ref, err := g.Output(ctx, r.gitDir(), "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		branch = strings.TrimPrefix(strings.TrimSpace(ref), "origin/")
+	} else if ref, err := g.Output(ctx, r.gitDir(), "symbolic-ref", "--short", "HEAD"); err == nil {
+		branch = strings.TrimSpace(ref)
+	}
+
+	if branch == "" {
+		return ""
+	}
+	if _, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", "refs/heads/"+branch); err != nil {
+		return ""
+	}
+	return branch
+}
+
+// copyTemplate copies the contents of the template directory into dst,
+// leaving existing entries untouched.
+func copyTemplate(ctx context.Context, template, dst string) error {
+	entries, err := os.ReadDir(template)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		target := filepath.Join(dst, entry.Name())
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		if err := copyPath(ctx, filepath.Join(template, entry.Name()), target, copyOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepoNameFromURL infers a directory name from a repository URL.
+func RepoNameFromURL(url string) string {
+	parts := strings.Split(url, "/")
+	return strings.TrimSuffix(parts[len(parts)-1], ".git")
+}
@@ -0,0 +1,194 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	remoteRepo := filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, filepath.Dir(remoteRepo), "init", "--bare", remoteRepo)
+
+	cloneDir := filepath.Join(t.TempDir(), "cloned-repo")
+	repo, err := Clone(context.Background(), CloneOptions{URL: remoteRepo, Dir: cloneDir})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if repo.Root != cloneDir {
+		t.Errorf("Expected root %q, got %q", cloneDir, repo.Root)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "HEAD")); err != nil {
+		t.Errorf("Expected bare repository at %s: %v", cloneDir, err)
+	}
+
+	refspec := runGit(t, cloneDir, "config", "--get", "remote.origin.fetch")
+	if refspec != "+refs/heads/*:refs/remotes/origin/*" {
+		t.Errorf("Unexpected fetch refspec %q", refspec)
+	}
+}
+
+func TestRepoNameFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/user/repo.git": "repo",
+		"git@github.com:user/project.git":  "project",
+		"/srv/git/local":                   "local",
+	}
+
+	for url, expected := range tests {
+		if got := RepoNameFromURL(url); got != expected {
+			t.Errorf("RepoNameFromURL(%q) = %q, want %q", url, got, expected)
+		}
+	}
+}
+
+func TestClone_DotBare(t *testing.T) {
+	remoteRepo := newTestRepo(t).Root
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	repo, err := Clone(context.Background(), CloneOptions{URL: remoteRepo, Dir: cloneDir, Layout: LayoutDotBare})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if repo.Root != cloneDir || repo.GitDir != filepath.Join(cloneDir, ".bare") {
+		t.Errorf("Unexpected root %q and git dir %q", repo.Root, repo.GitDir)
+	}
+	if repo.Layout() != LayoutDotBare {
+		t.Errorf("Expected dotbare layout, got %q", repo.Layout())
+	}
+
+	gitFile, err := os.ReadFile(filepath.Join(cloneDir, ".git"))
+	if err != nil {
+		t.Fatalf("Expected .git file: %v", err)
+	}
+	if string(gitFile) != "gitdir: ./.bare\n" {
+		t.Errorf("Unexpected .git file content %q", string(gitFile))
+	}
+
+	refspec := runGit(t, cloneDir, "config", "--get", "remote.origin.fetch")
+	if refspec != "+refs/heads/*:refs/remotes/origin/*" {
+		t.Errorf("Unexpected fetch refspec %q", refspec)
+	}
+
+	t.Run("open detects the layout", func(t *testing.T) {
+		for _, path := range []string{cloneDir, repo.GitDir} {
+			opened, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open(%s) failed: %v", path, err)
+			}
+			if opened.Root != cloneDir || opened.GitDir != repo.GitDir {
+				t.Errorf("Open(%s): unexpected root %q and git dir %q", path, opened.Root, opened.GitDir)
+			}
+		}
+	})
+
+	t.Run("worktrees live next to .bare", func(t *testing.T) {
+		ctx := context.Background()
+		if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if path != filepath.Join(cloneDir, "tree", "feature-branch") {
+			t.Errorf("Unexpected worktree path %q", path)
+		}
+		if err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(cloneDir, "tree", "main")); err != nil {
+			t.Errorf("Expected main to move to tree/main: %v", err)
+		}
+
+		worktrees, err := repo.List(ctx)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(worktrees) != 2 {
+			t.Errorf("Expected 2 worktrees, got %+v", worktrees)
+		}
+	})
+
+	t.Run("unknown layout", func(t *testing.T) {
+		_, err := Clone(context.Background(), CloneOptions{URL: remoteRepo, Dir: filepath.Join(t.TempDir(), "x"), Layout: "flat"})
+		if err == nil {
+			t.Error("Expected error for unknown layout, got nil")
+		}
+	})
+}
+
+func TestClone_Bootstrap(t *testing.T) {
+	ctx := context.Background()
+	remoteRepo := newTestRepo(t).Root
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	repo, err := Clone(ctx, CloneOptions{URL: remoteRepo, Dir: cloneDir})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if branch := runGit(t, repo.WorkspacePath(), "branch", "--show-current"); branch != "main" {
+		t.Errorf("Expected workspace on main, got %q", branch)
+	}
+	runGit(t, cloneDir, "rev-parse", "--verify", "refs/remotes/origin/feature-branch")
+	if head := runGit(t, cloneDir, "symbolic-ref", "refs/remotes/origin/HEAD"); head != "refs/remotes/origin/main" {
+		t.Errorf("Expected origin/HEAD to point to origin/main, got %q", head)
+	}
+
+	t.Run("rerun is idempotent", func(t *testing.T) {
+		if _, err := Clone(ctx, CloneOptions{URL: remoteRepo, Dir: cloneDir}); err != nil {
+			t.Fatalf("Second Clone failed: %v", err)
+		}
+		refspecs := runGit(t, cloneDir, "config", "--get-all", "remote.origin.fetch")
+		if refspecs != "+refs/heads/*:refs/remotes/origin/*" {
+			t.Errorf("Expected a single fetch refspec, got %q", refspecs)
+		}
+	})
+}
+
+func TestClone_BranchTemplateAndHooks(t *testing.T) {
+	ctx := context.Background()
+	remoteRepo := newTestRepo(t).Root
+
+	template := t.TempDir()
+	if err := os.WriteFile(filepath.Join(template, ".env"), []byte("KEY=value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hooks are read from the global config as well, which is how they are
+	// available before the clone exists
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	runGit(t, home, "config", "--global", PostCheckoutHookKey, "touch hook-ran")
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	repo, err := Clone(ctx, CloneOptions{
+		URL:            remoteRepo,
+		Dir:            cloneDir,
+		Branch:         "feature-branch",
+		SharedTemplate: template,
+		RunHooks:       true,
+	})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	workspace := repo.WorkspacePath()
+	if branch := runGit(t, workspace, "branch", "--show-current"); branch != "feature-branch" {
+		t.Errorf("Expected workspace on feature-branch, got %q", branch)
+	}
+	if _, err := os.Stat(filepath.Join(repo.SharedPath(), ".env")); err != nil {
+		t.Errorf("Expected template copied into shared/: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(workspace, ".env")); err != nil || string(content) != "KEY=value\n" {
+		t.Errorf("Expected template restored into workspace, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "hook-ran")); err != nil {
+		t.Errorf("Expected post-checkout hook to run in workspace: %v", err)
+	}
+}
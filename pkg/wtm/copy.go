@@ -0,0 +1,324 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// copyWorkers is the number of files copied concurrently. Copying many
+// small files is bound by I/O latency rather than CPU, so there are more
+// workers than CPUs.
+var copyWorkers = min(max(2*runtime.NumCPU(), 4), 32)
+
+// copyOptions controls how copyPath copies files and directories.
+type copyOptions struct {
+	// File writes the regular file src to dst. It is copyFile when nil.
+	// When merging, an existing dst is removed before File is called, since
+	// links cannot be created over it; copyFile renames over dst instead.
+	File func(src, dst string) error
+
+	// Dereference copies what symlinks point to instead of the links.
+	Dereference bool
+
+	// Merge copies into existing directories, replacing the files present
+	// in both. Files of dst that are symlinks to their source are kept.
+	Merge bool
+
+	// Skipped is called for the sockets, named pipes and devices that are
+	// not copied.
+	Skipped func(path string, mode fs.FileMode)
+
+	// Progress receives the progress of copies taking more than
+	// progressDelay, see copyProgress. Nothing is reported when nil.
+	Progress io.Writer
+}
+
+// copyJob is a file or directory to copy.
+type copyJob struct {
+	src, dst string
+	info     os.FileInfo
+
+	// isNew is set when dst did not exist.
+	isNew bool
+}
+
+// copyPlan lists what a copy creates. Directories come before their
+// contents.
+type copyPlan struct {
+	dirs, links, files []copyJob
+	bytes              int64
+
+	// created holds the outermost paths that did not exist before the copy.
+	created []string
+}
+
+// copyPath copies a file or directory from src to dst. Symlinks are copied
+// as symlinks unless opts.Dereference is set, modes and modification times
+// are kept, and special files are skipped. Files are copied concurrently.
+// When the copy fails or ctx is canceled, the paths it created are removed.
+func copyPath(ctx context.Context, src, dst string, opts copyOptions) (err error) {
+	var plan copyPlan
+	if err := opts.plan(&plan, src, dst, nil, false); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			for _, path := range slices.Backward(plan.created) {
+				os.RemoveAll(path)
+			}
+		}
+	}()
+
+	for _, dir := range plan.dirs {
+		// Keep the directory writable until its contents are copied
+		if err := os.MkdirAll(dir.dst, dir.info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+	}
+	for _, link := range plan.links {
+		if !link.isNew && opts.Merge {
+			if err := os.Remove(link.dst); err != nil {
+				return err
+			}
+		}
+		if err := copySymlink(link.src, link.dst); err != nil {
+			return err
+		}
+	}
+	if err := opts.copyFiles(ctx, &plan); err != nil {
+		return err
+	}
+	for _, dir := range slices.Backward(plan.dirs) {
+		if !dir.isNew && opts.Merge {
+			continue
+		}
+		if err := os.Chmod(dir.dst, dir.info.Mode()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dir.dst, dir.info.ModTime(), dir.info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan adds the copy of src to dst to p. parents holds the directories
+// being copied above src, to detect cycles through dereferenced symlinks;
+// parentNew is set when the parent of dst is created by the copy.
+func (o copyOptions) plan(p *copyPlan, src, dst string, parents []os.FileInfo, parentNew bool) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	isLink := info.Mode()&fs.ModeSymlink != 0
+	if isLink && o.Dereference {
+		if info, err = os.Stat(src); err != nil {
+			return err
+		}
+		isLink = false
+	}
+
+	job := copyJob{src: src, dst: dst, info: info, isNew: parentNew}
+	var existing os.FileInfo
+	if !parentNew {
+		existing, err = os.Lstat(dst)
+		switch {
+		case os.IsNotExist(err):
+			job.isNew = true
+			p.created = append(p.created, dst)
+		case err != nil:
+			return err
+		case o.Merge && existing.IsDir() && (isLink || !info.IsDir()):
+			return fmt.Errorf("%s is a directory", dst)
+		}
+	}
+
+	switch {
+	case isLink:
+		p.links = append(p.links, job)
+	case info.IsDir():
+		for _, parent := range parents {
+			if os.SameFile(parent, info) {
+				return fmt.Errorf("symlink cycle at %s", src)
+			}
+		}
+		p.dirs = append(p.dirs, job)
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err := o.plan(p, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), append(parents, info), job.isNew)
+			if err != nil {
+				return err
+			}
+		}
+	case info.Mode().IsRegular():
+		if existing != nil && o.Merge && linksTo(dst, src) {
+			return nil
+		}
+		p.files = append(p.files, job)
+		p.bytes += info.Size()
+	case o.Skipped != nil:
+		o.Skipped(src, info.Mode())
+	}
+	return nil
+}
+
+// copyFiles writes the files of p with copyWorkers workers. It stops at the
+// first error or when ctx is canceled.
+func (o copyOptions) copyFiles(ctx context.Context, p *copyPlan) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	progress := startProgress(o.Progress, len(p.files), p.bytes)
+	defer progress.stop()
+
+	jobs := make(chan copyJob)
+	var wg sync.WaitGroup
+	for range min(copyWorkers, len(p.files)) {
+		wg.Go(func() {
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := o.copyFile(job); err != nil {
+					cancel(err)
+					continue
+				}
+				progress.add(job.info.Size())
+			}
+		})
+	}
+
+send:
+	for _, job := range p.files {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// copyFile writes the file of job, replacing the existing one when merging.
+func (o copyOptions) copyFile(job copyJob) error {
+	if o.File == nil {
+		// Renaming over dst replaces a symlink rather than writing through
+		// it, and keeps dst when the copy fails
+		return copyFile(job.src, job.dst)
+	}
+	if !job.isNew && o.Merge {
+		if err := os.Remove(job.dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return o.File(job.src, job.dst)
+}
+
+// copyFile copies a single file with its mode and modification time. The
+// copy is written to a temporary file next to dst and renamed over it, so
+// dst is never left partially written.
+func copyFile(src, dst string) (err error) {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".wtm-tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	if _, err := io.Copy(temp, source); err != nil {
+		return err
+	}
+	if err := temp.Chmod(info.Mode()); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(temp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), dst)
+}
+
+// copySymlink creates dst as a symlink with the target of the symlink src.
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+// fileKind names the type of special files for messages.
+func fileKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	}
+	return "special file"
+}
+
+// warnSkipped reports a special file that copyPath skipped.
+func (r *Repository) warnSkipped(path string, mode fs.FileMode) {
+	r.printf("Warning: skipped %s: a %s cannot be copied\n", path, fileKind(mode))
+}
+
+// linkFile hard links dst to src, copying it when the file system refuses,
+// for example across devices. It reports whether it had to copy.
+func linkFile(src, dst string) (bool, error) {
+	if err := os.Link(src, dst); err == nil {
+		return false, nil
+	}
+	return true, copyFile(src, dst)
+}
+
+// symlinkFile creates dst as a relative symlink to src.
+func symlinkFile(src, dst string) error {
+	target, err := filepath.Rel(filepath.Dir(dst), src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+// cloneFile clones src to dst copy-on-write where the file system supports
+// it, and copies it otherwise. It reports whether it had to copy.
+func cloneFile(src, dst string) (bool, error) {
+	cloned, err := reflinkFile(src, dst)
+	if err != nil || cloned {
+		return false, err
+	}
+	return true, copyFile(src, dst)
+}
@@ -0,0 +1,185 @@
+package wtm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyPath(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(src, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "lib", "util.sh"), []byte("util\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("run.sh", filepath.Join(src, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("lib", filepath.Join(src, "lib-link")); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(src, "daemon.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"run.sh", "lib/util.sh", "lib"} {
+		if err := os.Chtimes(filepath.Join(src, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("keeps symlinks, modes and times", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "dst")
+		var skipped []string
+		opts := copyOptions{Skipped: func(path string, mode fs.FileMode) {
+			skipped = append(skipped, filepath.Base(path)+":"+fileKind(mode))
+		}}
+		if err := copyPath(ctx, src, dst, opts); err != nil {
+			t.Fatalf("copyPath failed: %v", err)
+		}
+
+		if target, err := os.Readlink(filepath.Join(dst, "current")); err != nil || target != "run.sh" {
+			t.Errorf("Expected current to stay a symlink to run.sh, got %q, %v", target, err)
+		}
+		if target, err := os.Readlink(filepath.Join(dst, "lib-link")); err != nil || target != "lib" {
+			t.Errorf("Expected lib-link to stay a symlink to lib, got %q, %v", target, err)
+		}
+		for _, name := range []string{"run.sh", "lib/util.sh", "lib"} {
+			info, err := os.Stat(filepath.Join(dst, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(mtime) {
+				t.Errorf("Expected %s to keep its modification time, got %v", name, info.ModTime())
+			}
+		}
+		if info, _ := os.Stat(filepath.Join(dst, "run.sh")); info.Mode().Perm() != 0750 {
+			t.Errorf("Expected run.sh to keep its mode, got %v", info.Mode())
+		}
+		if len(skipped) != 1 || skipped[0] != "daemon.sock:socket" {
+			t.Errorf("Expected the socket to be skipped, got %v", skipped)
+		}
+	})
+
+	t.Run("dereferences symlinks", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "dst")
+		if err := copyPath(ctx, src, dst, copyOptions{Dereference: true}); err != nil {
+			t.Fatalf("copyPath failed: %v", err)
+		}
+		info, err := os.Lstat(filepath.Join(dst, "lib-link"))
+		if err != nil || !info.IsDir() {
+			t.Fatalf("Expected lib-link to be copied as a directory, got %v, %v", info, err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(dst, "lib-link", "util.sh")); string(content) != "util\n" {
+			t.Errorf("Expected the linked directory to be copied, got %q", content)
+		}
+	})
+
+	t.Run("detects symlink cycles", func(t *testing.T) {
+		cyclic := t.TempDir()
+		if err := os.Symlink("..", filepath.Join(cyclic, "parent")); err != nil {
+			t.Fatal(err)
+		}
+		err := copyPath(ctx, cyclic, filepath.Join(t.TempDir(), "dst"), copyOptions{Dereference: true})
+		if err == nil || !strings.Contains(err.Error(), "symlink cycle") {
+			t.Errorf("Expected a cycle error, got: %v", err)
+		}
+	})
+
+	t.Run("replaces files atomically", func(t *testing.T) {
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "run.sh")
+		if err := os.WriteFile(dst, []byte("old content that is longer"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyFile(filepath.Join(src, "run.sh"), dst); err != nil {
+			t.Fatalf("copyFile failed: %v", err)
+		}
+		if content, _ := os.ReadFile(dst); string(content) != "#!/bin/sh\n" {
+			t.Errorf("Expected the file to be replaced, got %q", content)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("Expected no temporary files to be left, got %v", entries)
+		}
+
+		if err := copyFile(filepath.Join(src, "missing"), dst); err == nil {
+			t.Error("Expected an error for a missing source")
+		}
+		if content, _ := os.ReadFile(dst); string(content) != "#!/bin/sh\n" {
+			t.Errorf("Expected a failed copy to leave the file alone, got %q", content)
+		}
+	})
+
+	t.Run("reports progress", func(t *testing.T) {
+		defer func(delay time.Duration) { progressDelay = delay }(progressDelay)
+		progressDelay = 0
+
+		var out bytes.Buffer
+		if err := copyPath(ctx, src, filepath.Join(t.TempDir(), "dst"), copyOptions{Progress: &out}); err != nil {
+			t.Fatalf("copyPath failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		var event progressEvent
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &event); err != nil {
+			t.Fatalf("Expected JSON progress events, got %q: %v", out.String(), err)
+		}
+		if event.Files != 2 || event.TotalFiles != 2 || event.Bytes != event.TotalBytes {
+			t.Errorf("Expected the last event to report the whole copy, got %+v", event)
+		}
+	})
+
+	t.Run("removes partial copies when canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		dst := filepath.Join(t.TempDir(), "dst")
+		if err := copyPath(canceled, src, dst, copyOptions{}); err != context.Canceled {
+			t.Fatalf("Expected the copy to be canceled, got %v", err)
+		}
+		if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+			t.Errorf("Expected the partial copy to be removed, got %v", err)
+		}
+	})
+
+	t.Run("merges into existing directories", func(t *testing.T) {
+		dst := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dst, "local.txt"), []byte("local"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, "run.sh"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyPath(ctx, src, dst, copyOptions{Merge: true}); err != nil {
+			t.Fatalf("copyPath failed: %v", err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(dst, "run.sh")); string(content) != "#!/bin/sh\n" {
+			t.Errorf("Expected run.sh to be replaced, got %q", content)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "local.txt")); err != nil {
+			t.Errorf("Expected local files to be kept: %v", err)
+		}
+
+		job := copyJob{src: filepath.Join(src, "missing"), dst: filepath.Join(dst, "run.sh")}
+		if err := (copyOptions{Merge: true}).copyFile(job); err == nil {
+			t.Error("Expected an error for a missing source")
+		}
+		if content, _ := os.ReadFile(job.dst); string(content) != "#!/bin/sh\n" {
+			t.Errorf("Expected a failed copy to leave run.sh alone, got %q", content)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wtm/pkg/git"
+)
+
+// RootEnv is the environment variable naming the repository commands run
+// against when no explicit path is given.
+const RootEnv = "WTM_ROOT"
+
+// LocationKind identifies the part of a wtm repository a path belongs to.
+type LocationKind string
+
+const (
+	// LocationRoot is the repository root or a directory inside it that is
+	// not part of any worktree, such as tree/ or shared/.
+	LocationRoot LocationKind = "root"
+
+	// LocationWorkspace is the workspace worktree or a directory inside it.
+	LocationWorkspace LocationKind = "workspace"
+
+	// LocationTree is a worktree under tree/ or a directory inside it.
+	LocationTree LocationKind = "tree"
+
+	// LocationWorktree is any other worktree of the repository.
+	LocationWorktree LocationKind = "worktree"
+)
+
+// Location describes where a path sits inside a wtm repository.
+type Location struct {
+	Kind LocationKind
+
+	// Dir is the absolute path discovery started from.
+	Dir string
+
+	// Worktree is the root of the worktree containing Dir. It is empty for
+	// LocationRoot.
+	Worktree string
+}
+
+// Discover finds the wtm repository containing path, which may be the
+// repository root, the workspace, a worktree under tree/ or any directory
+// nested inside them.
+func Discover(path string) (*Repository, Location, error) {
+	return DiscoverWith(path, nil)
+}
+
+// DiscoverWith is like Discover but runs git operations through g. The git
+// executable is used when g is nil.
+func DiscoverWith(path string, g git.Git) (*Repository, Location, error) {
+	ctx := context.Background()
+	r := &Repository{Git: g}
+	g = r.backend()
+
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, Location{}, fmt.Errorf("error resolving path: %w", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, Location{}, fmt.Errorf("not a directory: %s", path)
+	}
+
+	output, err := g.RevParse(ctx, dir, "--path-format=absolute", "--git-common-dir", "--is-bare-repository")
+	if err != nil {
+		return nil, Location{}, fmt.Errorf("not in a git repository: %s", dir)
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) != 2 {
+		return nil, Location{}, fmt.Errorf("unexpected git rev-parse output: %q", output)
+	}
+	commonDir := filepath.Clean(lines[0])
+
+	loc := Location{Kind: LocationRoot, Dir: dir}
+	if lines[1] != "true" {
+		// We're in a worktree; make sure it belongs to a bare repository
+		if isBare, err := g.RevParse(ctx, commonDir, "--is-bare-repository"); err != nil || isBare != "true" {
+			return nil, Location{}, fmt.Errorf("not in a wtm repository: %s is not a bare repository", commonDir)
+		}
+
+		worktree, err := g.RevParse(ctx, dir, "--show-toplevel")
+		if err != nil {
+			return nil, Location{}, fmt.Errorf("error getting worktree root: %w", err)
+		}
+		loc.Worktree = filepath.Clean(worktree)
+	}
+
+	r.Root = layoutRoot(commonDir)
+	r.GitDir = commonDir
+	if loc.Worktree != "" {
+		loc.Kind = worktreeKind(r.Root, loc.Worktree)
+	}
+	return r, loc, nil
+}
+
+// layoutRoot returns the wtm root for a bare repository: its parent when the
+// parent's .git file points at it (the dotbare layout), the repository
+// itself otherwise.
+func layoutRoot(gitDir string) string {
+	parent := filepath.Dir(gitDir)
+	if target, ok := readGitFile(parent); ok && samePath(target, gitDir) {
+		return parent
+	}
+	return gitDir
+}
+
+// samePath reports whether a and b name the same existing file.
+func samePath(a, b string) bool {
+	if a == b {
+		return true
+	}
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// worktreeKind classifies a worktree by its position relative to root.
+func worktreeKind(root, worktree string) LocationKind {
+	rel, err := filepath.Rel(root, worktree)
+	if err != nil {
+		return LocationWorktree
+	}
+	rel = filepath.ToSlash(rel)
+
+	switch {
+	case rel == WorkspaceDir:
+		return LocationWorkspace
+	case strings.HasPrefix(rel, TreeDir+"/"):
+		return LocationTree
+	default:
+		return LocationWorktree
+	}
+}
+
+// TargetWorktree returns the worktree a command started at loc operates on:
+// the enclosing worktree, or the workspace when started outside of any
+// worktree.
+func (r *Repository) TargetWorktree(loc Location) (string, error) {
+	if loc.Worktree != "" {
+		return loc.Worktree, nil
+	}
+
+	workspacePath := r.WorkspacePath()
+	if _, err := os.Stat(workspacePath); err != nil {
+		return "", fmt.Errorf("no workspace found. Run this command from a worktree or create one with 'wtm switch <branch>'")
+	}
+	return workspacePath, nil
+}
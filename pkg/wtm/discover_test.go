@@ -0,0 +1,171 @@
+package wtm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	repo := newTestRepo(t)
+
+	workspacePath := repo.WorkspacePath()
+	runGit(t, repo.Root, "worktree", "add", workspacePath, "main")
+	treePath := repo.TreePath("feature-branch")
+	runGit(t, repo.Root, "worktree", "add", treePath, "feature-branch")
+	otherPath := filepath.Join(repo.Root, "elsewhere")
+	runGit(t, repo.Root, "worktree", "add", "--detach", otherPath, "main")
+
+	nestedPath := filepath.Join(workspacePath, "src", "pkg")
+	if err := os.MkdirAll(nestedPath, 0755); err != nil {
+		t.Fatalf("Failed to create nested directory: %v", err)
+	}
+	sharedPath := filepath.Join(repo.SharedPath(), "config")
+	if err := os.MkdirAll(sharedPath, 0755); err != nil {
+		t.Fatalf("Failed to create shared directory: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		kind     LocationKind
+		worktree string
+	}{
+		{"bare repo root", repo.Root, LocationRoot, ""},
+		{"tree directory", filepath.Join(repo.Root, "tree"), LocationRoot, ""},
+		{"shared subdirectory", sharedPath, LocationRoot, ""},
+		{"workspace", workspacePath, LocationWorkspace, workspacePath},
+		{"nested workspace directory", nestedPath, LocationWorkspace, workspacePath},
+		{"tree worktree", treePath, LocationTree, treePath},
+		{"other worktree", otherPath, LocationWorktree, otherPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, loc, err := Discover(tt.path)
+			if err != nil {
+				t.Fatalf("Discover failed: %v", err)
+			}
+			if found.Root != repo.Root {
+				t.Errorf("Expected root %q, got %q", repo.Root, found.Root)
+			}
+			if loc.Kind != tt.kind {
+				t.Errorf("Expected kind %q, got %q", tt.kind, loc.Kind)
+			}
+			if loc.Worktree != tt.worktree {
+				t.Errorf("Expected worktree %q, got %q", tt.worktree, loc.Worktree)
+			}
+			if loc.Dir != tt.path {
+				t.Errorf("Expected dir %q, got %q", tt.path, loc.Dir)
+			}
+		})
+	}
+
+	t.Run("target worktree defaults to workspace", func(t *testing.T) {
+		_, loc, err := Discover(repo.Root)
+		if err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+		target, err := repo.TargetWorktree(loc)
+		if err != nil || target != workspacePath {
+			t.Errorf("Expected workspace target, got %q (%v)", target, err)
+		}
+
+		_, loc, _ = Discover(treePath)
+		if target, _ := repo.TargetWorktree(loc); target != treePath {
+			t.Errorf("Expected tree worktree target, got %q", target)
+		}
+	})
+}
+
+func TestDiscover_Errors(t *testing.T) {
+	t.Run("error outside a git repository", func(t *testing.T) {
+		_, _, err := Discover(t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "not in a git repository") {
+			t.Errorf("Expected 'not in a git repository' error, got: %v", err)
+		}
+	})
+
+	t.Run("error in a non-bare repository", func(t *testing.T) {
+		repoDir := t.TempDir()
+		runGit(t, repoDir, "init", repoDir)
+
+		_, _, err := Discover(repoDir)
+		if err == nil || !strings.Contains(err.Error(), "not in a wtm repository") {
+			t.Errorf("Expected 'not in a wtm repository' error, got: %v", err)
+		}
+	})
+
+	t.Run("error for missing path", func(t *testing.T) {
+		_, _, err := Discover(filepath.Join(t.TempDir(), "missing"))
+		if err == nil || !strings.Contains(err.Error(), "not a directory") {
+			t.Errorf("Expected 'not a directory' error, got: %v", err)
+		}
+	})
+
+	t.Run("target worktree requires a workspace", func(t *testing.T) {
+		bareDir := t.TempDir()
+		runGit(t, bareDir, "init", "--bare", bareDir)
+
+		repo, loc, err := Discover(bareDir)
+		if err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+		if _, err := repo.TargetWorktree(loc); err == nil || !strings.Contains(err.Error(), "no workspace found") {
+			t.Errorf("Expected 'no workspace found' error, got: %v", err)
+		}
+	})
+}
+
+func TestDiscover_DotBare(t *testing.T) {
+	remoteRepo := newTestRepo(t).Root
+
+	projectDir := filepath.Join(t.TempDir(), "project")
+	runGit(t, filepath.Dir(projectDir), "clone", "--bare", remoteRepo, filepath.Join(projectDir, ".bare"))
+	if err := os.WriteFile(filepath.Join(projectDir, ".git"), []byte("gitdir: ./.bare\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .git file: %v", err)
+	}
+
+	workspacePath := filepath.Join(projectDir, "workspace")
+	runGit(t, projectDir, "worktree", "add", workspacePath, "main")
+	treePath := filepath.Join(projectDir, "tree", "feature-branch")
+	runGit(t, projectDir, "worktree", "add", treePath, "feature-branch")
+	sharedPath := filepath.Join(projectDir, "shared")
+	if err := os.MkdirAll(sharedPath, 0755); err != nil {
+		t.Fatalf("Failed to create shared directory: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		kind LocationKind
+	}{
+		{"project root", projectDir, LocationRoot},
+		{"bare directory", filepath.Join(projectDir, ".bare"), LocationRoot},
+		{"shared directory", sharedPath, LocationRoot},
+		{"workspace", workspacePath, LocationWorkspace},
+		{"tree worktree", treePath, LocationTree},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, loc, err := Discover(tt.path)
+			if err != nil {
+				t.Fatalf("Discover failed: %v", err)
+			}
+			if repo.Root != projectDir {
+				t.Errorf("Expected root %q, got %q", projectDir, repo.Root)
+			}
+			if repo.GitDir != filepath.Join(projectDir, ".bare") {
+				t.Errorf("Expected git dir %q, got %q", filepath.Join(projectDir, ".bare"), repo.GitDir)
+			}
+			if loc.Kind != tt.kind {
+				t.Errorf("Expected kind %q, got %q", tt.kind, loc.Kind)
+			}
+			if repo.Layout() != LayoutDotBare {
+				t.Errorf("Expected dotbare layout, got %q", repo.Layout())
+			}
+		})
+	}
+}
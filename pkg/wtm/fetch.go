@@ -0,0 +1,90 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// deepenStep is the number of commits the first deepening fetch adds. Each
+// further attempt doubles it.
+const deepenStep = 50
+
+var objectNamePattern = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// ensureCommitish makes commitish available locally before a worktree is
+// created for it. In a single-branch clone, branches that were never
+// fetched are fetched from origin; in a shallow clone, history is deepened
+// until a requested commit is reachable.
+func (r *Repository) ensureCommitish(ctx context.Context, commitish string) error {
+	if r.hasCommit(ctx, commitish) || r.hasCommit(ctx, "refs/remotes/origin/"+commitish) {
+		return nil
+	}
+
+	if objectNamePattern.MatchString(commitish) && r.isShallow(ctx) {
+		if err := r.deepen(ctx, commitish); err != nil {
+			return err
+		}
+		if r.hasCommit(ctx, commitish) {
+			return nil
+		}
+	}
+
+	// The branch may not exist on origin either; git worktree add reports
+	// the unknown reference in that case
+	r.fetchBranch(ctx, commitish)
+	return nil
+}
+
+// hasCommit reports whether rev resolves to a commit available locally.
+func (r *Repository) hasCommit(ctx context.Context, rev string) bool {
+	_, err := r.backend().RevParse(ctx, r.gitDir(), "--verify", "--quiet", rev+"^{commit}")
+	return err == nil
+}
+
+// isShallow reports whether the repository has truncated history.
+func (r *Repository) isShallow(ctx context.Context) bool {
+	shallow, err := r.backend().RevParse(ctx, r.gitDir(), "--is-shallow-repository")
+	return err == nil && shallow == "true"
+}
+
+// fetchBranch fetches branch from origin into its remote-tracking branch,
+// using the clone depth when the repository is shallow. The branch is added
+// to the fetch refspecs of a single-branch clone so that later fetches keep
+// it up to date and git worktree add can create a local branch from it.
+func (r *Repository) fetchBranch(ctx context.Context, branch string) {
+	args := []string{"fetch"}
+	if depth, _ := r.configValues(ctx, DepthKey); len(depth) > 0 && r.isShallow(ctx) {
+		args = append(args, "--depth", depth[len(depth)-1])
+	}
+	refspec := "+refs/heads/" + branch + ":refs/remotes/origin/" + branch
+
+	if _, err := r.backend().Output(ctx, r.gitDir(), append(args, "origin", refspec)...); err != nil {
+		return
+	}
+	r.printf("Fetched branch '%s' from origin\n", branch)
+
+	refspecs, _ := r.configValues(ctx, "remote.origin.fetch")
+	if !slices.Contains(refspecs, "+refs/heads/*:refs/remotes/origin/*") {
+		if err := r.ensureFetchRefspec(ctx, "origin", branch); err != nil {
+			r.printf("Warning: %v\n", err)
+		}
+	}
+}
+
+// deepen fetches more history from origin until commit is reachable or the
+// repository is no longer shallow.
+func (r *Repository) deepen(ctx context.Context, commit string) error {
+	for step := deepenStep; r.isShallow(ctx); step *= 2 {
+		r.printf("Commit %s is outside the shallow history, deepening by %d commits...\n", commit, step)
+		if err := r.backend().Run(ctx, r.gitDir(), "fetch", "--deepen="+strconv.Itoa(step), "origin"); err != nil {
+			return fmt.Errorf("error deepening history: %w", err)
+		}
+		if r.hasCommit(ctx, commit) {
+			return nil
+		}
+	}
+	return nil
+}
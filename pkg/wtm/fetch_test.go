@@ -0,0 +1,121 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newShallowRemote returns a file:// URL for a test repository whose main
+// branch has several commits, along with the hash of its first commit.
+func newShallowRemote(t *testing.T) (string, string) {
+	t.Helper()
+	remote := newTestRepo(t)
+	runGit(t, remote.Root, "config", "uploadpack.allowFilter", "true")
+
+	first := runGit(t, remote.Root, "rev-parse", "main")
+	worktree := filepath.Join(t.TempDir(), "main")
+	runGit(t, remote.Root, "worktree", "add", worktree, "main")
+	for _, name := range []string{"one.txt", "two.txt", "three.txt"} {
+		if err := os.WriteFile(filepath.Join(worktree, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, worktree, "add", name)
+		runGit(t, worktree, "commit", "-m", "Add "+name)
+	}
+
+	return "file://" + remote.Root, first
+}
+
+func TestClone_Shallow(t *testing.T) {
+	ctx := context.Background()
+	url, first := newShallowRemote(t)
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	repo, err := Clone(ctx, CloneOptions{URL: url, Dir: cloneDir, Depth: 1, SingleBranch: true, NoSubmodules: true})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if shallow := runGit(t, cloneDir, "rev-parse", "--is-shallow-repository"); shallow != "true" {
+		t.Fatalf("Expected shallow repository, got %q", shallow)
+	}
+	if refspec := runGit(t, cloneDir, "config", "--get-all", "remote.origin.fetch"); refspec != "+refs/heads/main:refs/remotes/origin/main" {
+		t.Errorf("Expected single-branch refspec, got %q", refspec)
+	}
+	if depth := runGit(t, cloneDir, "config", DepthKey); depth != "1" {
+		t.Errorf("Expected depth to be recorded, got %q", depth)
+	}
+	if submodules := runGit(t, cloneDir, "config", SubmodulesKey); submodules != "false" {
+		t.Errorf("Expected submodules to be disabled, got %q", submodules)
+	}
+	if repo.hasCommit(ctx, "feature-branch") || repo.hasCommit(ctx, "origin/feature-branch") {
+		t.Fatal("Expected feature-branch not to be fetched by a single-branch clone")
+	}
+
+	t.Run("checkout fetches missing branch", func(t *testing.T) {
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(path, "feature.txt")); err != nil {
+			t.Errorf("Expected feature-branch content in worktree: %v", err)
+		}
+	})
+
+	t.Run("checkout deepens for old commit", func(t *testing.T) {
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: first})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if head := runGit(t, path, "rev-parse", "HEAD"); head != first {
+			t.Errorf("Expected worktree at %s, got %s", first, head)
+		}
+	})
+}
+
+func TestClone_PartialFilter(t *testing.T) {
+	ctx := context.Background()
+	url, _ := newShallowRemote(t)
+
+	cloneDir := filepath.Join(t.TempDir(), "project")
+	repo, err := Clone(ctx, CloneOptions{URL: url, Dir: cloneDir, Filter: "blob:none"})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if filter := runGit(t, cloneDir, "config", "remote.origin.partialclonefilter"); filter != "blob:none" {
+		t.Errorf("Expected blob:none partial clone filter, got %q", filter)
+	}
+
+	// Blobs are fetched from the promisor remote when the worktree needs them
+	if err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.WorkspacePath(), "feature.txt")); err != nil {
+		t.Errorf("Expected feature-branch content in workspace: %v", err)
+	}
+}
+
+func TestCloneArgs(t *testing.T) {
+	args := cloneArgs(CloneOptions{
+		URL:          "https://example.com/repo.git",
+		Branch:       "dev",
+		Depth:        10,
+		Filter:       "tree:0",
+		SingleBranch: true,
+		NoSubmodules: true,
+	}, "/tmp/repo", "/cache/repo.git")
+
+	expected := []string{"clone", "--bare", "--branch", "dev", "--depth", "10", "--filter=tree:0", "--single-branch", "--reference", "/cache/repo.git", "https://example.com/repo.git", "/tmp/repo"}
+	if len(args) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, args)
+	}
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, args)
+			break
+		}
+	}
+}
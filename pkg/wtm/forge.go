@@ -0,0 +1,115 @@
+package wtm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"wtm/pkg/forge"
+)
+
+const (
+	// ForgeKey is the git config key naming the forge hosting the
+	// repository, github or gitlab. It is detected from the remote URL when
+	// unset.
+	ForgeKey = "wtm.forge"
+
+	// ForgeAPIKey is the git config key overriding the forge REST API base
+	// URL, for self-hosted instances.
+	ForgeAPIKey = "wtm.forgeAPI"
+)
+
+// Forge returns the provider for the forge hosting remote. The API token is
+// read from the environment, see forge.TokenFromEnv.
+func (r *Repository) Forge(ctx context.Context, remote string) (forge.Provider, error) {
+	urls, err := r.configValues(ctx, "remote."+remote+".url")
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("remote %s has no URL", remote)
+	}
+
+	host, project, err := forge.ParseRemoteURL(urls[0])
+	if err != nil {
+		return nil, err
+	}
+
+	kind := forge.DetectKind(host)
+	if configured, err := r.configValues(ctx, ForgeKey); err != nil {
+		return nil, err
+	} else if len(configured) > 0 {
+		kind = forge.Kind(configured[len(configured)-1])
+	}
+	if kind == "" {
+		return nil, fmt.Errorf("cannot tell which forge hosts %s. Set it with 'git config %s github' or 'git config %s gitlab'", host, ForgeKey, ForgeKey)
+	}
+
+	cfg := forge.Config{Kind: kind, Host: host, Project: project, Token: forge.TokenFromEnv(kind)}
+	if baseURL, err := r.configValues(ctx, ForgeAPIKey); err != nil {
+		return nil, err
+	} else if len(baseURL) > 0 {
+		cfg.BaseURL = baseURL[len(baseURL)-1]
+	}
+	return forge.New(cfg)
+}
+
+// AttachPullRequests looks up the pull request of each worktree's branch
+// and stores it in the worktree. Worktrees created by PullRequest are
+// matched by number; other branches by their upstream branch name in the
+// repository of their upstream remote, which may be a fork, or their own
+// name when they have no upstream. A failed lookup leaves its worktree
+// without a pull request and the others are still attached; the failures
+// are returned joined, one per branch.
+func (r *Repository) AttachPullRequests(ctx context.Context, provider forge.Provider, worktrees []Worktree) error {
+	var errs []error
+	for i := range worktrees {
+		wt := &worktrees[i]
+		if wt.Branch == "" {
+			continue
+		}
+
+		var pr *forge.PullRequest
+		var err error
+		if match := prBranchPattern.FindStringSubmatch(wt.Branch); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			pr, err = provider.PullRequest(ctx, n)
+		} else {
+			owner, name := r.headBranch(ctx, wt.Branch)
+			pr, err = provider.PullRequestForBranch(ctx, owner, name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", wt.Branch, err))
+			continue
+		}
+		wt.PullRequest = pr
+	}
+	return errors.Join(errs...)
+}
+
+// headBranch returns the owner of the repository holding branch and the
+// name branch has there: the remote and branch parts of its upstream, or an
+// empty owner and branch itself when it has none. The owner is the namespace
+// of the project the upstream remote points to, such as the user of a fork.
+func (r *Repository) headBranch(ctx context.Context, branch string) (string, string) {
+	upstream, err := r.backend().Output(ctx, r.gitDir(), "rev-parse", "--symbolic-full-name", branch+"@{upstream}")
+	if err != nil {
+		return "", branch
+	}
+	upstream = strings.TrimPrefix(strings.TrimSpace(upstream), "refs/remotes/")
+	remote, name, ok := strings.Cut(upstream, "/")
+	if !ok {
+		return "", branch
+	}
+
+	var owner string
+	if urls, err := r.configValues(ctx, "remote."+remote+".url"); err == nil && len(urls) > 0 {
+		if _, project, err := forge.ParseRemoteURL(urls[0]); err == nil {
+			owner = path.Dir(project)
+		}
+	}
+	return owner, name
+}
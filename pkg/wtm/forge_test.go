@@ -0,0 +1,236 @@
+package wtm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"wtm/pkg/forge"
+)
+
+// stubForge serves pull requests from memory, keyed by branch.
+type stubForge map[string]*forge.PullRequest
+
+func (s stubForge) PullRequest(ctx context.Context, number int) (*forge.PullRequest, error) {
+	for _, pr := range s {
+		if pr.Number == number {
+			return pr, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s stubForge) PullRequestForBranch(ctx context.Context, owner, branch string) (*forge.PullRequest, error) {
+	return s[branch], nil
+}
+
+// failingForge fails the lookups of its branches and otherwise serves stubForge.
+type failingForge struct {
+	stubForge
+	failing map[string]bool
+}
+
+func (f failingForge) PullRequestForBranch(ctx context.Context, owner, branch string) (*forge.PullRequest, error) {
+	if f.failing[branch] {
+		return nil, errors.New("lookup failed")
+	}
+	return f.stubForge.PullRequestForBranch(ctx, owner, branch)
+}
+
+func TestForge(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	if _, err := repo.Forge(ctx, "origin"); err == nil {
+		t.Error("Expected error without origin")
+	}
+
+	runGit(t, repo.GitDir, "remote", "add", "origin", "git@git.example.com:org/repo.git")
+	if _, err := repo.Forge(ctx, "origin"); err == nil {
+		t.Error("Expected error for an unknown forge host")
+	}
+
+	runGit(t, repo.GitDir, "config", ForgeKey, "gitlab")
+	runGit(t, repo.GitDir, "config", ForgeAPIKey, "http://127.0.0.1:1/api/v4")
+	if _, err := repo.Forge(ctx, "origin"); err != nil {
+		t.Errorf("Forge failed with configured forge: %v", err)
+	}
+
+	runGit(t, repo.GitDir, "remote", "add", "alice", "https://github.com/alice/repo.git")
+	runGit(t, repo.GitDir, "update-ref", "refs/remotes/alice/fix", "main")
+	runGit(t, repo.GitDir, "branch", "alice-fix", "main")
+	runGit(t, repo.GitDir, "branch", "--set-upstream-to", "alice/fix", "alice-fix")
+	if owner, name := repo.headBranch(ctx, "alice-fix"); owner != "alice" || name != "fix" {
+		t.Errorf("Expected the head alice:fix, got %s:%s", owner, name)
+	}
+	if owner, name := repo.headBranch(ctx, "main"); owner != "" || name != "main" {
+		t.Errorf("Expected the head :main, got %s:%s", owner, name)
+	}
+}
+
+func TestPruneMergedPRs(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	for _, branch := range []string{"merged", "dirty", "locked", "pr-9", "reused", "unknown"} {
+		runGit(t, repo.GitDir, "branch", branch, "main")
+	}
+	head := runGit(t, repo.GitDir, "rev-parse", "main")
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	for _, branch := range []string{"main", "merged", "dirty", "locked", "pr-9", "reused", "unknown"} {
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: branch}); err != nil {
+			t.Fatalf("Checkout %s failed: %v", branch, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo.TreePath("dirty"), "wip.txt"), []byte("wip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo.GitDir, "worktree", "lock", repo.TreePath("locked"))
+	runGit(t, repo.TreePath("reused"), "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "After the merge")
+
+	provider := stubForge{
+		"feature-branch": {Number: 1, State: forge.StateMerged, HeadSHA: head},
+		"merged":         {Number: 2, State: forge.StateMerged, HeadSHA: head},
+		"dirty":          {Number: 3, State: forge.StateMerged, HeadSHA: head},
+		"locked":         {Number: 7, State: forge.StateMerged, HeadSHA: head},
+		"main":           {Number: 4, State: forge.StateOpen, HeadSHA: head},
+		"reused":         {Number: 5, State: forge.StateMerged, HeadSHA: head},
+		"unknown":        {Number: 6, State: forge.StateMerged},
+		"other":          {Number: 9, State: forge.StateMerged, HeadSHA: head},
+	}
+
+	worktrees, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if err := repo.AttachPullRequests(ctx, provider, worktrees); err != nil {
+		t.Fatalf("AttachPullRequests failed: %v", err)
+	}
+	for _, wt := range worktrees {
+		if wt.Branch == "pr-9" && (wt.PullRequest == nil || wt.PullRequest.Number != 9) {
+			t.Errorf("Expected pr-9 to be matched by number, got %+v", wt.PullRequest)
+		}
+	}
+
+	removed, err := repo.Prune(ctx, PruneOptions{MergedPRs: true, Forge: provider, DryRun: true})
+	if err != nil {
+		t.Fatalf("Prune dry run failed: %v", err)
+	}
+	if len(removed) != 3 {
+		t.Errorf("Expected 3 worktrees to be pruned, got %v", removed)
+	}
+	if _, err := os.Stat(repo.TreePath("merged")); err != nil {
+		t.Errorf("Dry run removed a worktree: %v", err)
+	}
+
+	removed, err = repo.Prune(ctx, PruneOptions{MergedPRs: true, Forge: provider})
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	expected := []string{repo.TreePath("merged"), repo.TreePath("pr-9"), repo.TreePath("unknown")}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("Expected %v to be pruned, got %v", expected, removed)
+	}
+	for _, path := range []string{repo.WorkspacePath(), repo.TreePath("dirty"), repo.TreePath("main"), repo.TreePath("locked"), repo.TreePath("reused")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept: %v", path, err)
+		}
+	}
+	for _, branch := range []string{"merged", "unknown"} {
+		if _, err := repo.backend().RevParse(ctx, repo.GitDir, "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			t.Errorf("Expected branch %s to be deleted", branch)
+		}
+	}
+	if branch, err := repo.backend().CurrentBranch(ctx, repo.TreePath("reused")); err != nil || branch != "reused" {
+		t.Errorf("Expected reused to keep its branch checked out, got %q, %v", branch, err)
+	}
+}
+
+func TestPruneLookupFailure(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	var out bytes.Buffer
+	repo.Stdout = &out
+	runGit(t, repo.GitDir, "branch", "merged", "main")
+	head := runGit(t, repo.GitDir, "rev-parse", "main")
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	for _, branch := range []string{"feature-branch", "merged"} {
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: branch}); err != nil {
+			t.Fatalf("Checkout %s failed: %v", branch, err)
+		}
+	}
+
+	provider := failingForge{
+		stubForge: stubForge{"merged": {Number: 2, State: forge.StateMerged, HeadSHA: head}},
+		failing:   map[string]bool{"feature-branch": true},
+	}
+	removed, err := repo.Prune(ctx, PruneOptions{MergedPRs: true, Forge: provider})
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != repo.TreePath("merged") {
+		t.Errorf("Expected merged to be pruned, got %v", removed)
+	}
+	if !strings.Contains(out.String(), "Warning: could not look up the pull request of feature-branch: lookup failed") {
+		t.Errorf("Expected a warning for feature-branch, got %q", out.String())
+	}
+}
+
+func TestPruneMergedIntoDefaultBranch(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	head := runGit(t, repo.GitDir, "rev-parse", "main")
+	tree := runGit(t, repo.GitDir, "rev-parse", "main^{tree}")
+	commit := func(message string) string {
+		return runGit(t, repo.GitDir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit-tree", tree, "-p", head, "-m", message)
+	}
+
+	// pushed is merged into its upstream but not into main; landed is the
+	// other way around
+	pushed := commit("Pushed after the merge")
+	landed := commit("Landed on main")
+	runGit(t, repo.GitDir, "branch", "pushed", pushed)
+	runGit(t, repo.GitDir, "branch", "landed", landed)
+	runGit(t, repo.GitDir, "remote", "add", "origin", repo.Root)
+	runGit(t, repo.GitDir, "update-ref", "refs/remotes/origin/pushed", pushed)
+	runGit(t, repo.GitDir, "update-ref", "refs/remotes/origin/landed", head)
+	for _, branch := range []string{"pushed", "landed"} {
+		runGit(t, repo.GitDir, "branch", "--set-upstream-to=origin/"+branch, branch)
+	}
+	runGit(t, repo.GitDir, "update-ref", "refs/heads/main", landed)
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	for _, branch := range []string{"pushed", "landed"} {
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: branch}); err != nil {
+			t.Fatalf("Checkout %s failed: %v", branch, err)
+		}
+	}
+
+	// The forge saw neither of the later commits
+	provider := stubForge{
+		"pushed": {Number: 1, State: forge.StateMerged, HeadSHA: head},
+		"landed": {Number: 2, State: forge.StateMerged, HeadSHA: head},
+	}
+	removed, err := repo.Prune(ctx, PruneOptions{MergedPRs: true, Forge: provider})
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != repo.TreePath("landed") {
+		t.Errorf("Expected only landed to be pruned, got %v", removed)
+	}
+	if branch := runGit(t, repo.TreePath("pushed"), "branch", "--show-current"); branch != "pushed" {
+		t.Errorf("Expected pushed to be kept, got branch %q", branch)
+	}
+}
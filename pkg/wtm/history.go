@@ -0,0 +1,539 @@
+package wtm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sharedRef is the hidden ref holding the history of shared storage. Every
+// change to shared/ is committed on it as a snapshot of the whole directory,
+// so git deduplicates the content. It lives outside refs/heads and refs/tags
+// and is therefore never fetched or pushed by the default refspecs.
+const sharedRef = "refs/wtm/shared"
+
+// hashObjectsBatch bounds the number of paths passed to one git hash-object.
+const hashObjectsBatch = 256
+
+// SharedRevision is a snapshot of shared storage.
+type SharedRevision struct {
+	Commit  string
+	Time    time.Time
+	Message string
+}
+
+// SharedHistory returns the snapshots of shared storage that changed path,
+// newest first. The path is relative to the shared directory. It returns
+// nil when no snapshot was recorded yet.
+func (r *Repository) SharedHistory(ctx context.Context, path string) ([]SharedRevision, error) {
+	g := r.backend()
+	if _, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", sharedRef); err != nil {
+		return nil, nil
+	}
+
+	output, err := g.Output(ctx, r.gitDir(), "log", "--format=%H%x00%cI%x00%s", sharedRef, "--", sharedKey(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading shared history: %w", err)
+	}
+
+	var revisions []SharedRevision
+	for line := range strings.Lines(output) {
+		fields := strings.SplitN(strings.TrimSuffix(line, "\n"), "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		when, _ := time.Parse(time.RFC3339, fields[1])
+		revisions = append(revisions, SharedRevision{Commit: fields[0], Time: when, Message: fields[2]})
+	}
+	return revisions, nil
+}
+
+// ShowShared returns the content of path in the snapshot rev. For a
+// directory it lists the files it contained. rev is a commit from
+// SharedHistory, possibly abbreviated, or a suffix such as ~2 counting back
+// from the latest snapshot. An empty rev means the latest snapshot.
+func (r *Repository) ShowShared(ctx context.Context, path, rev string) (string, error) {
+	g := r.backend()
+	commit, err := r.resolveSharedRevision(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+
+	key := sharedKey(path)
+	object := commit + ":" + key
+	kind, err := g.Output(ctx, r.gitDir(), "cat-file", "-t", object)
+	if err != nil {
+		return "", fmt.Errorf("shared/%s does not exist in snapshot %.7s", key, commit)
+	}
+	if strings.TrimSpace(kind) == "tree" {
+		output, err := g.Output(ctx, r.gitDir(), "ls-tree", "-r", "--name-only", object)
+		if err != nil {
+			return "", fmt.Errorf("error listing shared/%s: %w", key, err)
+		}
+		return output, nil
+	}
+
+	output, err := g.Output(ctx, r.gitDir(), "cat-file", "blob", object)
+	if err != nil {
+		return "", fmt.Errorf("error reading shared/%s: %w", key, err)
+	}
+	return output, nil
+}
+
+// RollbackShared replaces path in shared storage with its content in the
+// snapshot rev, updates the manifest and records the rollback as a new
+// snapshot. rev is interpreted as by ShowShared.
+func (r *Repository) RollbackShared(ctx context.Context, path, rev string) error {
+	commit, err := r.resolveSharedRevision(ctx, rev)
+	if err != nil {
+		return err
+	}
+
+	key := sharedKey(path)
+	files, err := r.snapshotFiles(ctx, commit, key)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("shared/%s does not exist in snapshot %.7s", key, commit)
+	}
+
+	r.printf("Rolling back shared/%s to %.7s...\n", key, commit)
+	err = r.replaceShared(key, func(dest string) error {
+		return r.checkoutSnapshot(ctx, files, key, dest)
+	})
+	if err != nil {
+		return err
+	}
+
+	entries, err := r.loadManifest()
+	if err != nil {
+		return err
+	}
+	if entries, err = r.refreshManifest(ctx, entries, key); err != nil {
+		return err
+	}
+	if err := r.saveManifest(entries); err != nil {
+		return err
+	}
+	r.snapshotShared(ctx, key, fmt.Sprintf("Roll back %s to %.7s", key, commit))
+
+	r.printf("Successfully rolled back shared/%s to %.7s\n", key, commit)
+	return nil
+}
+
+// resolveSharedRevision returns the commit rev names. It must be a snapshot
+// of shared storage.
+func (r *Repository) resolveSharedRevision(ctx context.Context, rev string) (string, error) {
+	g := r.backend()
+	if _, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", sharedRef); err != nil {
+		return "", fmt.Errorf("no shared storage history yet")
+	}
+
+	if rev == "" || strings.HasPrefix(rev, "~") || strings.HasPrefix(rev, "^") {
+		rev = sharedRef + rev
+	}
+	commit, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %s. Use 'wtm persist log' to list the snapshots", rev)
+	}
+	if _, err := g.Output(ctx, r.gitDir(), "merge-base", "--is-ancestor", commit, sharedRef); err != nil {
+		return "", fmt.Errorf("%s is not a snapshot of shared storage", rev)
+	}
+	return commit, nil
+}
+
+// snapshotFile is a file or directory recorded in a snapshot.
+type snapshotFile struct {
+	Mode   string
+	Object string
+
+	// Path is relative to the shared directory, with forward slashes.
+	Path string
+}
+
+// snapshotFiles lists key and everything below it in the snapshot commit.
+func (r *Repository) snapshotFiles(ctx context.Context, commit, key string) ([]snapshotFile, error) {
+	output, err := r.backend().Output(ctx, r.gitDir(), "ls-tree", "-r", "-t", "-z", "--full-tree", commit, "--", key)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %.7s: %w", commit, err)
+	}
+
+	var files []snapshotFile
+	for record := range strings.SplitSeq(output, "\x00") {
+		meta, name, ok := strings.Cut(record, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		if name != key && !strings.HasPrefix(name, key+"/") {
+			continue
+		}
+		files = append(files, snapshotFile{Mode: fields[0], Object: fields[2], Path: name})
+	}
+	return files, nil
+}
+
+// checkoutSnapshot writes the snapshot files of key to dest.
+func (r *Repository) checkoutSnapshot(ctx context.Context, files []snapshotFile, key, dest string) error {
+	g := r.backend()
+	for _, file := range files {
+		target := filepath.Join(dest, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(file.Path, key), "/")))
+		if file.Mode == "040000" {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		content, err := g.Output(ctx, r.gitDir(), "cat-file", "blob", file.Object)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file.Path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		switch file.Mode {
+		case "120000":
+			err = os.Symlink(content, target)
+		case "100755":
+			err = os.WriteFile(target, []byte(content), 0755)
+		default:
+			err = os.WriteFile(target, []byte(content), 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshManifest recomputes the manifest entries at, above or below key
+// after key changed in shared storage. Entries that are gone are dropped;
+// key becomes an entry of its own when no entry covers it, in the branch
+// layer its path lies in.
+func (r *Repository) refreshManifest(ctx context.Context, entries []SharedEntry, key string) ([]SharedEntry, error) {
+	covered := false
+	var refreshed []SharedEntry
+	for _, entry := range entries {
+		related := entry.Path == key || strings.HasPrefix(key, entry.Path+"/") || strings.HasPrefix(entry.Path, key+"/")
+		if !related {
+			refreshed = append(refreshed, entry)
+			continue
+		}
+		if entry.Path == key || strings.HasPrefix(key, entry.Path+"/") {
+			covered = true
+		}
+
+		path := r.sharedFile(entry.Path)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Size, entry.SHA256, err = hashPath(path); err != nil {
+			return nil, fmt.Errorf("error hashing shared/%s: %w", entry.Path, err)
+		}
+		entry.IsDir = info.IsDir()
+		entry.Persisted = time.Now().UTC().Truncate(time.Second)
+		refreshed = append(refreshed, entry)
+	}
+
+	if !covered {
+		entry := SharedEntry{Path: key, Layer: r.keyLayer(ctx, entries, key), Persisted: time.Now().UTC().Truncate(time.Second)}
+		path := r.sharedFile(key)
+		var err error
+		if entry.Size, entry.SHA256, err = hashPath(path); err != nil {
+			return nil, fmt.Errorf("error hashing shared/%s: %w", key, err)
+		}
+		if info, err := os.Lstat(path); err == nil {
+			entry.IsDir = info.IsDir()
+		}
+		refreshed = append(refreshed, entry)
+	}
+	return refreshed, nil
+}
+
+// snapshotShared commits the current content of shared storage on the
+// history ref after the slash-separated path key changed. Failing to do so
+// only warns, since shared storage itself has already changed.
+func (r *Repository) snapshotShared(ctx context.Context, key, message string) {
+	if err := r.commitShared(ctx, key, message); err != nil {
+		r.printf("Warning: could not record shared storage history: %v\n", err)
+	}
+}
+
+// commitShared commits the content of shared storage on sharedRef after key
+// changed, unless it is the same as in the latest snapshot.
+func (r *Repository) commitShared(ctx context.Context, key, message string) error {
+	g := r.backend()
+
+	parent, _ := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", sharedRef)
+	tree, err := r.writeSharedTree(ctx, parent, key)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		if previous, _ := g.RevParse(ctx, r.gitDir(), parent+"^{tree}"); previous == tree {
+			return nil
+		}
+		args = append(args, "-p", parent)
+	}
+
+	// A bare repository may have no identity configured; the snapshots are
+	// then attributed to wtm
+	if _, err := g.Output(ctx, r.gitDir(), "var", "GIT_COMMITTER_IDENT"); err != nil {
+		args = append([]string{"-c", "user.name=wtm", "-c", "user.email=wtm@localhost"}, args...)
+	}
+	commit, err := g.Output(ctx, r.gitDir(), args...)
+	if err != nil {
+		return fmt.Errorf("error committing snapshot: %w", err)
+	}
+
+	// An empty old value makes update-ref fail if the ref appeared meanwhile
+	if _, err := g.Output(ctx, r.gitDir(), "update-ref", "-m", "wtm: "+message, sharedRef, strings.TrimSpace(commit), parent); err != nil {
+		return fmt.Errorf("error updating %s: %w", sharedRef, err)
+	}
+	return nil
+}
+
+// treeEntry is an entry of a git tree object.
+type treeEntry struct {
+	Mode   string
+	Name   string
+	Object string
+}
+
+// writeSharedTree writes the content of shared storage into the object
+// database and returns the id of its tree. It only uses commands that take
+// paths, so that the index of the repository is left alone: blobs and trees
+// are written with git hash-object, one batch per directory level.
+//
+// Only the slash-separated path changed and the directories leading to it
+// are hashed. Everything else keeps its object from the snapshot parent, so
+// that the cost of a snapshot follows the size of the change rather than of
+// shared storage; paths the parent does not have are hashed as well. The
+// whole directory is hashed when parent or changed is empty.
+func (r *Repository) writeSharedTree(ctx context.Context, parent, changed string) (string, error) {
+	previous, err := r.previousEntries(ctx, parent, changed)
+	if err != nil {
+		return "", err
+	}
+
+	sharedDir := r.SharedPath()
+	scratch, err := os.MkdirTemp("", "wtm-snapshot-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(scratch)
+
+	type blob struct {
+		dir, name, mode, source string
+	}
+	var blobs []blob
+	trees := map[string][]treeEntry{".": nil}
+
+	if _, err := os.Stat(sharedDir); err == nil {
+		err = filepath.WalkDir(sharedDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(sharedDir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == "." {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".wtm-update-") {
+				return filepath.SkipDir
+			}
+
+			dir, name := path.Dir(rel), path.Base(rel)
+			dirty := rel == changed || strings.HasPrefix(changed, rel+"/") || strings.HasPrefix(rel, changed+"/")
+			if entry, ok := previous[rel]; ok && !dirty && (entry.Mode == "40000") == d.IsDir() {
+				trees[dir] = append(trees[dir], treeEntry{Mode: entry.Mode, Name: name, Object: entry.Object})
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			switch {
+			case d.IsDir():
+				trees[rel] = nil
+			case d.Type()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				source := filepath.Join(scratch, fmt.Sprintf("link-%d", len(blobs)))
+				if err := os.WriteFile(source, []byte(target), 0600); err != nil {
+					return err
+				}
+				blobs = append(blobs, blob{dir, name, "120000", source})
+			case d.Type().IsRegular():
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				mode := "100644"
+				if info.Mode()&0111 != 0 {
+					mode = "100755"
+				}
+				blobs = append(blobs, blob{dir, name, mode, p})
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("error reading shared storage: %w", err)
+		}
+	}
+
+	sources := make([]string, len(blobs))
+	for i, b := range blobs {
+		sources[i] = b.source
+	}
+	ids, err := r.hashObjects(ctx, []string{"--no-filters"}, sources)
+	if err != nil {
+		return "", err
+	}
+	for i, b := range blobs {
+		trees[b.dir] = append(trees[b.dir], treeEntry{Mode: b.mode, Name: b.name, Object: ids[i]})
+	}
+
+	// Write the deepest directories first, so that every tree is complete
+	// when its level is written
+	levels := map[int][]string{}
+	deepest := 0
+	for dir := range trees {
+		depth := 0
+		if dir != "." {
+			depth = strings.Count(dir, "/") + 1
+		}
+		levels[depth] = append(levels[depth], dir)
+		deepest = max(deepest, depth)
+	}
+	for depth := deepest; depth >= 0; depth-- {
+		dirs := levels[depth]
+		sort.Strings(dirs)
+		files := make([]string, len(dirs))
+		for i, dir := range dirs {
+			content, err := encodeTree(trees[dir])
+			if err != nil {
+				return "", err
+			}
+			files[i] = filepath.Join(scratch, fmt.Sprintf("tree-%d-%d", depth, i))
+			if err := os.WriteFile(files[i], content, 0600); err != nil {
+				return "", err
+			}
+		}
+		ids, err := r.hashObjects(ctx, []string{"-t", "tree"}, files)
+		if err != nil {
+			return "", err
+		}
+		if depth == 0 {
+			return ids[0], nil
+		}
+		for i, dir := range dirs {
+			parent := path.Dir(dir)
+			trees[parent] = append(trees[parent], treeEntry{Mode: "40000", Name: path.Base(dir), Object: ids[i]})
+		}
+	}
+	return "", fmt.Errorf("error writing snapshot tree")
+}
+
+// previousEntries returns the entries of the snapshot parent in the
+// directories leading to the slash-separated path changed, keyed by their
+// path. It returns nil when parent or changed is empty.
+func (r *Repository) previousEntries(ctx context.Context, parent, changed string) (map[string]treeEntry, error) {
+	if parent == "" || changed == "" {
+		return nil, nil
+	}
+
+	previous := map[string]treeEntry{}
+	for dir := path.Dir(changed); ; dir = path.Dir(dir) {
+		args := []string{"ls-tree", "-z", "--full-tree", parent}
+		if dir != "." {
+			args = append(args, "--", dir+"/")
+		}
+		output, err := r.backend().Output(ctx, r.gitDir(), args...)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot %.7s: %w", parent, err)
+		}
+		for record := range strings.SplitSeq(output, "\x00") {
+			meta, name, ok := strings.Cut(record, "\t")
+			fields := strings.Fields(meta)
+			if !ok || len(fields) != 3 {
+				continue
+			}
+			// Tree entries are written without the leading zero of the mode
+			previous[name] = treeEntry{Mode: strings.TrimPrefix(fields[0], "0"), Name: path.Base(name), Object: fields[2]}
+		}
+		if dir == "." {
+			return previous, nil
+		}
+	}
+}
+
+// hashObjects writes the files at paths into the object database with git
+// hash-object and the given options and returns their ids in order.
+func (r *Repository) hashObjects(ctx context.Context, options, paths []string) ([]string, error) {
+	var ids []string
+	for batch := range slices.Chunk(paths, hashObjectsBatch) {
+		args := append([]string{"hash-object", "-w"}, options...)
+		args = append(append(args, "--"), batch...)
+		output, err := r.backend().Output(ctx, r.gitDir(), args...)
+		if err != nil {
+			return nil, fmt.Errorf("error writing objects: %w", err)
+		}
+		ids = append(ids, strings.Fields(output)...)
+	}
+	if len(ids) != len(paths) {
+		return nil, fmt.Errorf("error writing objects: expected %d ids, got %d", len(paths), len(ids))
+	}
+	return ids, nil
+}
+
+// encodeTree returns the content of a git tree object with entries, sorted
+// the way git expects: by name, with directories compared as if their name
+// ended in a slash.
+func encodeTree(entries []treeEntry) ([]byte, error) {
+	sortName := func(e treeEntry) string {
+		if e.Mode == "40000" {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool { return sortName(entries[i]) < sortName(entries[j]) })
+
+	var content []byte
+	for _, entry := range entries {
+		id, err := hex.DecodeString(entry.Object)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object id %q", entry.Object)
+		}
+		content = append(content, entry.Mode+" "+entry.Name+"\x00"...)
+		content = append(content, id...)
+	}
+	return content, nil
+}
+
+// sharedKey returns path relative to the shared directory as a clean
+// slash-separated path.
+func sharedKey(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+}
@@ -0,0 +1,163 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSharedHistory(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	workspace := repo.WorkspacePath()
+	envFile := filepath.Join(workspace, ".env")
+
+	if err := os.WriteFile(envFile, []byte("KEY=good\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: ".env"}); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	scripts := filepath.Join(workspace, "scripts")
+	if err := os.MkdirAll(filepath.Join(scripts, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scripts, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scripts, "lib", "util.sh"), []byte("util\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("run.sh", filepath.Join(scripts, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: "scripts"}); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	if err := os.WriteFile(envFile, []byte("KEY=bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.UpdatePersisted(ctx, PersistOptions{Worktree: workspace, Path: ".env"}); err != nil {
+		t.Fatalf("UpdatePersisted failed: %v", err)
+	}
+
+	t.Run("log lists the snapshots that changed a path", func(t *testing.T) {
+		revisions, err := repo.SharedHistory(ctx, ".env")
+		if err != nil {
+			t.Fatalf("SharedHistory failed: %v", err)
+		}
+		if len(revisions) != 2 {
+			t.Fatalf("Expected 2 revisions, got %+v", revisions)
+		}
+		if revisions[0].Message != "Update .env from workspace" || revisions[1].Message != "Persist .env from workspace" {
+			t.Errorf("Unexpected messages %q, %q", revisions[0].Message, revisions[1].Message)
+		}
+		if revisions[0].Time.IsZero() {
+			t.Error("Expected the snapshot time to be parsed")
+		}
+	})
+
+	t.Run("snapshots keep modes", func(t *testing.T) {
+		output := runGit(t, repo.Root, "ls-tree", "-r", sharedRef)
+		for _, want := range []string{"100755 blob", "120000 blob", "scripts/lib/util.sh"} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Expected %q in snapshot:\n%s", want, output)
+			}
+		}
+		runGit(t, repo.Root, "fsck", "--strict", "--no-dangling")
+	})
+
+	t.Run("snapshots only hash what changed", func(t *testing.T) {
+		full, err := repo.writeSharedTree(ctx, "", "")
+		if err != nil {
+			t.Fatalf("writeSharedTree failed: %v", err)
+		}
+		if latest := runGit(t, repo.Root, "rev-parse", sharedRef+"^{tree}"); latest != full {
+			t.Errorf("Expected the incremental snapshot %s to match the full tree %s", latest, full)
+		}
+
+		// A change outside of the changed path is not looked at
+		envBlob := runGit(t, repo.Root, "rev-parse", sharedRef+":.env")
+		if err := os.WriteFile(filepath.Join(repo.SharedPath(), ".env"), []byte("KEY=out-of-band\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.WriteFile(filepath.Join(repo.SharedPath(), ".env"), []byte("KEY=bad\n"), 0644)
+		tree, err := repo.writeSharedTree(ctx, runGit(t, repo.Root, "rev-parse", sharedRef), "scripts/lib/util.sh")
+		if err != nil {
+			t.Fatalf("writeSharedTree failed: %v", err)
+		}
+		if blob := runGit(t, repo.Root, "rev-parse", tree+":.env"); blob != envBlob {
+			t.Errorf("Expected .env to keep its object %s, got %s", envBlob, blob)
+		}
+	})
+
+	t.Run("show prints a previous version", func(t *testing.T) {
+		content, err := repo.ShowShared(ctx, ".env", "~1")
+		if err != nil {
+			t.Fatalf("ShowShared failed: %v", err)
+		}
+		if content != "KEY=good\n" {
+			t.Errorf("Expected the first version, got %q", content)
+		}
+
+		listing, err := repo.ShowShared(ctx, "scripts", "")
+		if err != nil {
+			t.Fatalf("ShowShared failed: %v", err)
+		}
+		if listing != "current\nlib/util.sh\nrun.sh\n" {
+			t.Errorf("Unexpected listing %q", listing)
+		}
+
+		if _, err := repo.ShowShared(ctx, ".env", "main"); err == nil || !strings.Contains(err.Error(), "not a snapshot") {
+			t.Errorf("Expected 'not a snapshot' error, got: %v", err)
+		}
+	})
+
+	t.Run("rollback restores a previous version", func(t *testing.T) {
+		revisions, _ := repo.SharedHistory(ctx, ".env")
+		if err := repo.RollbackShared(ctx, ".env", revisions[1].Commit[:7]); err != nil {
+			t.Fatalf("RollbackShared failed: %v", err)
+		}
+
+		content, _ := os.ReadFile(filepath.Join(repo.SharedPath(), ".env"))
+		if string(content) != "KEY=good\n" {
+			t.Errorf("Expected the first version, got %q", content)
+		}
+		if results, _ := repo.VerifyPersisted(); len(results) != 0 {
+			t.Errorf("Expected the manifest to match after rollback, got %+v", results)
+		}
+		if revisions, _ := repo.SharedHistory(ctx, ".env"); len(revisions) != 3 || !strings.HasPrefix(revisions[0].Message, "Roll back .env") {
+			t.Errorf("Expected the rollback to be recorded, got %+v", revisions)
+		}
+	})
+
+	t.Run("rollback brings back removed entries", func(t *testing.T) {
+		if err := repo.Unpersist(ctx, "scripts"); err != nil {
+			t.Fatalf("Unpersist failed: %v", err)
+		}
+		if err := repo.RollbackShared(ctx, "scripts", "~1"); err != nil {
+			t.Fatalf("RollbackShared failed: %v", err)
+		}
+
+		info, err := os.Lstat(filepath.Join(repo.SharedPath(), "scripts", "run.sh"))
+		if err != nil || info.Mode()&0111 == 0 {
+			t.Errorf("Expected an executable run.sh, got %v, %v", info, err)
+		}
+		if target, err := os.Readlink(filepath.Join(repo.SharedPath(), "scripts", "current")); err != nil || target != "run.sh" {
+			t.Errorf("Expected current to be restored as a symlink, got %q, %v", target, err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(repo.SharedPath(), "scripts", "lib", "util.sh")); string(content) != "util\n" {
+			t.Errorf("Expected lib/util.sh to be restored, got %q", content)
+		}
+		entries, _ := repo.loadManifest()
+		if i := manifestEntry(entries, "scripts"); i < 0 || !entries[i].IsDir {
+			t.Errorf("Expected scripts to be back in the manifest, got %+v", entries)
+		}
+	})
+}
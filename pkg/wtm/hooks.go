@@ -0,0 +1,47 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// PostCheckoutHookKey is the git config key listing shell commands to run
+// inside a worktree after wtm creates it. It may be set more than once and
+// is read from the repository as well as the global git config.
+const PostCheckoutHookKey = "wtm.postCheckout"
+
+// RunPostCheckoutHooks runs every command configured in wtm.postCheckout
+// inside worktree, in order, stopping at the first failure. The commands
+// see WTM_ROOT and WTM_WORKTREE in their environment.
+func (r *Repository) RunPostCheckoutHooks(ctx context.Context, worktree string) error {
+	hooks, err := r.configValues(ctx, PostCheckoutHookKey)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		r.printf("Running post-checkout hook: %s\n", hook)
+
+		cmd := shellCommand(ctx, hook)
+		cmd.Dir = worktree
+		cmd.Env = append(os.Environ(), RootEnv+"="+r.Root, "WTM_WORKTREE="+worktree)
+		cmd.Stdout = r.stdout()
+		cmd.Stderr = r.stderr()
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("post-checkout hook %q failed: %w", hook, err)
+		}
+	}
+
+	return nil
+}
+
+// shellCommand returns a command running script with the platform shell.
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", script)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", script)
+}
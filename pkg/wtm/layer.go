@@ -0,0 +1,169 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// BranchesDir is the directory of shared storage holding the branch layers.
+// The entries of BranchesDir/<branch>/ are restored in the worktrees of that
+// branch over the common entries of shared/: an entry of the layer replaces
+// the common entry at the same path, and is restored over the common entry
+// containing it.
+const BranchesDir = "@branches"
+
+// BranchPath returns the slash-separated path in shared storage of the
+// entry at path in the layer of branch, or path itself when branch is empty.
+func BranchPath(branch, path string) string {
+	if branch == "" {
+		return path
+	}
+	return BranchesDir + "/" + branch + "/" + path
+}
+
+// Key returns the path of the entry within its layer, the path it is
+// restored at.
+func (e SharedEntry) Key() string {
+	if e.Layer == "" {
+		return e.Path
+	}
+	return strings.TrimPrefix(e.Path, BranchesDir+"/"+e.Layer+"/")
+}
+
+// keyLayer returns the branch whose layer holds the shared path key, the
+// reverse of BranchPath, or an empty string for a common entry. Since branch
+// names may contain slashes, the layers of entries and then the local
+// branches are tried, longest first, before the first path segment.
+func (r *Repository) keyLayer(ctx context.Context, entries []SharedEntry, key string) string {
+	rest, ok := strings.CutPrefix(key, BranchesDir+"/")
+	if !ok {
+		return ""
+	}
+	segments := strings.Split(rest, "/")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	var candidates []string
+	for i := len(segments) - 1; i >= 1; i-- {
+		candidates = append(candidates, strings.Join(segments[:i], "/"))
+	}
+	for _, branch := range candidates {
+		if slices.ContainsFunc(entries, func(entry SharedEntry) bool { return entry.Layer == branch }) {
+			return branch
+		}
+	}
+	for _, branch := range candidates {
+		if r.hasCommit(ctx, "refs/heads/"+branch) {
+			return branch
+		}
+	}
+	return segments[0]
+}
+
+// persistKey returns the path in shared storage the worktree path relPath
+// is persisted at, in the layer of opts.Branch, and the branch of that layer.
+func (r *Repository) persistKey(ctx context.Context, opts PersistOptions, relPath string) (string, string, error) {
+	branch := opts.Branch
+	if branch == "HEAD" {
+		current, err := r.backend().CurrentBranch(ctx, opts.Worktree)
+		if err != nil {
+			return "", "", fmt.Errorf("error getting current branch: %w", err)
+		}
+		if current == "" {
+			return "", "", fmt.Errorf("%s is not on a branch", opts.Worktree)
+		}
+		branch = current
+	}
+	if branch != "" && (path.Clean(branch) != branch || branch == ".." || strings.HasPrefix(branch, "../") || path.IsAbs(branch)) {
+		return "", "", fmt.Errorf("invalid branch name %q", branch)
+	}
+	return BranchPath(branch, filepath.ToSlash(relPath)), branch, nil
+}
+
+// worktreeLayer returns the branch whose layer is restored in worktree, or
+// an empty string when it has none.
+func (r *Repository) worktreeLayer(ctx context.Context, worktree string) string {
+	branch, err := r.backend().CurrentBranch(ctx, worktree)
+	if err != nil || branch == "" {
+		return ""
+	}
+	if info, err := os.Stat(r.sharedFile(BranchPath(branch, ""))); err != nil || !info.IsDir() {
+		return ""
+	}
+	return branch
+}
+
+// layeredMatches returns the entries selected by rules in the common layer
+// of shared storage and in the layer of branch, in lexical order. A match of
+// the branch layer replaces the common matches at or below its path; one
+// inside a common match is restored after it, as an overlay.
+//
+// The common layer is matched against the tree of shared/, the branch layer
+// against its manifest entries, since its directories only lead to them.
+func (r *Repository) layeredMatches(branch string, rules []PersistRule) ([]ruleMatch, error) {
+	matches, err := matchTree(r.SharedPath(), rules)
+	if err != nil {
+		return nil, fmt.Errorf("error matching persisted files: %w", err)
+	}
+	if branch == "" {
+		return matches, nil
+	}
+
+	entries, err := r.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Layer != branch {
+			continue
+		}
+		key := entry.Key()
+		rule := selectingRule(rules, key)
+		if rule == nil || rule.Exclude {
+			continue
+		}
+
+		matches = slices.DeleteFunc(matches, func(match ruleMatch) bool {
+			return match.Path == key || strings.HasPrefix(match.Path, key+"/")
+		})
+		overlay := slices.ContainsFunc(matches, func(match ruleMatch) bool {
+			return strings.HasPrefix(key, match.Path+"/")
+		})
+		matches = append(matches, ruleMatch{Path: key, Mode: rule.Mode, Layer: branch, Overlay: overlay})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	return matches, nil
+}
+
+// selectingRule returns the rule deciding whether the slash-separated path
+// is selected: the last rule matching it or, failing that, its closest
+// parent directory.
+func selectingRule(rules []PersistRule, name string) *PersistRule {
+	for {
+		if rule := lastMatch(rules, name); rule != nil {
+			return rule
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return nil
+		}
+		name = name[:i]
+	}
+}
+
+// removeEmptyLayerDirs removes the directories of the branch layers left
+// empty above the shared path key.
+func (r *Repository) removeEmptyLayerDirs(key string) {
+	for dir := path.Dir(key); strings.HasPrefix(dir, BranchesDir); dir = path.Dir(dir) {
+		if os.Remove(r.sharedFile(dir)) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBranchLayers(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	workspace := repo.WorkspacePath()
+	feature, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	write := func(root, name, content string) {
+		t.Helper()
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(root, name string) string {
+		t.Helper()
+		content, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		return string(content)
+	}
+
+	write(workspace, ".env", "DB=main")
+	write(workspace, "config/app.yml", "app")
+	write(workspace, "config/db.yml", "db=main")
+	for _, path := range []string{".env", "config"} {
+		if _, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: path}); err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+	}
+
+	write(feature, ".env", "DB=feature")
+	write(feature, "config/db.yml", "db=feature")
+	for _, path := range []string{".env", "config/db.yml"} {
+		if _, err := repo.Persist(ctx, PersistOptions{Worktree: feature, Path: path, Branch: "HEAD"}); err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+	}
+
+	t.Run("persists to the branch layer", func(t *testing.T) {
+		if got := read(repo.SharedPath(), "@branches/feature-branch/.env"); got != "DB=feature" {
+			t.Errorf("Expected the layer to hold .env, got %q", got)
+		}
+		if got := read(repo.SharedPath(), ".env"); got != "DB=main" {
+			t.Errorf("Expected the common .env to be kept, got %q", got)
+		}
+
+		entries, err := repo.Persisted(ctx)
+		if err != nil {
+			t.Fatalf("Persisted failed: %v", err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Layer+":"+entry.Key())
+		}
+		want := []string{":.env", "feature-branch:.env", "feature-branch:config/db.yml", ":config"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected entries %v, got %v", want, got)
+		}
+	})
+
+	t.Run("restores the most specific layer", func(t *testing.T) {
+		for _, path := range []string{".env", "config"} {
+			os.RemoveAll(filepath.Join(feature, path))
+		}
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: feature, All: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		for name, want := range map[string]string{".env": "DB=feature", "config/app.yml": "app", "config/db.yml": "db=feature"} {
+			if got := read(feature, name); got != want {
+				t.Errorf("Expected %s to be %q, got %q", name, want, got)
+			}
+		}
+	})
+
+	t.Run("restores a single path with its overlays", func(t *testing.T) {
+		os.RemoveAll(filepath.Join(feature, "config"))
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: feature, Path: "config"}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if got := read(feature, "config/db.yml"); got != "db=feature" {
+			t.Errorf("Expected the overlay to be restored, got %q", got)
+		}
+	})
+
+	t.Run("keeps overlays changed in the worktree", func(t *testing.T) {
+		write(feature, "config/db.yml", "db=local")
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: feature, All: true}); err == nil {
+			t.Error("Expected restoring over existing files to fail without --force")
+		}
+		if got := read(feature, "config/db.yml"); got != "db=local" {
+			t.Errorf("Expected the changed overlay to be kept, got %q", got)
+		}
+
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: feature, All: true, Force: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if got := read(feature, "config/db.yml"); got != "db=feature" {
+			t.Errorf("Expected --force to restore the overlay, got %q", got)
+		}
+	})
+
+	t.Run("other branches only see common entries", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, All: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if got := read(worktree, "config/db.yml"); got != "db=main" {
+			t.Errorf("Expected the common config, got %q", got)
+		}
+	})
+
+	t.Run("refuses to write through links", func(t *testing.T) {
+		os.RemoveAll(filepath.Join(feature, "config"))
+		err := repo.Restore(ctx, RestoreOptions{Worktree: feature, Path: "config", Mode: RestoreLink})
+		if err == nil {
+			t.Fatal("Expected restoring the overlay into a linked directory to fail")
+		}
+		if got := read(repo.SharedPath(), "config/db.yml"); got != "db=main" {
+			t.Errorf("Expected the common entry to be left alone, got %q", got)
+		}
+	})
+
+	t.Run("removing the last entry of a layer removes its directory", func(t *testing.T) {
+		for _, path := range []string{"@branches/feature-branch/.env", "@branches/feature-branch/config/db.yml"} {
+			if err := repo.Unpersist(ctx, path); err != nil {
+				t.Fatalf("Unpersist failed: %v", err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(repo.SharedPath(), BranchesDir)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", BranchesDir, err)
+		}
+	})
+
+	t.Run("rolls back a removed layer entry", func(t *testing.T) {
+		key := "@branches/feature-branch/.env"
+		revisions, err := repo.SharedHistory(ctx, key)
+		if err != nil || len(revisions) < 2 {
+			t.Fatalf("Expected the entry in the history, got %+v, %v", revisions, err)
+		}
+		if err := repo.RollbackShared(ctx, key, revisions[1].Commit); err != nil {
+			t.Fatalf("RollbackShared failed: %v", err)
+		}
+
+		entries, err := repo.Persisted(ctx)
+		if err != nil {
+			t.Fatalf("Persisted failed: %v", err)
+		}
+		i := manifestEntry(entries, key)
+		if i < 0 || entries[i].Layer != "feature-branch" || entries[i].Key() != ".env" {
+			t.Fatalf("Expected the entry back in the feature-branch layer, got %+v", entries)
+		}
+
+		os.Remove(filepath.Join(feature, ".env"))
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: feature, Path: ".env"}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if got := read(feature, ".env"); got != "DB=feature" {
+			t.Errorf("Expected the layer entry to be restored, got %q", got)
+		}
+	})
+}
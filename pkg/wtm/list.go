@@ -0,0 +1,91 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"wtm/pkg/forge"
+	"wtm/pkg/git"
+)
+
+// Worktree describes a worktree registered with the bare repository.
+type Worktree struct {
+	git.Worktree
+
+	// Review is set for read-only review worktrees created by Review.
+	Review bool
+
+	// Expires is when a review worktree becomes eligible for pruning. It is
+	// zero when the worktree does not expire.
+	Expires time.Time
+
+	// Metadata holds the note, labels and ticket of the worktree.
+	Metadata Metadata
+
+	// PullRequest is the pull request of the worktree's branch. It is only
+	// set by AttachPullRequests.
+	PullRequest *forge.PullRequest
+}
+
+// List returns the worktrees of the repository, excluding the bare
+// repository itself.
+func (r *Repository) List(ctx context.Context) ([]Worktree, error) {
+	entries, err := r.backend().WorktreeList(ctx, r.gitDir())
+	if err != nil {
+		return nil, fmt.Errorf("error listing worktrees: %w", err)
+	}
+
+	metadata, err := r.loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	var worktrees []Worktree
+	for _, entry := range entries {
+		if entry.Bare {
+			continue
+		}
+		wt := Worktree{Worktree: entry, Metadata: metadata[r.metadataKey(entry.Path)]}
+		wt.Expires, wt.Review = reviewExpiry(entry.Path)
+		worktrees = append(worktrees, wt)
+	}
+	return worktrees, nil
+}
+
+// FilterLabels returns the worktrees carrying every label in labels.
+func FilterLabels(worktrees []Worktree, labels ...string) []Worktree {
+	var filtered []Worktree
+	for _, wt := range worktrees {
+		if wt.Metadata.HasLabels(labels...) {
+			filtered = append(filtered, wt)
+		}
+	}
+	return filtered
+}
+
+// ResolveWorktree finds the worktree named by name, which may be a path,
+// a path relative to the root such as workspace or tree/<name>, the name of
+// a worktree under tree/, or the branch checked out in a worktree.
+func (r *Repository) ResolveWorktree(ctx context.Context, name string) (string, error) {
+	worktrees, err := r.List(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{name, filepath.Join(r.Root, name), r.TreePath(name)}
+	for _, candidate := range candidates {
+		for _, wt := range worktrees {
+			if samePath(candidate, wt.Path) {
+				return wt.Path, nil
+			}
+		}
+	}
+	for _, wt := range worktrees {
+		if wt.Branch == name {
+			return wt.Path, nil
+		}
+	}
+	return "", fmt.Errorf("no worktree named %s. Use 'wtm list' to see the worktrees", name)
+}
@@ -0,0 +1,43 @@
+package wtm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	worktrees, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(worktrees) != 0 {
+		t.Fatalf("Expected no worktrees, got %d", len(worktrees))
+	}
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	runGit(t, repo.Root, "worktree", "add", "--detach", repo.TreePath("detached"), "main")
+
+	worktrees, err = repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(worktrees) != 2 {
+		t.Fatalf("Expected 2 worktrees, got %d: %+v", len(worktrees), worktrees)
+	}
+
+	byPath := map[string]Worktree{}
+	for _, wt := range worktrees {
+		byPath[wt.Path] = wt
+	}
+	if wt := byPath[repo.WorkspacePath()]; wt.Branch != "main" || wt.Detached {
+		t.Errorf("Unexpected workspace entry: %+v", wt)
+	}
+	if wt := byPath[repo.TreePath("detached")]; !wt.Detached || wt.Branch != "" {
+		t.Errorf("Unexpected detached entry: %+v", wt)
+	}
+}
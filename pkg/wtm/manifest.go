@@ -0,0 +1,244 @@
+package wtm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Problems reported by Repository.VerifyPersisted.
+const (
+	// VerifyMissing means a manifest entry is gone from shared storage.
+	VerifyMissing = "missing"
+
+	// VerifyModified means the content no longer matches the recorded hash.
+	VerifyModified = "modified"
+
+	// VerifyUnmanaged means shared storage holds a path the manifest does
+	// not know about, for example one copied there by hand.
+	VerifyUnmanaged = "not in manifest"
+)
+
+// VerifyResult is a problem found by Repository.VerifyPersisted.
+type VerifyResult struct {
+	// Path is relative to the shared directory, with forward slashes.
+	Path    string
+	Problem string
+}
+
+// VerifyPersisted compares shared storage with the manifest and reports
+// entries that are missing or were modified outside of wtm, and paths that
+// are not in the manifest. It returns no results when everything matches.
+func (r *Repository) VerifyPersisted() ([]VerifyResult, error) {
+	entries, err := r.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []VerifyResult
+	for _, entry := range entries {
+		_, sum, err := hashPath(r.sharedFile(entry.Path))
+		switch {
+		case os.IsNotExist(err):
+			results = append(results, VerifyResult{Path: entry.Path, Problem: VerifyMissing})
+		case err != nil:
+			return nil, fmt.Errorf("error hashing shared/%s: %w", entry.Path, err)
+		case sum != entry.SHA256:
+			results = append(results, VerifyResult{Path: entry.Path, Problem: VerifyModified})
+		}
+	}
+
+	unmanaged, err := r.unmanagedPaths(entries)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range unmanaged {
+		results = append(results, VerifyResult{Path: path, Problem: VerifyUnmanaged})
+	}
+	return results, nil
+}
+
+// manifestPath returns the file recording the entries of shared storage.
+func (r *Repository) manifestPath() string {
+	return filepath.Join(r.gitDir(), "wtm", "shared.json")
+}
+
+// loadManifest reads the manifest entries, sorted by path. It returns nil
+// when nothing was persisted yet.
+func (r *Repository) loadManifest() ([]SharedEntry, error) {
+	content, err := os.ReadFile(r.manifestPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading shared manifest: %w", err)
+	}
+
+	var entries []SharedEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing shared manifest %s: %w", r.manifestPath(), err)
+	}
+	return entries, nil
+}
+
+// saveManifest atomically replaces the manifest with entries.
+func (r *Repository) saveManifest(entries []SharedEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	if entries == nil {
+		entries = []SharedEntry{}
+	}
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.manifestPath(), append(content, '\n')); err != nil {
+		return fmt.Errorf("error writing shared manifest: %w", err)
+	}
+	return nil
+}
+
+// manifestEntry returns the index of the entry for path in entries, or -1.
+func manifestEntry(entries []SharedEntry, path string) int {
+	for i, entry := range entries {
+		if entry.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// sharedFile returns the location in shared storage of the slash-separated
+// relative path.
+func (r *Repository) sharedFile(path string) string {
+	return filepath.Join(r.SharedPath(), filepath.FromSlash(path))
+}
+
+// unmanagedPaths returns the outermost paths in shared storage that are
+// neither manifest entries nor directories leading to one.
+func (r *Repository) unmanagedPaths(entries []SharedEntry) ([]string, error) {
+	sharedDir := r.SharedPath()
+	if _, err := os.Stat(sharedDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	managed := map[string]bool{}
+	for _, entry := range entries {
+		managed[entry.Path] = true
+	}
+	leadsToEntry := func(dir string) bool {
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Path, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var paths []string
+	err := filepath.WalkDir(sharedDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == sharedDir {
+			return nil
+		}
+		rel, err := filepath.Rel(sharedDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case managed[rel]:
+		case d.IsDir() && leadsToEntry(rel):
+			return nil
+		default:
+			paths = append(paths, rel)
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing shared files: %w", err)
+	}
+	return paths, nil
+}
+
+// hashPath returns the total size of the regular files at path and a
+// SHA-256 digest of its content. A file hashes to the digest of its bytes; a
+// directory to the digest of the paths, symlink targets and file digests it
+// contains, so renames and added or removed files change it too.
+func hashPath(path string) (int64, string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, "", err
+	}
+	if info.Mode().IsRegular() {
+		sum, err := hashFile(path)
+		return info.Size(), sum, err
+	}
+
+	var size int64
+	h := sha256.New()
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %s %s\n", rel, target)
+		case d.IsDir():
+			fmt.Fprintf(h, "dir %s\n", rel)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			sum, err := hashFile(p)
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			fmt.Fprintf(h, "file %s %s\n", rel, sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile returns the hex SHA-256 digest of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
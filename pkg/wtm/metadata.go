@@ -0,0 +1,171 @@
+package wtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Metadata is the information wtm keeps about a worktree outside of its
+// working tree: why it exists and how it is categorized.
+type Metadata struct {
+	Note   string   `json:"note,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+
+	// Ticket is the URL of the issue or ticket the worktree is for.
+	Ticket string `json:"ticket,omitempty"`
+}
+
+// IsZero reports whether m holds no information.
+func (m Metadata) IsZero() bool {
+	return m.Note == "" && len(m.Labels) == 0 && m.Ticket == ""
+}
+
+// HasLabels reports whether m carries every label in labels.
+func (m Metadata) HasLabels(labels ...string) bool {
+	for _, label := range labels {
+		if !slices.Contains(m.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// Metadata returns the metadata of the worktree at path.
+func (r *Repository) Metadata(path string) (Metadata, error) {
+	all, err := r.loadMetadata()
+	if err != nil {
+		return Metadata{}, err
+	}
+	return all[r.metadataKey(path)], nil
+}
+
+// UpdateMetadata applies update to the metadata of the worktree at path and
+// saves the result.
+func (r *Repository) UpdateMetadata(path string, update func(*Metadata)) error {
+	all, err := r.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	key := r.metadataKey(path)
+	m := all[key]
+	update(&m)
+	slices.Sort(m.Labels)
+	m.Labels = slices.Compact(m.Labels)
+
+	if m.IsZero() {
+		delete(all, key)
+	} else {
+		all[key] = m
+	}
+	return r.saveMetadata(all)
+}
+
+// AddLabels adds labels to the worktree at path.
+func (r *Repository) AddLabels(path string, labels ...string) error {
+	return r.UpdateMetadata(path, func(m *Metadata) {
+		m.Labels = append(m.Labels, labels...)
+	})
+}
+
+// RemoveLabels removes labels from the worktree at path.
+func (r *Repository) RemoveLabels(path string, labels ...string) error {
+	return r.UpdateMetadata(path, func(m *Metadata) {
+		m.Labels = slices.DeleteFunc(m.Labels, func(label string) bool {
+			return slices.Contains(labels, label)
+		})
+	})
+}
+
+// moveMetadata re-keys the metadata of the worktree at src to dst.
+func (r *Repository) moveMetadata(src, dst string) error {
+	all, err := r.loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	srcKey := r.metadataKey(src)
+	m, ok := all[srcKey]
+	if !ok {
+		return nil
+	}
+	delete(all, srcKey)
+	all[r.metadataKey(dst)] = m
+	return r.saveMetadata(all)
+}
+
+// deleteMetadata drops the metadata of the worktree at path.
+func (r *Repository) deleteMetadata(path string) error {
+	return r.UpdateMetadata(path, func(m *Metadata) { *m = Metadata{} })
+}
+
+// metadataPath returns the file holding the metadata of all worktrees.
+func (r *Repository) metadataPath() string {
+	return filepath.Join(r.gitDir(), "wtm", "worktrees.json")
+}
+
+// metadataKey returns the key of the worktree at path: its path relative to
+// the root, or the absolute path for worktrees outside of it.
+func (r *Repository) metadataKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(r.Root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return abs
+}
+
+// loadMetadata reads the metadata of all worktrees, keyed by metadataKey.
+func (r *Repository) loadMetadata() (map[string]Metadata, error) {
+	all := map[string]Metadata{}
+
+	content, err := os.ReadFile(r.metadataPath())
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading worktree metadata: %w", err)
+	}
+	if err := json.Unmarshal(content, &all); err != nil {
+		return nil, fmt.Errorf("error parsing worktree metadata %s: %w", r.metadataPath(), err)
+	}
+	return all, nil
+}
+
+// saveMetadata atomically replaces the metadata of all worktrees.
+func (r *Repository) saveMetadata(all map[string]Metadata) error {
+	content, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.metadataPath(), append(content, '\n'))
+}
+
+// writeFileAtomic writes content to a temporary file next to path and
+// renames it over path, creating the parent directory when needed.
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
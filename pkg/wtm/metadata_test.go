@@ -0,0 +1,111 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	workspace := repo.WorkspacePath()
+
+	t.Run("note, labels and ticket", func(t *testing.T) {
+		err := repo.UpdateMetadata(workspace, func(m *Metadata) {
+			m.Note = "release prep"
+			m.Ticket = "https://tracker.example.com/PROJ-1"
+		})
+		if err != nil {
+			t.Fatalf("UpdateMetadata failed: %v", err)
+		}
+		if err := repo.AddLabels(workspace, "hotfix", "blocked", "hotfix"); err != nil {
+			t.Fatalf("AddLabels failed: %v", err)
+		}
+
+		m, err := repo.Metadata(workspace)
+		if err != nil {
+			t.Fatalf("Metadata failed: %v", err)
+		}
+		want := Metadata{Note: "release prep", Labels: []string{"blocked", "hotfix"}, Ticket: "https://tracker.example.com/PROJ-1"}
+		if !reflect.DeepEqual(m, want) {
+			t.Errorf("Expected %+v, got %+v", want, m)
+		}
+
+		if err := repo.RemoveLabels(workspace, "blocked"); err != nil {
+			t.Fatalf("RemoveLabels failed: %v", err)
+		}
+		if m, _ := repo.Metadata(workspace); !reflect.DeepEqual(m.Labels, []string{"hotfix"}) {
+			t.Errorf("Expected labels [hotfix], got %v", m.Labels)
+		}
+	})
+
+	t.Run("listed and filtered", func(t *testing.T) {
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"}); err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+
+		worktrees, err := repo.List(ctx)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		labeled := FilterLabels(worktrees, "hotfix")
+		if len(labeled) != 1 || !samePath(labeled[0].Path, workspace) {
+			t.Fatalf("Expected only the workspace to be labeled, got %+v", labeled)
+		}
+		if labeled[0].Metadata.Note != "release prep" {
+			t.Errorf("Expected note in listing, got %+v", labeled[0].Metadata)
+		}
+	})
+
+	t.Run("moves with switch", func(t *testing.T) {
+		if err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+
+		moved, err := repo.Metadata(repo.TreePath("main"))
+		if err != nil {
+			t.Fatalf("Metadata failed: %v", err)
+		}
+		if moved.Note != "release prep" {
+			t.Errorf("Expected metadata to move to tree/main, got %+v", moved)
+		}
+		if m, _ := repo.Metadata(workspace); !m.IsZero() {
+			t.Errorf("Expected no metadata on the new workspace, got %+v", m)
+		}
+	})
+
+	t.Run("resolve worktree", func(t *testing.T) {
+		for _, name := range []string{"main", "tree/main", repo.TreePath("main")} {
+			path, err := repo.ResolveWorktree(ctx, name)
+			if err != nil {
+				t.Fatalf("ResolveWorktree(%q) failed: %v", name, err)
+			}
+			if !samePath(path, repo.TreePath("main")) {
+				t.Errorf("ResolveWorktree(%q) = %q", name, path)
+			}
+		}
+		if _, err := repo.ResolveWorktree(ctx, "missing"); err == nil {
+			t.Error("Expected error for unknown worktree")
+		}
+	})
+
+	t.Run("cleared entries are dropped", func(t *testing.T) {
+		path := repo.TreePath("main")
+		if err := repo.UpdateMetadata(path, func(m *Metadata) { *m = Metadata{} }); err != nil {
+			t.Fatalf("UpdateMetadata failed: %v", err)
+		}
+		content, err := os.ReadFile(repo.metadataPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "{}\n" {
+			t.Errorf("Expected empty metadata file, got %s", content)
+		}
+	})
+}
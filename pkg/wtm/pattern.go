@@ -0,0 +1,272 @@
+package wtm
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PersistFile is the name of the file declaring what is persisted. It is
+// read from the root of a worktree, where it can be committed, and from the
+// bare repository root, whose rules come last.
+const PersistFile = ".wtmpersist"
+
+// PersistRule is a pattern selecting paths to persist or restore.
+//
+// Patterns are slash-separated and relative to the worktree root, or to
+// shared/ when restoring. Each segment may use the wildcards of path.Match;
+// a ** segment matches any number of directories, including none. As in
+// .gitignore files, the last rule matching a path decides whether it is
+// selected. A matched directory is selected as a whole unless an exclusion
+// applies inside it.
+type PersistRule struct {
+	Pattern string
+
+	// Exclude deselects the paths the pattern matches.
+	Exclude bool
+
+	// Mode is how the matched paths are restored. Empty means the mode
+	// recorded for the entry, or copy.
+	Mode RestoreMode
+}
+
+// IsPattern reports whether path contains wildcards and is therefore matched
+// rather than taken literally.
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// EscapePattern returns a pattern matching the literal path name.
+func EscapePattern(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// NewPersistRules returns the rules selecting the paths matching patterns,
+// except those matching excludes, restored in mode.
+func NewPersistRules(patterns, excludes []string, mode RestoreMode) ([]PersistRule, error) {
+	var rules []PersistRule
+	for _, pattern := range patterns {
+		rules = append(rules, PersistRule{Pattern: pattern, Mode: mode})
+	}
+	for _, pattern := range excludes {
+		rules = append(rules, PersistRule{Pattern: pattern, Exclude: true})
+	}
+	for i := range rules {
+		pattern, err := cleanPattern(rules[i].Pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules[i].Pattern = pattern
+	}
+	if err := mode.validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// PersistRules returns the rules declared by the .wtmpersist files of the
+// worktree and of the bare repository root, in that order. It returns nil
+// when neither exists.
+func (r *Repository) PersistRules(worktree string) ([]PersistRule, error) {
+	var rules []PersistRule
+	for _, file := range []string{filepath.Join(worktree, PersistFile), filepath.Join(r.Root, PersistFile)} {
+		content, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+		parsed, err := parsePersistRules(string(content), file)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// parsePersistRules parses the content of a .wtmpersist file. Every line
+// holds a pattern, optionally followed by the restore mode; lines starting
+// with ! exclude what the pattern matches. Blank lines and lines starting
+// with # are ignored.
+//
+//	# local configuration
+//	.env*
+//	config/*.local.yml
+//	!config/example.local.yml
+//	node_modules link
+func parsePersistRules(content, file string) ([]PersistRule, error) {
+	var rules []PersistRule
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule PersistRule
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			rule.Exclude = true
+			line = rest
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && !rule.Exclude:
+			rule.Mode = RestoreMode(fields[1])
+			if err := rule.Mode.validate(); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", file, i+1, err)
+			}
+		case len(fields) != 1:
+			return nil, fmt.Errorf("%s:%d: expected a pattern and an optional mode", file, i+1)
+		}
+
+		pattern, err := cleanPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, i+1, err)
+		}
+		rule.Pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// cleanPattern normalizes pattern and checks its syntax.
+func cleanPattern(pattern string) (string, error) {
+	cleaned := path.Clean(strings.Trim(filepath.ToSlash(pattern), "/"))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid pattern %q", pattern)
+	}
+	for _, segment := range strings.Split(cleaned, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return "", fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return cleaned, nil
+}
+
+// ruleMatch is a path selected by persist rules.
+type ruleMatch struct {
+	// Path is relative to the matched tree, with forward slashes.
+	Path string
+	Mode RestoreMode
+
+	// Layer is the branch whose layer of shared storage the match comes
+	// from, and Overlay is set when it lies inside a common match.
+	Layer   string
+	Overlay bool
+}
+
+// matchTree returns the outermost paths below root selected by rules, in
+// lexical order. A selected directory that an exclusion applies inside of is
+// replaced by its selected contents. Directories that no rule can match
+// inside are not read, and .git entries and the branch layers of shared
+// storage are never matched.
+func matchTree(root string, rules []PersistRule) ([]ruleMatch, error) {
+	var matches []ruleMatch
+	// inherited holds the rule selecting the contents of directories that
+	// are split up because of exclusions
+	inherited := map[string]*PersistRule{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Name() == ".git" || strings.HasPrefix(d.Name(), ".wtm-update-") || rel == BranchesDir {
+			return skipEntry(d)
+		}
+
+		rule := lastMatch(rules, rel)
+		if rule == nil {
+			rule = inherited[path.Dir(rel)]
+		}
+		switch {
+		case rule == nil:
+			if d.IsDir() && !mayMatchBelow(rules, rel, false) {
+				return filepath.SkipDir
+			}
+			return nil
+		case rule.Exclude:
+			return skipEntry(d)
+		case d.IsDir() && mayMatchBelow(rules, rel, true):
+			inherited[rel] = rule
+			return nil
+		}
+		matches = append(matches, ruleMatch{Path: rel, Mode: rule.Mode})
+		return skipEntry(d)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// skipEntry stops filepath.WalkDir from descending into d.
+func skipEntry(d fs.DirEntry) error {
+	if d.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// lastMatch returns the last rule matching the slash-separated path, or nil.
+func lastMatch(rules []PersistRule, name string) *PersistRule {
+	var match *PersistRule
+	for i := range rules {
+		if matchSegments(strings.Split(rules[i].Pattern, "/"), strings.Split(name, "/"), false) {
+			match = &rules[i]
+		}
+	}
+	return match
+}
+
+// mayMatchBelow reports whether an excluding rule, or an including one
+// when exclude is false, may match a path inside the directory dir.
+func mayMatchBelow(rules []PersistRule, dir string, exclude bool) bool {
+	for _, rule := range rules {
+		if rule.Exclude == exclude && matchSegments(strings.Split(rule.Pattern, "/"), strings.Split(dir, "/"), true) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments. With
+// prefix set, it reports whether the segments could be the leading
+// directories of a matching path instead.
+func matchSegments(pattern, segments []string, prefix bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(pattern[1:], segments[skip:], prefix) {
+					return true
+				}
+			}
+			return prefix
+		}
+		if len(segments) == 0 {
+			return prefix
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0 && !prefix
+}
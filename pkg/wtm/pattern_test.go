@@ -0,0 +1,212 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{".env*", ".env", true},
+		{".env*", ".env.local", true},
+		{".env*", "app/.env", false},
+		{"config/*.local.yml", "config/db.local.yml", true},
+		{"config/*.local.yml", "config/db.yml", false},
+		{"**/.secrets", ".secrets", true},
+		{"**/.secrets", "a/b/.secrets", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**", "a/x/y", true},
+		{"a/**/b", "a/x/c", false},
+		{`\*.txt`, "*.txt", true},
+		{`\*.txt`, "a.txt", false},
+	}
+	for _, tt := range tests {
+		got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/"), false)
+		if got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParsePersistRules(t *testing.T) {
+	content := `# local configuration
+.env*
+/config/*.local.yml
+
+!config/example.local.yml
+node_modules/ link
+`
+	rules, err := parsePersistRules(content, PersistFile)
+	if err != nil {
+		t.Fatalf("parsePersistRules failed: %v", err)
+	}
+	want := []PersistRule{
+		{Pattern: ".env*"},
+		{Pattern: "config/*.local.yml"},
+		{Pattern: "config/example.local.yml", Exclude: true},
+		{Pattern: "node_modules", Mode: RestoreLink},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Expected %+v, got %+v", want, rules)
+	}
+
+	for _, bad := range []string{"a copy extra", "a teleport", "[", "../outside"} {
+		if _, err := parsePersistRules(bad, PersistFile); err == nil || !strings.Contains(err.Error(), PersistFile+":1") {
+			t.Errorf("Expected a located error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestMatchTree(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		".env", ".env.local", "README.md",
+		"config/db.local.yml", "config/example.local.yml", "config/app.yml",
+		"pkg/a/.secrets", "pkg/b/c/.secrets",
+		"vendor/x/keep.txt", "vendor/x/skip.log",
+		".git/config",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := NewPersistRules([]string{".env*", "config/*.local.yml", "**/.secrets", "vendor", "**/config"}, []string{"config/example.local.yml", "**/*.log"}, RestoreLink)
+	if err != nil {
+		t.Fatalf("NewPersistRules failed: %v", err)
+	}
+	matches, err := matchTree(root, rules)
+	if err != nil {
+		t.Fatalf("matchTree failed: %v", err)
+	}
+
+	var paths []string
+	for _, match := range matches {
+		paths = append(paths, match.Path)
+		if match.Mode != RestoreLink {
+			t.Errorf("Expected %s to keep the mode of its rule, got %q", match.Path, match.Mode)
+		}
+	}
+	want := []string{".env", ".env.local", "config/app.yml", "config/db.local.yml", "pkg/a/.secrets", "pkg/b/c/.secrets", "vendor/x/keep.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected %v, got %v", want, paths)
+	}
+}
+
+func TestSyncPersisted(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	workspace := repo.WorkspacePath()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(workspace, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".env", "KEY=value")
+	write("config/db.local.yml", "db")
+	write("config/example.local.yml", "example")
+	write("deps/lib.js", "lib")
+
+	t.Run("error without declaration", func(t *testing.T) {
+		err := repo.SyncPersisted(ctx, SyncOptions{Worktree: workspace})
+		if err == nil || !strings.Contains(err.Error(), "no "+PersistFile) {
+			t.Errorf("Expected missing declaration error, got: %v", err)
+		}
+	})
+
+	write(PersistFile, ".env*\nconfig/*.local.yml\n!config/example.local.yml\n")
+	if err := os.WriteFile(filepath.Join(repo.Root, PersistFile), []byte("deps link\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("persists declared paths", func(t *testing.T) {
+		if err := repo.SyncPersisted(ctx, SyncOptions{Worktree: workspace}); err != nil {
+			t.Fatalf("SyncPersisted failed: %v", err)
+		}
+
+		entries, _ := repo.loadManifest()
+		var paths []string
+		for _, entry := range entries {
+			paths = append(paths, entry.Path+":"+string(entry.Mode))
+		}
+		want := []string{".env:", "config/db.local.yml:", "deps:link"}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("Expected entries %v, got %v", want, paths)
+		}
+	})
+
+	t.Run("updates changed paths only when asked", func(t *testing.T) {
+		write(".env", "KEY=changed")
+		if err := repo.SyncPersisted(ctx, SyncOptions{Worktree: workspace}); err != nil {
+			t.Fatalf("SyncPersisted failed: %v", err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(repo.SharedPath(), ".env")); string(content) != "KEY=value" {
+			t.Errorf("Expected .env to be left alone, got %q", content)
+		}
+
+		if err := repo.SyncPersisted(ctx, SyncOptions{Worktree: workspace, Update: true}); err != nil {
+			t.Fatalf("SyncPersisted failed: %v", err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(repo.SharedPath(), ".env")); string(content) != "KEY=changed" {
+			t.Errorf("Expected .env to be updated, got %q", content)
+		}
+	})
+
+	t.Run("restore all applies the declaration", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := os.WriteFile(filepath.Join(worktree, PersistFile), []byte("config/**\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, All: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(worktree, "config", "db.local.yml")); err != nil {
+			t.Errorf("Expected config to be restored: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(worktree, ".env")); !os.IsNotExist(err) {
+			t.Errorf("Expected .env not to be restored, got %v", err)
+		}
+		if target, err := os.Readlink(filepath.Join(worktree, "deps")); err != nil || !strings.HasSuffix(target, "deps") {
+			t.Errorf("Expected deps to be linked as declared, got %q, %v", target, err)
+		}
+	})
+
+	t.Run("restore matches patterns", func(t *testing.T) {
+		worktree := t.TempDir()
+		err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "**/*.yml", Exclude: []string{"deps"}})
+		if err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(worktree, "config", "db.local.yml")); err != nil {
+			t.Errorf("Expected the matching file to be restored: %v", err)
+		}
+
+		err = repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "*.json"})
+		if err == nil || !strings.Contains(err.Error(), "no persisted files match") {
+			t.Errorf("Expected no match error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,510 @@
+package wtm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PersistOptions configures Repository.Persist.
+type PersistOptions struct {
+	// Worktree is the root of the worktree the file is persisted from.
+	Worktree string
+
+	// Path is the file or directory to persist, either absolute or relative
+	// to Worktree.
+	Path string
+
+	// Mode is how the entry is restored when no mode is asked for. Entries
+	// are copied when it is empty.
+	Mode RestoreMode
+
+	// Dereference persists what symlinks point to instead of the links.
+	Dereference bool
+
+	// Branch persists to the layer of this branch instead of the common
+	// entries, see BranchesDir. HEAD means the branch checked out in
+	// Worktree.
+	Branch string
+}
+
+// SharedEntry describes a file or directory in shared storage, as recorded
+// in the shared manifest.
+type SharedEntry struct {
+	// Path is relative to the shared directory, with forward slashes.
+	Path  string `json:"path"`
+	IsDir bool   `json:"dir,omitempty"`
+
+	// Layer is the branch whose layer holds the entry, see BranchesDir. It
+	// is empty for common entries.
+	Layer string `json:"layer,omitempty"`
+
+	// Size is the total size of the regular files in the entry.
+	Size int64 `json:"size"`
+
+	// SHA256 is the digest computed by hashPath when the entry was
+	// persisted.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Source is the worktree the entry was persisted from, relative to the
+	// repository root, and Branch the branch checked out in it.
+	Source string `json:"source,omitempty"`
+	Branch string `json:"branch,omitempty"`
+
+	Persisted time.Time `json:"persisted,omitzero"`
+
+	// Mode is the preferred restore mode.
+	Mode RestoreMode `json:"mode,omitempty"`
+
+	// Unmanaged is set for paths found in shared storage that are not in
+	// the manifest, such as files copied there by hand.
+	Unmanaged bool `json:"-"`
+}
+
+// Persist copies a file or directory from a worktree to shared storage,
+// preserving its path relative to the worktree root. It returns that
+// relative path.
+func (r *Repository) Persist(ctx context.Context, opts PersistOptions) (string, error) {
+	absTargetPath, relPath, err := opts.paths()
+	if err != nil {
+		return "", err
+	}
+	if err := opts.Mode.validate(); err != nil {
+		return "", err
+	}
+
+	key, branch, err := r.persistKey(ctx, opts, relPath)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := r.loadManifest()
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Path, key+"/") || strings.HasPrefix(key, entry.Path+"/") {
+			return "", fmt.Errorf("%s overlaps the persisted entry %s", relPath, entry.Path)
+		}
+	}
+
+	destPath := r.sharedFile(key)
+	if _, err := os.Lstat(destPath); err == nil {
+		return "", fmt.Errorf("file already exists in shared storage: %s\nUse 'wtm persist update %s' to replace it", key, relPath)
+	}
+
+	// An entry whose shared copy went missing is persisted again in place,
+	// keeping its restore mode unless opts.Mode is set
+	mode := opts.Mode
+	i := manifestEntry(entries, key)
+	if i >= 0 {
+		r.printf("Warning: shared/%s is missing, replacing its manifest entry\n", key)
+		if mode == "" {
+			mode = entries[i].Mode
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return "", fmt.Errorf("error creating shared directory structure: %w", err)
+	}
+
+	r.printf("Persisting %s to shared/%s...\n", opts.Path, key)
+
+	if err := copyPath(ctx, absTargetPath, destPath, copyOptions{Dereference: opts.Dereference, Skipped: r.warnSkipped, Progress: r.Stderr}); err != nil {
+		return "", fmt.Errorf("error copying to shared storage: %w", err)
+	}
+
+	entry, err := r.newSharedEntry(ctx, opts.Worktree, key, mode)
+	if err != nil {
+		return "", err
+	}
+	entry.Layer = branch
+	if i >= 0 {
+		entries[i] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	if err := r.saveManifest(entries); err != nil {
+		return "", err
+	}
+	r.snapshotShared(ctx, key, fmt.Sprintf("Persist %s from %s", key, entry.Source))
+
+	r.printf("Successfully persisted to shared/%s\n", key)
+	return relPath, nil
+}
+
+// UpdatePersisted replaces a persisted entry with the current copy in a
+// worktree and returns its path relative to the worktree. Other worktrees
+// never see a partial copy, see replaceShared. The recorded restore mode is
+// kept unless opts.Mode is set.
+func (r *Repository) UpdatePersisted(ctx context.Context, opts PersistOptions) (string, error) {
+	absTargetPath, relPath, err := opts.paths()
+	if err != nil {
+		return "", err
+	}
+	if err := opts.Mode.validate(); err != nil {
+		return "", err
+	}
+
+	key, branch, err := r.persistKey(ctx, opts, relPath)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := r.loadManifest()
+	if err != nil {
+		return "", err
+	}
+	destPath := r.sharedFile(key)
+	if _, err := os.Lstat(destPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("file not found in shared storage: %s\nUse 'wtm persist add %s' to persist it", key, relPath)
+	}
+
+	mode := opts.Mode
+	i := manifestEntry(entries, key)
+	if i >= 0 && mode == "" {
+		mode = entries[i].Mode
+	}
+
+	r.printf("Updating shared/%s from %s...\n", key, opts.Path)
+	err = r.replaceShared(key, func(dest string) error {
+		if err := copyPath(ctx, absTargetPath, dest, copyOptions{Dereference: opts.Dereference, Skipped: r.warnSkipped, Progress: r.Stderr}); err != nil {
+			return fmt.Errorf("error copying to shared storage: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := r.newSharedEntry(ctx, opts.Worktree, key, mode)
+	if err != nil {
+		return "", err
+	}
+	entry.Layer = branch
+	if i >= 0 {
+		entries[i] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	if err := r.saveManifest(entries); err != nil {
+		return "", err
+	}
+	r.snapshotShared(ctx, key, fmt.Sprintf("Update %s from %s", key, entry.Source))
+
+	r.printf("Successfully updated shared/%s\n", key)
+	return relPath, nil
+}
+
+// replaceShared replaces the shared entry at the slash-separated path key
+// with what fill writes to the path it is given. The new content is staged
+// next to the entry and swapped in by renaming; the previous version is
+// kept as a backup until the swap succeeded and is put back otherwise.
+func (r *Repository) replaceShared(key string, fill func(path string) error) error {
+	destPath := r.sharedFile(key)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("error creating shared directory: %w", err)
+	}
+
+	// Staging in shared/ makes the swap a rename on the same file system
+	staging, err := os.MkdirTemp(filepath.Dir(destPath), ".wtm-update-")
+	if err != nil {
+		return fmt.Errorf("error preparing update: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	newPath := filepath.Join(staging, "new")
+	if err := fill(newPath); err != nil {
+		return err
+	}
+
+	backupPath := filepath.Join(staging, "backup")
+	if err := os.Rename(destPath, backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error backing up shared/%s: %w", key, err)
+	}
+	if err := os.Rename(newPath, destPath); err != nil {
+		if restoreErr := os.Rename(backupPath, destPath); restoreErr != nil && !os.IsNotExist(restoreErr) {
+			return fmt.Errorf("error replacing shared/%s: %w (the previous version is in %s)", key, err, backupPath)
+		}
+		return fmt.Errorf("error replacing shared/%s: %w", key, err)
+	}
+	return nil
+}
+
+// DiffPersisted compares the copy of a persisted entry in a worktree with
+// shared storage. Files are compared as a unified diff, directories as a
+// list of added, deleted and modified files. It returns an empty string when
+// both are the same.
+func (r *Repository) DiffPersisted(ctx context.Context, opts PersistOptions) (string, error) {
+	absTargetPath, relPath, err := opts.paths()
+	if err != nil {
+		return "", err
+	}
+	key, _, err := r.persistKey(ctx, opts, relPath)
+	if err != nil {
+		return "", err
+	}
+	sharedPath := r.sharedFile(key)
+	info, err := os.Lstat(sharedPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("file not found in shared storage: %s", key)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"diff", "--no-index", "--no-color", "--no-ext-diff"}
+	if info.IsDir() {
+		args = append(args, "--name-status")
+	}
+	args = append(args, sharedPath, absTargetPath)
+
+	// git diff exits with 1 when the paths differ
+	output, err := r.backend().Output(ctx, opts.Worktree, args...)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", fmt.Errorf("error comparing %s: %w", relPath, err)
+	}
+	return output, nil
+}
+
+// paths returns the absolute path of the file or directory to persist and
+// its path relative to the worktree.
+func (opts PersistOptions) paths() (string, string, error) {
+	absTargetPath := opts.Path
+	if !filepath.IsAbs(absTargetPath) {
+		absTargetPath = filepath.Join(opts.Worktree, opts.Path)
+	}
+
+	if _, err := os.Lstat(absTargetPath); os.IsNotExist(err) {
+		return "", "", fmt.Errorf("file or directory does not exist: %s", opts.Path)
+	}
+
+	// Get relative path from worktree root to preserve structure
+	relPath, err := filepath.Rel(opts.Worktree, absTargetPath)
+	if err != nil {
+		return "", "", fmt.Errorf("error determining relative path: %w", err)
+	}
+	if relPath == "." || strings.HasPrefix(relPath, "..") {
+		return "", "", fmt.Errorf("%s is outside of the worktree %s", opts.Path, opts.Worktree)
+	}
+	return absTargetPath, relPath, nil
+}
+
+// newSharedEntry describes the entry at the slash-separated path key in
+// shared storage, persisted from worktree.
+func (r *Repository) newSharedEntry(ctx context.Context, worktree, key string, mode RestoreMode) (SharedEntry, error) {
+	entry := SharedEntry{
+		Path:      key,
+		Source:    r.metadataKey(worktree),
+		Persisted: time.Now().UTC().Truncate(time.Second),
+		Mode:      mode,
+	}
+	if branch, err := r.backend().CurrentBranch(ctx, worktree); err == nil {
+		entry.Branch = branch
+	}
+
+	path := r.sharedFile(key)
+	var err error
+	if entry.Size, entry.SHA256, err = hashPath(path); err != nil {
+		return SharedEntry{}, fmt.Errorf("error hashing shared/%s: %w", key, err)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		entry.IsDir = info.IsDir()
+	}
+	return entry, nil
+}
+
+// PersistedPath returns the path in shared storage of the entry persisted
+// from opts.Path, in the layer of opts.Branch. Unlike for Persist, opts.Path
+// need not exist in the worktree.
+func (r *Repository) PersistedPath(ctx context.Context, opts PersistOptions) (string, error) {
+	relPath := opts.Path
+	if filepath.IsAbs(relPath) {
+		rel, err := filepath.Rel(opts.Worktree, relPath)
+		if err != nil {
+			return "", fmt.Errorf("error determining relative path: %w", err)
+		}
+		relPath = rel
+	}
+	relPath = filepath.Clean(relPath)
+	if relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the worktree %s", opts.Path, opts.Worktree)
+	}
+	key, _, err := r.persistKey(ctx, opts, relPath)
+	return key, err
+}
+
+// Unpersist removes a file or directory from shared storage.
+func (r *Repository) Unpersist(ctx context.Context, path string) error {
+	targetFullPath := filepath.Join(r.SharedPath(), path)
+
+	if _, err := os.Stat(targetFullPath); os.IsNotExist(err) {
+		return fmt.Errorf("file not found in shared storage: %s", path)
+	}
+
+	r.printf("Removing %s from shared storage...\n", path)
+
+	if err := os.RemoveAll(targetFullPath); err != nil {
+		return fmt.Errorf("error removing from shared storage: %w", err)
+	}
+
+	entries, err := r.loadManifest()
+	if err != nil {
+		return err
+	}
+	key := filepath.ToSlash(filepath.Clean(path))
+	entries = slices.DeleteFunc(entries, func(entry SharedEntry) bool {
+		return entry.Path == key || strings.HasPrefix(entry.Path, key+"/")
+	})
+	if err := r.saveManifest(entries); err != nil {
+		return err
+	}
+	r.removeEmptyLayerDirs(key)
+	r.snapshotShared(ctx, key, "Remove "+key)
+
+	r.printf("Successfully removed shared/%s\n", path)
+	return nil
+}
+
+// SyncOptions configures Repository.SyncPersisted.
+type SyncOptions struct {
+	// Worktree is the root of the worktree to persist from.
+	Worktree string
+
+	// Rules select the paths to persist. The rules of the .wtmpersist files
+	// are used when nil.
+	Rules []PersistRule
+
+	// Update replaces entries whose shared copy differs from the worktree.
+	// They are only reported otherwise.
+	Update bool
+
+	// Dereference persists what symlinks point to instead of the links.
+	Dereference bool
+
+	// Branch persists to the layer of this branch, see PersistOptions.
+	Branch string
+}
+
+// SyncPersisted persists the paths of a worktree selected by persist rules.
+// Paths not in shared storage yet are added in the mode of their rule;
+// paths that differ from their shared copy are updated when opts.Update is
+// set, and the others are left alone.
+func (r *Repository) SyncPersisted(ctx context.Context, opts SyncOptions) error {
+	rules := opts.Rules
+	if rules == nil {
+		var err error
+		if rules, err = r.PersistRules(opts.Worktree); err != nil {
+			return err
+		}
+		if rules == nil {
+			return fmt.Errorf("no %s file in %s or %s", PersistFile, opts.Worktree, r.Root)
+		}
+	}
+
+	_, branch, err := r.persistKey(ctx, PersistOptions{Worktree: opts.Worktree, Branch: opts.Branch}, "")
+	if err != nil {
+		return err
+	}
+
+	matches, err := matchTree(opts.Worktree, rules)
+	if err != nil {
+		return fmt.Errorf("error matching files: %w", err)
+	}
+	if len(matches) == 0 {
+		r.printf("No files match\n")
+		return nil
+	}
+
+	var added, updated, current, differ int
+	var failures []string
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		source := filepath.Join(opts.Worktree, filepath.FromSlash(match.Path))
+		popts := PersistOptions{Worktree: opts.Worktree, Path: source, Mode: match.Mode, Dereference: opts.Dereference, Branch: branch}
+
+		var err error
+		switch exists, same := r.compareShared(source, BranchPath(branch, match.Path)); {
+		case !exists:
+			if _, err = r.Persist(ctx, popts); err == nil {
+				added++
+			}
+		case same:
+			current++
+		case !opts.Update:
+			r.printf("%s differs from shared storage. Use --update to replace it\n", match.Path)
+			differ++
+		default:
+			if _, err = r.UpdatePersisted(ctx, popts); err == nil {
+				updated++
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("  ❌ %s: %v", match.Path, err))
+		}
+	}
+
+	r.printf("\nPersisted %d, updated %d, %d up to date", added, updated, current)
+	if differ > 0 {
+		r.printf(", %d differ", differ)
+	}
+	r.printf("\n")
+
+	if len(failures) > 0 {
+		r.printf("\nErrors encountered:\n%s\n", strings.Join(failures, "\n"))
+		return fmt.Errorf("some files failed to persist")
+	}
+	return nil
+}
+
+// compareShared reports whether the slash-separated path key exists in
+// shared storage and whether it has the same content as the file or
+// directory at source.
+func (r *Repository) compareShared(source, key string) (bool, bool) {
+	if _, err := os.Lstat(r.sharedFile(key)); err != nil {
+		return false, false
+	}
+	_, sourceSum, err := hashPath(source)
+	if err != nil {
+		return true, false
+	}
+	_, sharedSum, err := hashPath(r.sharedFile(key))
+	return true, err == nil && sourceSum == sharedSum
+}
+
+// Persisted returns the entries of the shared manifest followed by the
+// paths in shared storage the manifest does not know about, in lexical
+// order. It returns no entries when nothing has been persisted yet.
+func (r *Repository) Persisted(ctx context.Context) ([]SharedEntry, error) {
+	entries, err := r.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	unmanaged, err := r.unmanagedPaths(entries)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range unmanaged {
+		entry := SharedEntry{Path: path, Unmanaged: true}
+		if info, err := os.Lstat(r.sharedFile(path)); err == nil {
+			entry.IsDir = info.IsDir()
+		}
+		entry.Size = dirSize(r.sharedFile(path))
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
@@ -0,0 +1,239 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPersist(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	workspace := repo.WorkspacePath()
+
+	t.Run("persist nested file preserves structure", func(t *testing.T) {
+		configDir := filepath.Join(workspace, "src", "config")
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			t.Fatalf("Failed to create config dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(configDir, "database.json"), []byte(`{"host": "localhost"}`), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		rel, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: "src/config/database.json"})
+		if err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+		if rel != filepath.Join("src", "config", "database.json") {
+			t.Errorf("Unexpected relative path %q", rel)
+		}
+
+		content, err := os.ReadFile(filepath.Join(repo.SharedPath(), rel))
+		if err != nil {
+			t.Fatalf("Persisted file missing: %v", err)
+		}
+		if string(content) != `{"host": "localhost"}` {
+			t.Errorf("Content mismatch: got %q", string(content))
+		}
+	})
+
+	t.Run("persist absolute path", func(t *testing.T) {
+		envFile := filepath.Join(workspace, ".env")
+		if err := os.WriteFile(envFile, []byte("KEY=value"), 0644); err != nil {
+			t.Fatalf("Failed to write .env: %v", err)
+		}
+
+		rel, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: envFile})
+		if err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+		if rel != ".env" {
+			t.Errorf("Expected relative path .env, got %q", rel)
+		}
+	})
+
+	t.Run("error when already persisted", func(t *testing.T) {
+		_, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: ".env"})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected 'already exists' error, got: %v", err)
+		}
+	})
+
+	t.Run("error when path does not exist", func(t *testing.T) {
+		_, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: "missing.txt"})
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Expected 'does not exist' error, got: %v", err)
+		}
+	})
+
+	t.Run("persisted lists entries", func(t *testing.T) {
+		entries, err := repo.Persisted(ctx)
+		if err != nil {
+			t.Fatalf("Persisted failed: %v", err)
+		}
+
+		var paths []string
+		for _, entry := range entries {
+			paths = append(paths, entry.Path)
+		}
+		expected := []string{".env", "src/config/database.json"}
+		if strings.Join(paths, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected entries %v, got %v", expected, paths)
+		}
+
+		env := entries[0]
+		if env.Source != "workspace" || env.Branch != "main" || env.Size != int64(len("KEY=value")) || env.Persisted.IsZero() {
+			t.Errorf("Unexpected manifest entry %+v", env)
+		}
+		// sha256 of "KEY=value"
+		if env.SHA256 != "2226cf65e8cffa7f3fdd56e031b4bc8571a7c87179d49884879a299e3d7ceb79" {
+			t.Errorf("Unexpected digest %s", env.SHA256)
+		}
+	})
+
+	t.Run("overlapping entries are refused", func(t *testing.T) {
+		_, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: "src"})
+		if err == nil || !strings.Contains(err.Error(), "overlaps") {
+			t.Errorf("Expected overlap error, got: %v", err)
+		}
+	})
+
+	t.Run("persisting a missing entry again replaces it", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(repo.SharedPath(), "src", "config", "database.json")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: "src/config/database.json"}); err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+		entries, err := repo.Persisted(ctx)
+		if err != nil {
+			t.Fatalf("Persisted failed: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("Expected the entry to be replaced, got %+v", entries)
+		}
+	})
+
+	t.Run("verify detects out-of-band changes", func(t *testing.T) {
+		results, err := repo.VerifyPersisted()
+		if err != nil || len(results) != 0 {
+			t.Fatalf("Expected clean verification, got %+v, %v", results, err)
+		}
+
+		if err := os.WriteFile(filepath.Join(repo.SharedPath(), ".env"), []byte("KEY=tampered"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repo.SharedPath(), "stray.txt"), []byte("stray"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(filepath.Join(repo.SharedPath(), "stray.txt"))
+
+		results, err = repo.VerifyPersisted()
+		if err != nil {
+			t.Fatalf("VerifyPersisted failed: %v", err)
+		}
+		want := []VerifyResult{{Path: ".env", Problem: VerifyModified}, {Path: "stray.txt", Problem: VerifyUnmanaged}}
+		if !reflect.DeepEqual(results, want) {
+			t.Errorf("Expected %+v, got %+v", want, results)
+		}
+
+		entries, _ := repo.Persisted(ctx)
+		if last := entries[len(entries)-1]; last.Path != "stray.txt" || !last.Unmanaged {
+			t.Errorf("Expected stray.txt to be listed as unmanaged, got %+v", last)
+		}
+	})
+
+	t.Run("diff and update replace the shared copy", func(t *testing.T) {
+		diff, err := repo.DiffPersisted(ctx, PersistOptions{Worktree: workspace, Path: ".env"})
+		if err != nil {
+			t.Fatalf("DiffPersisted failed: %v", err)
+		}
+		if !strings.Contains(diff, "-KEY=tampered") || !strings.Contains(diff, "+KEY=value") {
+			t.Errorf("Expected a unified diff, got:\n%s", diff)
+		}
+
+		if _, err := repo.UpdatePersisted(ctx, PersistOptions{Worktree: workspace, Path: ".env", Mode: RestoreLink}); err != nil {
+			t.Fatalf("UpdatePersisted failed: %v", err)
+		}
+		content, _ := os.ReadFile(filepath.Join(repo.SharedPath(), ".env"))
+		if string(content) != "KEY=value" {
+			t.Errorf("Expected the shared copy to be updated, got %q", content)
+		}
+		if diff, err := repo.DiffPersisted(ctx, PersistOptions{Worktree: workspace, Path: ".env"}); err != nil || diff != "" {
+			t.Errorf("Expected no difference after update, got %q, %v", diff, err)
+		}
+		if results, _ := repo.VerifyPersisted(); len(results) != 0 {
+			t.Errorf("Expected the manifest to match after update, got %+v", results)
+		}
+		entries, _ := repo.loadManifest()
+		if entries[0].Mode != RestoreLink {
+			t.Errorf("Expected the mode to change to link, got %q", entries[0].Mode)
+		}
+
+		leftovers, _ := filepath.Glob(filepath.Join(repo.SharedPath(), ".wtm-update-*"))
+		if len(leftovers) != 0 {
+			t.Errorf("Expected no staging directories, got %v", leftovers)
+		}
+
+		_, err = repo.UpdatePersisted(ctx, PersistOptions{Worktree: workspace, Path: "README.md"})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Expected 'not found' error, got: %v", err)
+		}
+	})
+
+	t.Run("diff lists changed files of directories", func(t *testing.T) {
+		dir := filepath.Join(workspace, "fixtures")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"a.txt": "a", "b.txt": "b"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repo.Persist(ctx, PersistOptions{Worktree: workspace, Path: "fixtures"}); err != nil {
+			t.Fatalf("Persist failed: %v", err)
+		}
+		defer repo.Unpersist(ctx, "fixtures")
+
+		os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+		os.Remove(filepath.Join(dir, "b.txt"))
+		os.WriteFile(filepath.Join(dir, "c.txt"), []byte("c"), 0644)
+
+		diff, err := repo.DiffPersisted(ctx, PersistOptions{Worktree: workspace, Path: "fixtures"})
+		if err != nil {
+			t.Fatalf("DiffPersisted failed: %v", err)
+		}
+		for _, want := range []string{"M\t", "D\t", "A\t"} {
+			if !strings.Contains(diff, want) {
+				t.Errorf("Expected %q in summary:\n%s", want, diff)
+			}
+		}
+	})
+
+	t.Run("unpersist removes entry", func(t *testing.T) {
+		if err := repo.Unpersist(ctx, ".env"); err != nil {
+			t.Fatalf("Unpersist failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.SharedPath(), ".env")); !os.IsNotExist(err) {
+			t.Error("Entry still exists after Unpersist")
+		}
+
+		err := repo.Unpersist(ctx, ".env")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Expected 'not found' error, got: %v", err)
+		}
+
+		entries, _ := repo.loadManifest()
+		if len(entries) != 1 || entries[0].Path != "src/config/database.json" {
+			t.Errorf("Expected .env to be dropped from the manifest, got %+v", entries)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PRRefKey is the git config key holding the ref pattern pull requests are
+// fetched from, with * standing for the pull request number.
+const PRRefKey = "wtm.prRef"
+
+// Pull request ref patterns of the supported forges.
+const (
+	GitHubPRRef = "refs/pull/*/head"
+	GitLabPRRef = "refs/merge-requests/*/head"
+)
+
+// prBranchPattern matches the local branches PullRequest creates.
+var prBranchPattern = regexp.MustCompile(`^pr-([0-9]+)$`)
+
+// PROptions configures Repository.PullRequest.
+type PROptions struct {
+	// Number is the pull or merge request number.
+	Number int
+
+	// Remote is the remote the pull request belongs to. Defaults to origin.
+	Remote string
+
+	// Update refreshes an existing pull request worktree to the current
+	// head of the pull request.
+	Update bool
+
+	// Restore restores all persisted files into a new worktree.
+	Restore bool
+}
+
+// PRBranch returns the local branch, and worktree name, of pull request n.
+func PRBranch(n int) string {
+	return "pr-" + strconv.Itoa(n)
+}
+
+// PullRequest fetches the head of pull request opts.Number into branch
+// pr-<N> and checks it out in tree/pr-<N>, returning the worktree path. An
+// existing pr-<N> branch without a worktree is moved to the head only when it
+// is the head or one of its ancestors. With opts.Update, the existing
+// worktree of the pull request is moved to the new head as long as it has no
+// local changes or commits.
+func (r *Repository) PullRequest(ctx context.Context, opts PROptions) (string, error) {
+	remote := opts.Remote
+	if remote == "" {
+		remote = "origin"
+	}
+	branch := PRBranch(opts.Number)
+	localRef := prLocalRef(opts.Number)
+
+	// The pull request may have been switched into the workspace
+	worktreePath, err := r.worktreeForBranch(ctx, branch)
+	if err != nil {
+		return "", err
+	}
+	exists := worktreePath != ""
+	if exists && !opts.Update {
+		return "", fmt.Errorf("worktree already exists at %s. Use --update to refresh it", worktreePath)
+	}
+	if !exists && opts.Update {
+		return "", fmt.Errorf("no worktree for pull request %d. Run 'wtm pr %d' to create it", opts.Number, opts.Number)
+	}
+
+	previous, _ := r.backend().RevParse(ctx, r.gitDir(), "--verify", "--quiet", localRef)
+
+	pattern, err := r.prRefPattern(ctx, remote)
+	if err != nil {
+		return "", err
+	}
+	remoteRef := strings.Replace(pattern, "*", strconv.Itoa(opts.Number), 1)
+
+	r.printf("Fetching %s from %s...\n", remoteRef, remote)
+	if _, err := r.backend().Output(ctx, r.gitDir(), "fetch", remote, "+"+remoteRef+":"+localRef); err != nil {
+		return "", fmt.Errorf("error fetching pull request %d: %w", opts.Number, err)
+	}
+
+	if exists {
+		if err := r.updatePRWorktree(ctx, worktreePath, localRef, previous); err != nil {
+			return "", err
+		}
+		r.printf("Successfully updated %s\n", worktreePath)
+		return worktreePath, nil
+	}
+
+	// A leftover branch is only moved when that loses no commits
+	if r.hasCommit(ctx, "refs/heads/"+branch) && !r.containedIn(ctx, branch, localRef) {
+		return "", fmt.Errorf("branch %s already exists and has commits that are not in pull request %d\nDelete or rename it, then run 'wtm pr %d' again", branch, opts.Number, opts.Number)
+	}
+	if _, err := r.backend().Output(ctx, r.gitDir(), "branch", "--force", branch, localRef); err != nil {
+		return "", fmt.Errorf("error creating branch %s: %w", branch, err)
+	}
+	return r.Checkout(ctx, CheckoutOptions{Commitish: branch, Restore: opts.Restore})
+}
+
+// worktreeForBranch returns the path of the worktree with branch checked
+// out, or an empty path when there is none.
+func (r *Repository) worktreeForBranch(ctx context.Context, branch string) (string, error) {
+	worktrees, err := r.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, wt := range worktrees {
+		if wt.Branch == branch {
+			return wt.Path, nil
+		}
+	}
+	return "", nil
+}
+
+// updatePRWorktree moves the pull request worktree at path to ref. It
+// refuses when the worktree has uncommitted changes or commits that are not
+// part of the previously fetched head.
+func (r *Repository) updatePRWorktree(ctx context.Context, path, ref, previous string) error {
+	g := r.backend()
+
+	status, err := g.Status(ctx, path)
+	if err != nil {
+		return fmt.Errorf("error checking worktree status: %w", err)
+	}
+	if len(status) > 0 {
+		return fmt.Errorf("worktree %s has uncommitted changes", path)
+	}
+
+	head, err := g.RevParse(ctx, path, "HEAD")
+	if err != nil {
+		return fmt.Errorf("error reading worktree HEAD: %w", err)
+	}
+	if previous != "" && head != previous {
+		if _, err := g.Output(ctx, path, "merge-base", "--is-ancestor", head, previous); err != nil {
+			return fmt.Errorf("worktree %s has local commits, refusing to update", path)
+		}
+	}
+
+	if _, err := g.Output(ctx, path, "reset", "--hard", ref); err != nil {
+		return fmt.Errorf("error updating worktree: %w", err)
+	}
+	return nil
+}
+
+// CleanupPullRequests removes the pull request worktrees whose refs no
+// longer exist on remote, along with their branches, and returns the
+// removed paths. The workspace and worktrees with uncommitted changes are
+// kept.
+func (r *Repository) CleanupPullRequests(ctx context.Context, remote string) ([]string, error) {
+	if remote == "" {
+		remote = "origin"
+	}
+	g := r.backend()
+
+	pattern, err := r.prRefPattern(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	output, err := g.Output(ctx, r.gitDir(), "ls-remote", remote, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests on %s: %w", remote, err)
+	}
+	open := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			open[fields[1]] = true
+		}
+	}
+
+	worktrees, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, wt := range worktrees {
+		match := prBranchPattern.FindStringSubmatch(wt.Branch)
+		if match == nil {
+			continue
+		}
+		if open[strings.Replace(pattern, "*", match[1], 1)] {
+			continue
+		}
+
+		n, _ := strconv.Atoi(match[1])
+		merged := r.containedIn(ctx, wt.Branch, prLocalRef(n))
+		ok, err := r.pruneWorktree(ctx, wt, "pull request "+match[1]+" is gone", merged, false)
+		if err != nil {
+			return removed, err
+		}
+		if !ok {
+			continue
+		}
+		_, _ = g.Output(ctx, r.gitDir(), "update-ref", "-d", prLocalRef(n))
+		removed = append(removed, wt.Path)
+	}
+	return removed, nil
+}
+
+// prRefPattern returns the pull request ref pattern for remote: the
+// configured wtm.prRef, or the GitLab pattern for remotes hosted on GitLab
+// and the GitHub pattern otherwise.
+func (r *Repository) prRefPattern(ctx context.Context, remote string) (string, error) {
+	configured, err := r.configValues(ctx, PRRefKey)
+	if err != nil {
+		return "", err
+	}
+	if len(configured) > 0 {
+		pattern := configured[len(configured)-1]
+		if strings.Count(pattern, "*") != 1 {
+			return "", fmt.Errorf("%s must contain exactly one *, got %q", PRRefKey, pattern)
+		}
+		return pattern, nil
+	}
+
+	urls, err := r.configValues(ctx, "remote."+remote+".url")
+	if err != nil {
+		return "", err
+	}
+	if len(urls) > 0 && strings.Contains(urls[0], "gitlab") {
+		return GitLabPRRef, nil
+	}
+	return GitHubPRRef, nil
+}
+
+// prLocalRef returns the hidden ref pull request n is fetched into. It sits
+// outside refs/remotes so that fetch --prune leaves it alone.
+func prLocalRef(n int) string {
+	return "refs/wtm/pr/" + strconv.Itoa(n)
+}
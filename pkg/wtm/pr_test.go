@@ -0,0 +1,140 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPullRequest(t *testing.T) {
+	ctx := context.Background()
+
+	// A local bare remote publishing pull request refs like GitHub does
+	forge := newTestRepo(t).Root
+	runGit(t, forge, "update-ref", "refs/pull/1/head", "feature-branch")
+	runGit(t, forge, "update-ref", "refs/pull/2/head", "main")
+
+	repo, err := Clone(ctx, CloneOptions{URL: forge, Dir: filepath.Join(t.TempDir(), "project")})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	t.Run("checks out the pull request head", func(t *testing.T) {
+		path, err := repo.PullRequest(ctx, PROptions{Number: 1})
+		if err != nil {
+			t.Fatalf("PullRequest failed: %v", err)
+		}
+		if path != repo.TreePath("pr-1") {
+			t.Errorf("Unexpected worktree path %q", path)
+		}
+		if branch := runGit(t, path, "branch", "--show-current"); branch != "pr-1" {
+			t.Errorf("Expected branch pr-1, got %q", branch)
+		}
+		if _, err := os.Stat(filepath.Join(path, "feature.txt")); err != nil {
+			t.Errorf("Expected pull request content in worktree: %v", err)
+		}
+
+		if _, err := repo.PullRequest(ctx, PROptions{Number: 1}); err == nil || !strings.Contains(err.Error(), "--update") {
+			t.Errorf("Expected error suggesting --update, got %v", err)
+		}
+	})
+
+	t.Run("update moves to the new head", func(t *testing.T) {
+		tree := runGit(t, forge, "rev-parse", "feature-branch^{tree}")
+		newHead := runGit(t, forge, "commit-tree", tree, "-p", "feature-branch", "-m", "Address review")
+		runGit(t, forge, "update-ref", "refs/pull/1/head", newHead)
+
+		path, err := repo.PullRequest(ctx, PROptions{Number: 1, Update: true})
+		if err != nil {
+			t.Fatalf("PullRequest update failed: %v", err)
+		}
+		if head := runGit(t, path, "rev-parse", "HEAD"); head != newHead {
+			t.Errorf("Expected HEAD %s, got %s", newHead, head)
+		}
+	})
+
+	t.Run("update refuses local commits", func(t *testing.T) {
+		path := repo.TreePath("pr-1")
+		runGit(t, path, "commit", "--allow-empty", "-m", "Local note")
+
+		if _, err := repo.PullRequest(ctx, PROptions{Number: 1, Update: true}); err == nil || !strings.Contains(err.Error(), "local commits") {
+			t.Errorf("Expected local commits error, got %v", err)
+		}
+	})
+
+	t.Run("leftover branches keep their commits", func(t *testing.T) {
+		runGit(t, forge, "update-ref", "refs/pull/3/head", "feature-branch")
+		tree := runGit(t, repo.GitDir, "rev-parse", "main^{tree}")
+		local := runGit(t, repo.GitDir, "commit-tree", tree, "-p", "main", "-m", "Local work")
+		runGit(t, repo.GitDir, "branch", "pr-3", local)
+
+		if _, err := repo.PullRequest(ctx, PROptions{Number: 3}); err == nil || !strings.Contains(err.Error(), "Delete or rename it") {
+			t.Errorf("Expected error about the existing branch, got %v", err)
+		}
+		if head := runGit(t, repo.GitDir, "rev-parse", "refs/heads/pr-3"); head != local {
+			t.Errorf("Expected pr-3 to stay at %s, got %s", local, head)
+		}
+
+		// A branch behind the pull request head is moved forward
+		runGit(t, repo.GitDir, "branch", "--force", "pr-3", "main")
+		path, err := repo.PullRequest(ctx, PROptions{Number: 3})
+		if err != nil {
+			t.Fatalf("PullRequest failed: %v", err)
+		}
+		if head, want := runGit(t, path, "rev-parse", "HEAD"), runGit(t, forge, "rev-parse", "feature-branch"); head != want {
+			t.Errorf("Expected HEAD %s, got %s", want, head)
+		}
+	})
+
+	t.Run("cleanup removes worktrees of deleted refs", func(t *testing.T) {
+		if _, err := repo.PullRequest(ctx, PROptions{Number: 2}); err != nil {
+			t.Fatalf("PullRequest failed: %v", err)
+		}
+		runGit(t, forge, "update-ref", "-d", "refs/pull/2/head")
+
+		removed, err := repo.CleanupPullRequests(ctx, "")
+		if err != nil {
+			t.Fatalf("CleanupPullRequests failed: %v", err)
+		}
+		if len(removed) != 1 || removed[0] != repo.TreePath("pr-2") {
+			t.Errorf("Expected only tree/pr-2 to be removed, got %v", removed)
+		}
+		if _, err := os.Stat(repo.TreePath("pr-1")); err != nil {
+			t.Errorf("Expected tree/pr-1 to be kept: %v", err)
+		}
+		if _, err := repo.backend().RevParse(ctx, repo.GitDir, "--verify", "--quiet", "refs/heads/pr-2"); err == nil {
+			t.Error("Expected branch pr-2 to be deleted")
+		}
+	})
+
+	t.Run("configured ref pattern", func(t *testing.T) {
+		runGit(t, forge, "update-ref", "refs/merge-requests/7/head", "feature-branch")
+		runGit(t, repo.GitDir, "config", PRRefKey, GitLabPRRef)
+
+		if _, err := repo.PullRequest(ctx, PROptions{Number: 7}); err != nil {
+			t.Fatalf("PullRequest failed: %v", err)
+		}
+	})
+}
+
+func TestPRRefPattern(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	runGit(t, repo.GitDir, "remote", "add", "origin", "git@gitlab.example.com:group/repo.git")
+	if pattern, err := repo.prRefPattern(ctx, "origin"); err != nil || pattern != GitLabPRRef {
+		t.Errorf("Expected GitLab pattern for a GitLab remote, got %q, %v", pattern, err)
+	}
+
+	runGit(t, repo.GitDir, "remote", "add", "github", "https://github.com/org/repo.git")
+	if pattern, err := repo.prRefPattern(ctx, "github"); err != nil || pattern != GitHubPRRef {
+		t.Errorf("Expected GitHub pattern, got %q, %v", pattern, err)
+	}
+
+	runGit(t, repo.GitDir, "config", PRRefKey, "refs/changes/head")
+	if _, err := repo.prRefPattern(ctx, "origin"); err == nil {
+		t.Error("Expected error for a pattern without *")
+	}
+}
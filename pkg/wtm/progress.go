@@ -0,0 +1,148 @@
+package wtm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressDelay is how long a copy runs before its progress is reported,
+// so that quick copies stay quiet.
+var progressDelay = time.Second
+
+// copyProgress reports the progress of a copy. On a terminal, a status line
+// is rewritten in place; otherwise a progressEvent is written as a JSON line
+// every second.
+type copyProgress struct {
+	out        io.Writer
+	terminal   bool
+	totalFiles int64
+	totalBytes int64
+	start      time.Time
+
+	files atomic.Int64
+	bytes atomic.Int64
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// progressEvent is the JSON form of a progress report.
+type progressEvent struct {
+	Files      int64   `json:"files"`
+	TotalFiles int64   `json:"total_files"`
+	Bytes      int64   `json:"bytes"`
+	TotalBytes int64   `json:"total_bytes"`
+	Rate       float64 `json:"bytes_per_second"`
+	ETA        float64 `json:"eta_seconds"`
+}
+
+// startProgress starts reporting the progress of a copy of files files
+// totalling bytes bytes to out. Nothing is reported when out is nil.
+func startProgress(out io.Writer, files int, bytes int64) *copyProgress {
+	p := &copyProgress{
+		out:        out,
+		terminal:   isTerminal(out),
+		totalFiles: int64(files),
+		totalBytes: bytes,
+		start:      time.Now(),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	if out == nil {
+		close(p.stopped)
+		return p
+	}
+
+	interval := time.Second
+	if p.terminal {
+		interval = 200 * time.Millisecond
+	}
+	go p.run(interval)
+	return p
+}
+
+// add records a copied file of size bytes.
+func (p *copyProgress) add(size int64) {
+	p.files.Add(1)
+	p.bytes.Add(size)
+}
+
+// stop stops reporting, with a last report when the copy was reported on.
+func (p *copyProgress) stop() {
+	close(p.done)
+	<-p.stopped
+}
+
+func (p *copyProgress) run(interval time.Duration) {
+	defer close(p.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			if time.Since(p.start) >= progressDelay {
+				p.report(true)
+			}
+			return
+		case <-ticker.C:
+			if time.Since(p.start) >= progressDelay {
+				p.report(false)
+			}
+		}
+	}
+}
+
+// report writes the current progress; last ends the status line.
+func (p *copyProgress) report(last bool) {
+	event := progressEvent{
+		Files:      p.files.Load(),
+		TotalFiles: p.totalFiles,
+		Bytes:      p.bytes.Load(),
+		TotalBytes: p.totalBytes,
+	}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		event.Rate = float64(event.Bytes) / elapsed
+	}
+	if event.Rate > 0 {
+		event.ETA = float64(event.TotalBytes-event.Bytes) / event.Rate
+	}
+
+	if !p.terminal {
+		json.NewEncoder(p.out).Encode(event)
+		return
+	}
+	eta := time.Duration(event.ETA * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(p.out, "\rCopied %d/%d files, %s/%s, %s/s, ETA %s\x1b[K",
+		event.Files, event.TotalFiles, FormatSize(event.Bytes), FormatSize(event.TotalBytes), FormatSize(int64(event.Rate)), eta)
+	if last {
+		fmt.Fprintln(p.out)
+	}
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// FormatSize formats bytes into human-readable format
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
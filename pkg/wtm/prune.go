@@ -0,0 +1,169 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"wtm/pkg/forge"
+)
+
+// PruneOptions configures Repository.Prune.
+type PruneOptions struct {
+	// MergedPRs removes worktrees whose branch has a merged pull request.
+	MergedPRs bool
+
+	// Forge looks up pull requests. The forge of origin is used when nil.
+	Forge forge.Provider
+
+	// Labels restricts pruning to worktrees carrying all of these labels.
+	Labels []string
+
+	// DryRun reports what would be removed without removing anything.
+	DryRun bool
+}
+
+// Prune removes stale worktree metadata, expired review worktrees and,
+// depending on opts, other worktrees that are no longer needed, and returns
+// the paths removed. The workspace and worktrees with uncommitted changes
+// are never removed.
+func (r *Repository) Prune(ctx context.Context, opts PruneOptions) ([]string, error) {
+	g := r.backend()
+	if !opts.DryRun {
+		if _, err := g.Output(ctx, r.gitDir(), "worktree", "prune"); err != nil {
+			return nil, fmt.Errorf("error pruning worktree metadata: %w", err)
+		}
+	}
+
+	worktrees, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	worktrees = FilterLabels(worktrees, opts.Labels...)
+
+	if opts.MergedPRs {
+		provider := opts.Forge
+		if provider == nil {
+			if provider, err = r.Forge(ctx, "origin"); err != nil {
+				return nil, err
+			}
+		}
+		// A failed lookup only keeps its worktree; the others are still pruned
+		if err := r.AttachPullRequests(ctx, provider, worktrees); err != nil {
+			errs := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			}
+			for _, err := range errs {
+				r.printf("Warning: could not look up the pull request of %v\n", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	var removed []string
+	for _, wt := range worktrees {
+		var reason string
+		merged := true
+		switch {
+		case wt.Review && !wt.Expires.IsZero() && now.After(wt.Expires):
+			reason = "review expired " + wt.Expires.Local().Format("2006-01-02 15:04")
+		case wt.PullRequest != nil && wt.PullRequest.State == forge.StateMerged:
+			reason = fmt.Sprintf("pull request #%d is merged", wt.PullRequest.Number)
+			merged = r.containedIn(ctx, wt.Branch, wt.PullRequest.HeadSHA)
+		default:
+			continue
+		}
+
+		ok, err := r.pruneWorktree(ctx, wt, reason, merged, opts.DryRun)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed = append(removed, wt.Path)
+		}
+	}
+	return removed, nil
+}
+
+// containedIn reports whether the tip of branch is commit or one of its
+// ancestors. It is false when commit is empty or not known locally.
+func (r *Repository) containedIn(ctx context.Context, branch, commit string) bool {
+	if branch == "" || commit == "" {
+		return false
+	}
+	_, err := r.backend().Output(ctx, r.gitDir(), "merge-base", "--is-ancestor", "refs/heads/"+branch, commit)
+	return err == nil
+}
+
+// pruneWorktree removes wt and its branch, explaining why with reason. It
+// skips the workspace, worktrees with uncommitted changes and locked
+// worktrees other than review worktrees, and reports
+// whether wt was, or with dryRun would be, removed.
+//
+// Unless merged says that the branch holds nothing beyond what was merged,
+// wt is only removed when the tip of its branch is contained in the default
+// branch, see pruneBase. The upstream of the branch plays no part.
+func (r *Repository) pruneWorktree(ctx context.Context, wt Worktree, reason string, merged, dryRun bool) (bool, error) {
+	if samePath(wt.Path, r.WorkspacePath()) {
+		r.printf("Keeping workspace (%s): switch to another branch first to prune it\n", reason)
+		return false, nil
+	}
+
+	g := r.backend()
+	if status, err := g.Status(ctx, wt.Path); err != nil || len(status) > 0 {
+		r.printf("Keeping %s (%s): worktree has uncommitted changes\n", wt.Path, reason)
+		return false, nil
+	}
+	// Only review worktrees are locked by wtm itself; any other lock was
+	// taken on purpose
+	if wt.Locked && !wt.Review {
+		r.printf("Keeping %s (%s): worktree is locked, unlock it with 'git worktree unlock' to prune it\n", wt.Path, reason)
+		return false, nil
+	}
+	if !merged {
+		if base := r.pruneBase(ctx); !r.containedIn(ctx, wt.Branch, base) {
+			r.printf("Keeping %s (%s): branch %s has commits that are not merged into the default branch\n", wt.Path, reason, wt.Branch)
+			return false, nil
+		}
+	}
+
+	if dryRun {
+		r.printf("Would remove %s (%s)\n", wt.Path, reason)
+		return true, nil
+	}
+
+	r.printf("Removing %s (%s)...\n", wt.Path, reason)
+	if wt.Locked {
+		if _, err := g.Output(ctx, r.gitDir(), "worktree", "unlock", wt.Path); err != nil {
+			return false, fmt.Errorf("error unlocking worktree %s: %w", wt.Path, err)
+		}
+	}
+	if err := g.WorktreeRemove(ctx, r.gitDir(), wt.Path, false); err != nil {
+		return false, fmt.Errorf("error removing worktree %s: %w", wt.Path, err)
+	}
+	if wt.Branch != "" {
+		if _, err := g.Output(ctx, r.gitDir(), "branch", "-D", wt.Branch); err != nil {
+			r.printf("Warning: could not delete branch %s: %v\n", wt.Branch, err)
+		}
+	}
+	if err := r.deleteMetadata(wt.Path); err != nil {
+		r.printf("Warning: could not delete metadata of %s: %v\n", wt.Path, err)
+	}
+	return true, nil
+}
+
+// pruneBase returns the ref branches are checked against when pruning: the
+// remote-tracking branch of the default branch on origin when it exists, the
+// local default branch otherwise. It is empty when there is no default
+// branch, and then no branch counts as merged.
+func (r *Repository) pruneBase(ctx context.Context) string {
+	branch := r.defaultBranch(ctx)
+	if branch == "" {
+		return ""
+	}
+	if ref := "refs/remotes/origin/" + branch; r.hasCommit(ctx, ref) {
+		return ref
+	}
+	return "refs/heads/" + branch
+}
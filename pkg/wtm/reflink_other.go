@@ -0,0 +1,8 @@
+//go:build !linux
+
+package wtm
+
+// reflinkFile reports false: copy-on-write clones are only made on Linux.
+func reflinkFile(src, dst string) (bool, error) {
+	return false, nil
+}
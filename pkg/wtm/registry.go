@@ -0,0 +1,264 @@
+package wtm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wtm/pkg/git"
+)
+
+// DefaultSyncJobs is how many repositories Registry.Sync fetches at once by
+// default.
+const DefaultSyncJobs = 4
+
+// Registry is the machine-wide list of wtm repositories, kept in a JSON
+// file. It lets commands act on every repository at once.
+type Registry struct {
+	// Path is the registry file.
+	Path string
+
+	// Stdout receives progress output. Nothing is written when it is nil.
+	Stdout io.Writer
+
+	// Git runs the git operations. The git executable is used when nil.
+	Git git.Git
+}
+
+// RegisteredRepo is an entry of the registry.
+type RegisteredRepo struct {
+	// Root is the absolute path of the repository root.
+	Root  string    `json:"root"`
+	Added time.Time `json:"added"`
+}
+
+// Name returns the directory name of the repository.
+func (e RegisteredRepo) Name() string {
+	return filepath.Base(e.Root)
+}
+
+// RepoStatus is the state of a registered repository.
+type RepoStatus struct {
+	RegisteredRepo
+
+	// Worktrees are the worktrees of the repository.
+	Worktrees []WorktreeStatus
+
+	// Err is set when the repository could not be inspected, for example
+	// because it was deleted.
+	Err error
+}
+
+// WorktreeStatus is a worktree and its uncommitted changes.
+type WorktreeStatus struct {
+	Worktree
+
+	// Changes is the number of changed and untracked files.
+	Changes int
+}
+
+// DefaultRegistryPath returns the default registry file,
+// $XDG_DATA_HOME/wtm/repos.json or ~/.local/share/wtm/repos.json.
+func DefaultRegistryPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error locating data directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "wtm", "repos.json"), nil
+}
+
+// Repos returns the registered repositories sorted by path. It returns nil
+// when the registry file does not exist.
+func (reg *Registry) Repos() ([]RegisteredRepo, error) {
+	content, err := os.ReadFile(reg.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading registry: %w", err)
+	}
+
+	var repos []RegisteredRepo
+	if err := json.Unmarshal(content, &repos); err != nil {
+		return nil, fmt.Errorf("error parsing registry %s: %w", reg.Path, err)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Root < repos[j].Root })
+	return repos, nil
+}
+
+// Add registers the repository at root. Registering a repository twice has
+// no effect.
+func (reg *Registry) Add(root string) error {
+	repo, err := OpenWith(root, reg.Git)
+	if err != nil {
+		return err
+	}
+
+	repos, err := reg.Repos()
+	if err != nil {
+		return err
+	}
+	for _, entry := range repos {
+		if samePath(entry.Root, repo.Root) {
+			return nil
+		}
+	}
+
+	repos = append(repos, RegisteredRepo{Root: repo.Root, Added: time.Now().UTC().Truncate(time.Second)})
+	return reg.save(repos)
+}
+
+// Remove unregisters the repository at root, or the one named root when no
+// registered path matches. The repository itself is left alone.
+func (reg *Registry) Remove(root string) error {
+	repos, err := reg.Repos()
+	if err != nil {
+		return err
+	}
+
+	abs, _ := filepath.Abs(root)
+	index := slices.IndexFunc(repos, func(entry RegisteredRepo) bool {
+		return entry.Root == abs || samePath(entry.Root, root)
+	})
+	if index < 0 && !strings.ContainsRune(root, filepath.Separator) {
+		var matches []int
+		for i, entry := range repos {
+			if entry.Name() == root {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) > 1 {
+			return fmt.Errorf("several repositories are named %s, give the path instead", root)
+		}
+		if len(matches) == 1 {
+			index = matches[0]
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%s is not registered", root)
+	}
+
+	return reg.save(append(repos[:index], repos[index+1:]...))
+}
+
+// Status inspects every registered repository: its worktrees and how many
+// uncommitted changes each has.
+func (reg *Registry) Status(ctx context.Context) ([]RepoStatus, error) {
+	repos, err := reg.Repos()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]RepoStatus, len(repos))
+	for i, entry := range repos {
+		statuses[i] = RepoStatus{RegisteredRepo: entry}
+
+		repo, err := OpenWith(entry.Root, reg.Git)
+		if err != nil {
+			statuses[i].Err = err
+			continue
+		}
+		worktrees, err := repo.List(ctx)
+		if err != nil {
+			statuses[i].Err = err
+			continue
+		}
+		for _, wt := range worktrees {
+			status, err := repo.backend().Status(ctx, wt.Path)
+			if err != nil {
+				statuses[i].Err = fmt.Errorf("error checking %s: %w", wt.Path, err)
+				break
+			}
+			statuses[i].Worktrees = append(statuses[i].Worktrees, WorktreeStatus{Worktree: wt, Changes: len(status)})
+		}
+	}
+	return statuses, nil
+}
+
+// Sync fetches all remotes of every registered repository, running up to
+// jobs fetches at once. It returns the errors of all failed fetches.
+func (reg *Registry) Sync(ctx context.Context, jobs int) error {
+	repos, err := reg.Repos()
+	if err != nil {
+		return err
+	}
+	if jobs < 1 {
+		jobs = DefaultSyncJobs
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	sem := make(chan struct{}, jobs)
+	for _, entry := range repos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := reg.fetch(ctx, entry.Root)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entry.Root, err))
+				reg.printf("Failed to fetch %s\n", entry.Root)
+				return
+			}
+			reg.printf("Fetched %s\n", entry.Root)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// fetch fetches all remotes of the repository at root. The output is
+// captured so that parallel fetches do not interleave.
+func (reg *Registry) fetch(ctx context.Context, root string) error {
+	repo, err := OpenWith(root, reg.Git)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.backend().Output(ctx, repo.gitDir(), "fetch", "--all", "--quiet"); err != nil {
+		return fmt.Errorf("error fetching: %w", err)
+	}
+	return nil
+}
+
+// save atomically replaces the registry with repos.
+func (reg *Registry) save(repos []RegisteredRepo) error {
+	if repos == nil {
+		repos = []RegisteredRepo{}
+	}
+	content, err := json.MarshalIndent(repos, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(reg.Path, append(content, '\n')); err != nil {
+		return fmt.Errorf("error writing registry: %w", err)
+	}
+	return nil
+}
+
+// printf writes a progress message to reg.Stdout.
+func (reg *Registry) printf(format string, args ...any) {
+	if reg.Stdout != nil {
+		fmt.Fprintf(reg.Stdout, format, args...)
+	}
+}
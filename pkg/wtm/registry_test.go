@@ -0,0 +1,101 @@
+package wtm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	var out bytes.Buffer
+	registry := &Registry{Path: filepath.Join(t.TempDir(), "wtm", "repos.json"), Stdout: &out}
+
+	root := filepath.Join(t.TempDir(), "project")
+	clone, err := Clone(ctx, CloneOptions{URL: repo.Root, Dir: root, Registry: registry})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if err := registry.Add(repo.Root); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := registry.Add(root); err != nil {
+		t.Fatalf("Adding twice failed: %v", err)
+	}
+	if err := registry.Add(t.TempDir()); err == nil {
+		t.Error("Expected error registering a directory that is not a repository")
+	}
+
+	repos, err := registry.Repos()
+	if err != nil {
+		t.Fatalf("Repos failed: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("Expected 2 repositories, got %+v", repos)
+	}
+
+	t.Run("status", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(clone.WorkspacePath(), "new.txt"), []byte("new\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		statuses, err := registry.Status(ctx)
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		for _, status := range statuses {
+			if status.Err != nil {
+				t.Errorf("Unexpected error for %s: %v", status.Root, status.Err)
+			}
+			if status.Root == clone.Root {
+				if len(status.Worktrees) != 1 || status.Worktrees[0].Changes != 1 {
+					t.Errorf("Expected one worktree with one change, got %+v", status.Worktrees)
+				}
+			}
+		}
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		runGit(t, repo.Root, "branch", "new-branch", "main")
+
+		out.Reset()
+		if err := registry.Sync(ctx, 2); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "Fetched "+clone.Root) {
+			t.Errorf("Expected fetch report, got %q", out.String())
+		}
+		runGit(t, root, "rev-parse", "--verify", "refs/remotes/origin/new-branch")
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := registry.Remove("project"); err != nil {
+			t.Fatalf("Remove by name failed: %v", err)
+		}
+		if err := registry.Remove(root); err == nil {
+			t.Error("Expected error removing an unregistered repository")
+		}
+
+		os.RemoveAll(repo.Root)
+		statuses, err := registry.Status(ctx)
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].Err == nil {
+			t.Errorf("Expected an error for the deleted repository, got %+v", statuses)
+		}
+		if err := registry.Remove(repo.Root); err != nil {
+			t.Fatalf("Remove of deleted repository failed: %v", err)
+		}
+
+		// Writes go through a temporary file that is renamed into place
+		if entries, _ := os.ReadDir(filepath.Dir(registry.Path)); len(entries) != 1 || entries[0].Name() != "repos.json" {
+			t.Errorf("Expected only repos.json next to the registry, got %v", entries)
+		}
+	})
+}
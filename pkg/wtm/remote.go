@@ -0,0 +1,209 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Remote describes a configured git remote.
+type Remote struct {
+	Name string
+	URL  string
+}
+
+// AddRemote adds a remote with the all-branches fetch refspec and fetches
+// it, so that its branches can be checked out as <name>/<branch>.
+func (r *Repository) AddRemote(ctx context.Context, name, url string) error {
+	g := r.backend()
+	if _, err := g.Output(ctx, r.gitDir(), "remote", "add", name, url); err != nil {
+		return fmt.Errorf("error adding remote %s: %w", name, err)
+	}
+	if err := r.ensureFetchRefspec(ctx, name, "*"); err != nil {
+		return err
+	}
+
+	r.printf("Fetching %s...\n", name)
+	if err := g.Run(ctx, r.gitDir(), "fetch", name); err != nil {
+		return fmt.Errorf("error fetching remote %s: %w", name, err)
+	}
+
+	r.printf("Successfully added remote %s\n", name)
+	return nil
+}
+
+// Remotes returns the configured remotes.
+func (r *Repository) Remotes(ctx context.Context) ([]Remote, error) {
+	names, err := r.remoteNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := make([]Remote, 0, len(names))
+	for _, name := range names {
+		urls, err := r.configValues(ctx, "remote."+name+".url")
+		if err != nil {
+			return nil, err
+		}
+		remote := Remote{Name: name}
+		if len(urls) > 0 {
+			remote.URL = urls[0]
+		}
+		remotes = append(remotes, remote)
+	}
+	return remotes, nil
+}
+
+// remoteNames returns the names of the configured remotes.
+func (r *Repository) remoteNames(ctx context.Context) ([]string, error) {
+	output, err := r.backend().Output(ctx, r.gitDir(), "remote")
+	if err != nil {
+		return nil, fmt.Errorf("error listing remotes: %w", err)
+	}
+	return strings.Fields(output), nil
+}
+
+// localBranchFor maps a checkout target naming a remote branch to a local
+// branch tracking it, creating the branch when needed. Targets are
+// recognized as described in remoteBranch; any other target is returned
+// unchanged.
+func (r *Repository) localBranchFor(ctx context.Context, target string) (string, error) {
+	remote, branch, ok, err := r.remoteBranch(ctx, target)
+	if err != nil || !ok {
+		return target, err
+	}
+
+	local, exists, err := r.trackingBranchName(ctx, remote, branch)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return local, nil
+	}
+
+	tracking := "refs/remotes/" + remote + "/" + branch
+	if _, err := r.backend().Output(ctx, r.gitDir(), "branch", "--track", local, tracking); err != nil {
+		return "", fmt.Errorf("error creating branch %s: %w", local, err)
+	}
+	r.printf("Created branch '%s' tracking %s/%s\n", local, remote, branch)
+	return local, nil
+}
+
+// remoteBranch reports whether target names a remote branch and makes sure
+// its remote-tracking branch is fetched. Targets are recognized as:
+//
+//   - <remote>/<branch>, where remote is configured and no local branch has
+//     that name
+//   - <user>:<branch>, a branch of user's fork of origin; the fork is added
+//     as remote <user> when it is not configured yet
+func (r *Repository) remoteBranch(ctx context.Context, target string) (remote, branch string, ok bool, err error) {
+	if r.hasCommit(ctx, "refs/heads/"+target) {
+		return "", "", false, nil
+	}
+
+	added := false
+	remote, branch, ok = strings.Cut(target, ":")
+	if ok {
+		if remote == "" || branch == "" || strings.ContainsAny(remote, "/ ") {
+			return "", "", false, fmt.Errorf("invalid fork branch %q: expected <user>:<branch>", target)
+		}
+		if added, err = r.ensureForkRemote(ctx, remote); err != nil {
+			return "", "", false, err
+		}
+	} else if remote, branch, ok = strings.Cut(target, "/"); !ok {
+		return "", "", false, nil
+	} else if remotes, err := r.remoteNames(ctx); err != nil || !slices.Contains(remotes, remote) {
+		return "", "", false, nil
+	}
+
+	tracking := "refs/remotes/" + remote + "/" + branch
+	if !r.hasCommit(ctx, tracking) {
+		refspec := "+refs/heads/" + branch + ":" + tracking
+		if _, err := r.backend().Output(ctx, r.gitDir(), "fetch", remote, refspec); err != nil {
+			// Drop the remote just added so that the next attempt adds it again
+			if added {
+				_, _ = r.backend().Output(ctx, r.gitDir(), "remote", "remove", remote)
+			}
+			return "", "", false, fmt.Errorf("error fetching %s from %s: %w", branch, remote, err)
+		}
+	}
+	return remote, branch, true, nil
+}
+
+// trackingBranchName picks the local branch name for branch of remote: the
+// branch name itself when it is free or already tracks remote/branch, and
+// <remote>-<branch> otherwise. It reports whether the branch already
+// exists.
+func (r *Repository) trackingBranchName(ctx context.Context, remote, branch string) (string, bool, error) {
+	candidates := []string{branch, remote + "-" + branch}
+	for _, name := range candidates {
+		if !r.hasCommit(ctx, "refs/heads/"+name) {
+			return name, false, nil
+		}
+		upstream, err := r.backend().Output(ctx, r.gitDir(), "rev-parse", "--abbrev-ref", name+"@{upstream}")
+		if err == nil && strings.TrimSpace(upstream) == remote+"/"+branch {
+			return name, true, nil
+		}
+	}
+	return "", false, fmt.Errorf("branches %s already exist and do not track %s/%s", strings.Join(candidates, " and "), remote, branch)
+}
+
+// ensureForkRemote adds a remote named user pointing at user's fork of
+// origin unless it already exists, and reports whether it added it.
+func (r *Repository) ensureForkRemote(ctx context.Context, user string) (bool, error) {
+	remotes, err := r.remoteNames(ctx)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(remotes, user) {
+		return false, nil
+	}
+
+	origin, err := r.configValues(ctx, "remote.origin.url")
+	if err != nil {
+		return false, err
+	}
+	if len(origin) == 0 {
+		return false, fmt.Errorf("cannot infer the fork of %s: origin has no URL", user)
+	}
+
+	url, err := ForkURL(origin[0], user)
+	if err != nil {
+		return false, err
+	}
+
+	r.printf("Adding remote %s for %s\n", user, url)
+	if _, err := r.backend().Output(ctx, r.gitDir(), "remote", "add", user, url); err != nil {
+		return false, fmt.Errorf("error adding remote %s: %w", user, err)
+	}
+	if err := r.ensureFetchRefspec(ctx, user, "*"); err != nil {
+		_, _ = r.backend().Output(ctx, r.gitDir(), "remote", "remove", user)
+		return false, err
+	}
+	return true, nil
+}
+
+// ForkURL returns the URL of user's fork of the repository at url, assuming
+// forks live next to the original under the user's namespace, as they do on
+// GitHub and GitLab.
+func ForkURL(url, user string) (string, error) {
+	// Keep the scheme and host, or the host of scp-like URLs such as
+	// git@github.com:owner/repo.git, and rewrite the owner in the path
+	prefix, repoPath := "", url
+	if i := strings.Index(url, "://"); i >= 0 {
+		if j := strings.Index(url[i+3:], "/"); j >= 0 {
+			prefix, repoPath = url[:i+3+j+1], url[i+3+j+1:]
+		}
+	} else if i := strings.Index(url, ":"); i >= 0 && !strings.HasPrefix(url, "/") {
+		prefix, repoPath = url[:i+1], url[i+1:]
+	}
+
+	dir, name := path.Split(strings.TrimSuffix(repoPath, "/"))
+	dir = strings.TrimSuffix(dir, "/")
+	if name == "" || dir == "" {
+		return "", fmt.Errorf("cannot infer the fork of %s from %s", user, url)
+	}
+	return prefix + path.Join(path.Dir(dir), user, name), nil
+}
@@ -0,0 +1,138 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemoteCheckout(t *testing.T) {
+	ctx := context.Background()
+
+	// Forks live next to the original under the owner's namespace
+	base := t.TempDir()
+	origin := filepath.Join(base, "org", "repo.git")
+	upstream := filepath.Join(base, "upstream", "repo.git")
+	fork := filepath.Join(base, "alice", "repo.git")
+
+	source := newTestRepo(t).Root
+	for _, dir := range []string{origin, upstream, fork} {
+		runGit(t, base, "clone", "--bare", "--quiet", source, dir)
+	}
+	runGit(t, upstream, "branch", "release", "main")
+	runGit(t, fork, "branch", "fix-typo", "feature-branch")
+
+	repo, err := Clone(ctx, CloneOptions{URL: origin, Dir: filepath.Join(t.TempDir(), "project")})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	t.Run("remote add", func(t *testing.T) {
+		if err := repo.AddRemote(ctx, "upstream", upstream); err != nil {
+			t.Fatalf("AddRemote failed: %v", err)
+		}
+		if refspec := runGit(t, repo.GitDir, "config", "--get-all", "remote.upstream.fetch"); refspec != "+refs/heads/*:refs/remotes/upstream/*" {
+			t.Errorf("Unexpected upstream refspec %q", refspec)
+		}
+		runGit(t, repo.GitDir, "rev-parse", "--verify", "refs/remotes/upstream/release")
+
+		remotes, err := repo.Remotes(ctx)
+		if err != nil {
+			t.Fatalf("Remotes failed: %v", err)
+		}
+		if len(remotes) != 2 || remotes[1] != (Remote{Name: "upstream", URL: upstream}) {
+			t.Errorf("Unexpected remotes %+v", remotes)
+		}
+	})
+
+	t.Run("remote branch keeps a free name", func(t *testing.T) {
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "upstream/release"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if path != repo.TreePath("release") {
+			t.Errorf("Unexpected worktree path %q", path)
+		}
+		if upstream := runGit(t, path, "rev-parse", "--abbrev-ref", "@{upstream}"); upstream != "upstream/release" {
+			t.Errorf("Expected release to track upstream/release, got %q", upstream)
+		}
+	})
+
+	t.Run("remote branch is prefixed when the name is taken", func(t *testing.T) {
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "upstream/main"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if path != repo.TreePath("upstream-main") {
+			t.Errorf("Unexpected worktree path %q", path)
+		}
+		if branch := runGit(t, path, "branch", "--show-current"); branch != "upstream-main" {
+			t.Errorf("Expected branch upstream-main, got %q", branch)
+		}
+	})
+
+	t.Run("fork branch adds the remote on the fly", func(t *testing.T) {
+		path, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "alice:fix-typo"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		if url := runGit(t, repo.GitDir, "config", "remote.alice.url"); url != fork {
+			t.Errorf("Expected remote alice at %s, got %q", fork, url)
+		}
+		if _, err := os.Stat(filepath.Join(path, "feature.txt")); err != nil {
+			t.Errorf("Expected fork branch content in worktree: %v", err)
+		}
+		if upstream := runGit(t, path, "rev-parse", "--abbrev-ref", "@{upstream}"); upstream != "alice/fix-typo" {
+			t.Errorf("Expected fix-typo to track alice/fix-typo, got %q", upstream)
+		}
+	})
+
+	t.Run("failed fork fetch removes the remote", func(t *testing.T) {
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "bob:fix"}); err == nil {
+			t.Fatal("Expected error for a missing fork")
+		}
+		if remotes, err := repo.Remotes(ctx); err != nil || len(remotes) != 3 {
+			t.Errorf("Expected the remote bob to be removed, got %+v, %v", remotes, err)
+		}
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: ":fix"}); err == nil || !strings.Contains(err.Error(), "expected <user>:<branch>") {
+			t.Errorf("Expected error for an empty user, got %v", err)
+		}
+	})
+
+	t.Run("switch to a remote branch", func(t *testing.T) {
+		if err := repo.Switch(ctx, SwitchOptions{Target: "upstream/release"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+		if branch := runGit(t, repo.WorkspacePath(), "branch", "--show-current"); branch != "release" {
+			t.Errorf("Expected workspace on release, got %q", branch)
+		}
+	})
+
+	t.Run("unknown prefix is a plain commitish", func(t *testing.T) {
+		if _, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "nobody/main"}); err == nil {
+			t.Error("Expected error for unknown commitish")
+		}
+	})
+}
+
+func TestForkURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/org/repo.git": "https://github.com/alice/repo.git",
+		"git@github.com:org/repo.git":     "git@github.com:alice/repo.git",
+		"ssh://git@host/group/sub/repo":   "ssh://git@host/group/alice/repo",
+		"/srv/git/org/repo.git":           "/srv/git/alice/repo.git",
+	}
+
+	for url, expected := range tests {
+		got, err := ForkURL(url, "alice")
+		if err != nil || got != expected {
+			t.Errorf("ForkURL(%q) = %q, %v; want %q", url, got, err, expected)
+		}
+	}
+
+	if _, err := ForkURL("repo.git", "alice"); err == nil {
+		t.Error("Expected error for URL without owner")
+	}
+}
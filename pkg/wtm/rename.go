@@ -0,0 +1,122 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RenameOptions configures Repository.Rename.
+type RenameOptions struct {
+	// Old is the current name of the local branch.
+	Old string
+
+	// New is the new name of the branch.
+	New string
+
+	// Push pushes the branch under its new name and makes it the upstream.
+	// The remote of the current upstream is used, or origin when there is
+	// none.
+	Push bool
+
+	// DeleteRemote deletes the previous upstream branch after pushing. It
+	// requires Push.
+	DeleteRemote bool
+}
+
+// Rename renames a local branch. A worktree for the branch in tree/ moves to
+// the directory of the new name, taking its wtm metadata along. The upstream
+// is kept unless opts.Push publishes the new name.
+func (r *Repository) Rename(ctx context.Context, opts RenameOptions) error {
+	if opts.DeleteRemote && !opts.Push {
+		return fmt.Errorf("deleting the old remote branch requires pushing the new one")
+	}
+	g := r.backend()
+
+	if _, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", "refs/heads/"+opts.Old); err != nil {
+		return fmt.Errorf("branch %s does not exist", opts.Old)
+	}
+	if _, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", "refs/heads/"+opts.New); err == nil {
+		return fmt.Errorf("branch %s already exists", opts.New)
+	}
+
+	worktree, err := r.worktreeForBranch(ctx, opts.Old)
+	if err != nil {
+		return err
+	}
+
+	// Only worktrees named after the branch move; the workspace and
+	// worktrees elsewhere keep their path
+	source, destination := r.TreePath(opts.Old), r.TreePath(opts.New)
+	move := worktree != "" && samePath(worktree, source) && source != destination
+	if move {
+		if _, err := os.Stat(destination); err == nil {
+			return fmt.Errorf("%s already exists", destination)
+		}
+		r.printf("Moving %s to %s...\n", source, destination)
+		if err := r.moveWorktree(ctx, source, destination); err != nil {
+			return fmt.Errorf("error moving worktree: %w", err)
+		}
+	}
+
+	if _, err := g.Output(ctx, r.gitDir(), "branch", "-m", opts.Old, opts.New); err != nil {
+		if move {
+			if err := r.moveWorktree(ctx, destination, source); err != nil {
+				r.printf("Warning: could not move %s back to %s: %v\n", destination, source, err)
+			}
+		}
+		return fmt.Errorf("error renaming branch: %w", err)
+	}
+	r.printf("Renamed branch %s to %s\n", opts.Old, opts.New)
+
+	// git branch -m carries the upstream configuration over unchanged
+	remote, upstream, err := r.upstream(ctx, opts.New)
+	if err != nil {
+		return err
+	}
+
+	if !opts.Push {
+		if upstream != "" && upstream != opts.New {
+			r.printf("Note: %s still tracks %s/%s. Use --push to publish the new name\n", opts.New, remote, upstream)
+		}
+		r.printf("Successfully renamed %s to %s\n", opts.Old, opts.New)
+		return nil
+	}
+
+	// Branches of a bare clone track nothing; their remote counterpart has
+	// the same name
+	if remote == "" {
+		remote = "origin"
+		if _, err := g.RevParse(ctx, r.gitDir(), "--verify", "--quiet", "refs/remotes/"+remote+"/"+opts.Old); err == nil {
+			upstream = opts.Old
+		}
+	}
+	r.printf("Pushing %s to %s...\n", opts.New, remote)
+	if err := g.Run(ctx, r.gitDir(), "push", "--set-upstream", remote, opts.New); err != nil {
+		return fmt.Errorf("error pushing %s: %w", opts.New, err)
+	}
+	if opts.DeleteRemote && upstream != "" && upstream != opts.New {
+		r.printf("Deleting %s on %s...\n", upstream, remote)
+		if err := g.Run(ctx, r.gitDir(), "push", remote, "--delete", upstream); err != nil {
+			return fmt.Errorf("error deleting remote branch %s: %w", upstream, err)
+		}
+	}
+
+	r.printf("Successfully renamed %s to %s\n", opts.Old, opts.New)
+	return nil
+}
+
+// upstream returns the remote and remote branch name branch tracks. Both
+// are empty when it tracks no remote branch.
+func (r *Repository) upstream(ctx context.Context, branch string) (string, string, error) {
+	remotes, err := r.configValues(ctx, "branch."+branch+".remote")
+	if err != nil || len(remotes) == 0 || remotes[0] == "." {
+		return "", "", err
+	}
+	merges, err := r.configValues(ctx, "branch."+branch+".merge")
+	if err != nil || len(merges) == 0 {
+		return "", "", err
+	}
+	return remotes[0], strings.TrimPrefix(merges[0], "refs/heads/"), nil
+}
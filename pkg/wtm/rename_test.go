@@ -0,0 +1,98 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	root := filepath.Join(t.TempDir(), "project")
+	clone, err := Clone(ctx, CloneOptions{URL: repo.Root, Dir: root})
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	runGit(t, root, "branch", "--set-upstream-to", "origin/feature-branch", "feature-branch")
+	path, err := clone.Checkout(ctx, CheckoutOptions{Commitish: "feature-branch"})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if err := clone.AddLabels(path, "wip"); err != nil {
+		t.Fatalf("AddLabels failed: %v", err)
+	}
+
+	t.Run("moves worktree and metadata", func(t *testing.T) {
+		if err := clone.Rename(ctx, RenameOptions{Old: "feature-branch", New: "feature/renamed"}); err != nil {
+			t.Fatalf("Rename failed: %v", err)
+		}
+
+		newPath := clone.TreePath("feature/renamed")
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be moved", path)
+		}
+		if branch := runGit(t, newPath, "branch", "--show-current"); branch != "feature/renamed" {
+			t.Errorf("Expected feature/renamed checked out in %s, got %q", newPath, branch)
+		}
+		if m, _ := clone.Metadata(newPath); !m.HasLabels("wip") {
+			t.Errorf("Expected labels to move with the worktree, got %+v", m)
+		}
+		if merge := runGit(t, root, "config", "branch.feature/renamed.merge"); merge != "refs/heads/feature-branch" {
+			t.Errorf("Expected upstream to be kept, got %q", merge)
+		}
+	})
+
+	t.Run("push and delete remote", func(t *testing.T) {
+		err := clone.Rename(ctx, RenameOptions{Old: "feature/renamed", New: "feature-final", Push: true, DeleteRemote: true})
+		if err != nil {
+			t.Fatalf("Rename failed: %v", err)
+		}
+
+		branches := runGit(t, repo.Root, "branch", "--list")
+		if !strings.Contains(branches, "feature-final") || strings.Contains(branches, "feature-branch") {
+			t.Errorf("Expected remote branch to be renamed, got %q", branches)
+		}
+		if upstream := runGit(t, clone.TreePath("feature-final"), "rev-parse", "--abbrev-ref", "@{upstream}"); upstream != "origin/feature-final" {
+			t.Errorf("Expected upstream origin/feature-final, got %q", upstream)
+		}
+	})
+
+	t.Run("delete remote without upstream", func(t *testing.T) {
+		runGit(t, repo.Root, "branch", "topic", "main")
+		runGit(t, root, "fetch", "origin")
+		runGit(t, root, "branch", "--no-track", "topic", "origin/topic")
+
+		if err := clone.Rename(ctx, RenameOptions{Old: "topic", New: "topic-2", Push: true, DeleteRemote: true}); err != nil {
+			t.Fatalf("Rename failed: %v", err)
+		}
+		if runGit(t, repo.Root, "branch", "--list", "topic") != "" || runGit(t, repo.Root, "branch", "--list", "topic-2") == "" {
+			t.Errorf("Expected remote topic to be renamed to topic-2")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if err := clone.Rename(ctx, RenameOptions{Old: "missing", New: "other"}); err == nil {
+			t.Error("Expected error for missing branch")
+		}
+		if err := clone.Rename(ctx, RenameOptions{Old: "feature-final", New: "main"}); err == nil {
+			t.Error("Expected error for existing branch")
+		}
+		if err := clone.Rename(ctx, RenameOptions{Old: "feature-final", New: "x", DeleteRemote: true}); err == nil {
+			t.Error("Expected error for --delete-remote without --push")
+		}
+	})
+
+	t.Run("workspace stays in place", func(t *testing.T) {
+		if err := clone.Rename(ctx, RenameOptions{Old: "main", New: "trunk"}); err != nil {
+			t.Fatalf("Rename failed: %v", err)
+		}
+		if branch := runGit(t, clone.WorkspacePath(), "branch", "--show-current"); branch != "trunk" {
+			t.Errorf("Expected trunk in the workspace, got %q", branch)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+// Package wtm implements the worktree manager workflow as a library.
+//
+// A wtm repository is a bare git repository that doubles as the root of a
+// small directory layout: the active worktree lives in workspace/, inactive
+// worktrees live in tree/<name> and files shared between worktrees are kept
+// in shared/. The wtm command line tool is a thin wrapper around this package,
+// so everything it does can also be done programmatically.
+package wtm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"wtm/pkg/git"
+)
+
+// Names of the directories wtm manages inside the repository root.
+const (
+	WorkspaceDir = "workspace"
+	TreeDir      = "tree"
+	SharedDir    = "shared"
+
+	// DotBareDir is the bare repository directory of the dotbare layout.
+	DotBareDir = ".bare"
+)
+
+// Layout is the way the bare repository and the wtm directories are
+// arranged on disk.
+type Layout string
+
+const (
+	// LayoutBare uses the bare repository itself as the root, with
+	// workspace/, tree/ and shared/ inside it.
+	LayoutBare Layout = "bare"
+
+	// LayoutDotBare keeps the bare repository in <root>/.bare and points
+	// <root>/.git at it, keeping workspace/, tree/ and shared/ next to it.
+	LayoutDotBare Layout = "dotbare"
+)
+
+// Repository is a bare repository managed by wtm.
+type Repository struct {
+	// Root is the absolute path of the directory containing workspace/,
+	// tree/ and shared/.
+	Root string
+
+	// GitDir is the absolute path of the bare git repository. It is the
+	// same as Root for the bare layout and Root/.bare for the dotbare
+	// layout. Root is used when empty.
+	GitDir string
+
+	// Stdout receives progress messages and the output of git commands.
+	// Output is discarded when nil.
+	Stdout io.Writer
+
+	// Stderr receives the error output of git commands.
+	// Output is discarded when nil.
+	Stderr io.Writer
+
+	// Git runs the git operations. The git executable is used when nil.
+	Git git.Git
+}
+
+// Open returns the wtm repository rooted at root, which must be either a
+// bare git repository or a directory whose .git file points to one.
+func Open(root string) (*Repository, error) {
+	return OpenWith(root, nil)
+}
+
+// OpenWith is like Open but runs git operations through g. The git
+// executable is used when g is nil.
+func OpenWith(root string, g git.Git) (*Repository, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving repository path: %w", err)
+	}
+
+	r := &Repository{Root: layoutRoot(abs), GitDir: abs, Git: g}
+	if gitDir, ok := readGitFile(abs); ok {
+		r.GitDir = gitDir
+	}
+
+	if !isBareRepository(context.Background(), r.backend(), r.GitDir) {
+		return nil, fmt.Errorf("not in a bare repository. Please run this command from a bare repository")
+	}
+
+	return r, nil
+}
+
+// Layout returns the on-disk layout of the repository.
+func (r *Repository) Layout() Layout {
+	if r.GitDir != "" && r.GitDir != r.Root {
+		return LayoutDotBare
+	}
+	return LayoutBare
+}
+
+// gitDir returns the directory repository-level git commands run in.
+func (r *Repository) gitDir() string {
+	if r.GitDir == "" {
+		return r.Root
+	}
+	return r.GitDir
+}
+
+// isBareRepository reports whether dir is itself a bare git repository, as
+// opposed to a directory nested inside one.
+func isBareRepository(ctx context.Context, g git.Git, dir string) bool {
+	output, err := g.RevParse(ctx, dir, "--absolute-git-dir", "--is-bare-repository")
+	if err != nil {
+		return false
+	}
+	gitDir, isBare, _ := strings.Cut(output, "\n")
+	return isBare == "true" && samePath(gitDir, dir)
+}
+
+// configValues returns every value of a git config key, or none when the
+// key is not set.
+func (r *Repository) configValues(ctx context.Context, key string) ([]string, error) {
+	output, err := r.backend().Output(ctx, r.gitDir(), "config", "--get-all", key)
+	if err != nil {
+		// git config exits with status 1 when the key is not set
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading git config %s: %w", key, err)
+	}
+
+	var values []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			values = append(values, line)
+		}
+	}
+	return values, nil
+}
+
+// readGitFile reads the .git file in dir and returns the absolute path of
+// the git directory it points to.
+func readGitFile(dir string) (string, bool) {
+	content, err := os.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return "", false
+	}
+
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+	if !ok {
+		return "", false
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return filepath.Clean(gitDir), true
+}
+
+// WorkspacePath returns the path of the active workspace worktree.
+func (r *Repository) WorkspacePath() string {
+	return filepath.Join(r.Root, WorkspaceDir)
+}
+
+// TreePath returns the path under tree/ used for the given branch or commit.
+func (r *Repository) TreePath(commitish string) string {
+	return filepath.Join(r.Root, TreeDir, SanitizeBranchName(commitish))
+}
+
+// SharedPath returns the path of the shared storage directory.
+func (r *Repository) SharedPath() string {
+	return filepath.Join(r.Root, SharedDir)
+}
+
+// SanitizeBranchName converts a branch name to a valid directory name by
+// replacing slashes with dashes.
+func SanitizeBranchName(name string) string {
+	return strings.ReplaceAll(name, "/", "-")
+}
+
+// printf writes a progress message to r.Stdout.
+func (r *Repository) printf(format string, args ...any) {
+	fmt.Fprintf(r.stdout(), format, args...)
+}
+
+func (r *Repository) stdout() io.Writer {
+	if r.Stdout == nil {
+		return io.Discard
+	}
+	return r.Stdout
+}
+
+func (r *Repository) stderr() io.Writer {
+	if r.Stderr == nil {
+		return io.Discard
+	}
+	return r.Stderr
+}
+
+// backend returns the Git implementation used by the repository.
+func (r *Repository) backend() git.Git {
+	if r.Git != nil {
+		return r.Git
+	}
+	return git.New(r.stdout(), r.stderr())
+}
@@ -0,0 +1,112 @@
+package wtm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newTestRepo creates a bare repository with a commit on main and a
+// feature-branch branch, and returns it opened as a wtm repository
+func newTestRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	bareRepoPath := filepath.Join(tempDir, "test-bare-repo")
+	runGit(t, tempDir, "init", "--bare", "--initial-branch=main", bareRepoPath)
+
+	tempClone := filepath.Join(tempDir, "temp-clone")
+	runGit(t, tempDir, "clone", bareRepoPath, tempClone)
+	runGit(t, tempClone, "config", "user.email", "test@example.com")
+	runGit(t, tempClone, "config", "user.name", "Test User")
+	runGit(t, tempClone, "checkout", "-b", "main")
+
+	if err := os.WriteFile(filepath.Join(tempClone, "README.md"), []byte("# Test\n"), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+	runGit(t, tempClone, "add", "README.md")
+	runGit(t, tempClone, "commit", "-m", "Initial commit")
+	runGit(t, tempClone, "push", "origin", "main")
+
+	runGit(t, tempClone, "checkout", "-b", "feature-branch")
+	if err := os.WriteFile(filepath.Join(tempClone, "feature.txt"), []byte("feature\n"), 0644); err != nil {
+		t.Fatalf("Failed to write feature file: %v", err)
+	}
+	runGit(t, tempClone, "add", "feature.txt")
+	runGit(t, tempClone, "commit", "-m", "Add feature")
+	runGit(t, tempClone, "push", "origin", "feature-branch")
+
+	repo, err := Open(bareRepoPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return repo
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("opens bare repository", func(t *testing.T) {
+		bareDir := t.TempDir()
+		runGit(t, bareDir, "init", "--bare", bareDir)
+
+		repo, err := Open(bareDir)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if repo.Root != bareDir {
+			t.Errorf("Expected root %q, got %q", bareDir, repo.Root)
+		}
+		if repo.WorkspacePath() != filepath.Join(bareDir, "workspace") {
+			t.Errorf("Unexpected workspace path %q", repo.WorkspacePath())
+		}
+		if repo.TreePath("feature/new") != filepath.Join(bareDir, "tree", "feature-new") {
+			t.Errorf("Unexpected tree path %q", repo.TreePath("feature/new"))
+		}
+	})
+
+	t.Run("error when not a bare repository", func(t *testing.T) {
+		repoDir := t.TempDir()
+		runGit(t, repoDir, "init", repoDir)
+
+		_, err := Open(repoDir)
+		if err == nil {
+			t.Fatal("Expected error for non-bare repository, got nil")
+		}
+		if !strings.Contains(err.Error(), "not in a bare repository") {
+			t.Errorf("Expected 'not in a bare repository' error, got: %v", err)
+		}
+	})
+}
+
+func TestSanitizeBranchName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"master", "master"},
+		{"feature/new-feature", "feature-new-feature"},
+		{"bugfix/critical/issue-123", "bugfix-critical-issue-123"},
+		{"7fd1a60", "7fd1a60"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := SanitizeBranchName(tt.input); got != tt.expected {
+				t.Errorf("SanitizeBranchName(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,639 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// RestoreMode is how a persisted entry is put into a worktree.
+type RestoreMode string
+
+const (
+	// RestoreCopy copies the entry.
+	RestoreCopy RestoreMode = "copy"
+
+	// RestoreLink creates a symlink to the entry in shared storage.
+	RestoreLink RestoreMode = "link"
+
+	// RestoreHardlink creates real directories and hard links the files of
+	// the entry. The files share their inode with shared storage, so
+	// changing one in place changes it in every worktree restored this way.
+	RestoreHardlink RestoreMode = "hardlink"
+
+	// RestoreReflink creates real directories and clones the files of the
+	// entry copy-on-write, on file systems that support it such as btrfs and
+	// xfs. Files are copied elsewhere.
+	RestoreReflink RestoreMode = "reflink"
+
+	// RestoreLinkFiles creates real directories and a symlink to shared
+	// storage for each file of the entry, like GNU stow. Files that tools
+	// add to the directories stay local to the worktree.
+	RestoreLinkFiles RestoreMode = "link-files"
+)
+
+// RestoreModes lists the valid restore modes.
+var RestoreModes = []RestoreMode{RestoreCopy, RestoreLink, RestoreHardlink, RestoreReflink, RestoreLinkFiles}
+
+// validate reports an error unless m is empty or a known mode.
+func (m RestoreMode) validate() error {
+	if m == "" || slices.Contains(RestoreModes, m) {
+		return nil
+	}
+	return fmt.Errorf("unknown restore mode %q (expected one of %v)", m, RestoreModes)
+}
+
+// RestoreOptions configures Repository.Restore.
+type RestoreOptions struct {
+	// Worktree is the root of the worktree to restore into.
+	Worktree string
+
+	// Path is the entry to restore, relative to the shared directory, or a
+	// pattern selecting entries. It is ignored when All is set.
+	Path string
+
+	// All restores every persisted entry at its exact path, merging into
+	// directories that already exist in the worktree. When the worktree or
+	// the repository has a .wtmpersist file, only the entries it declares
+	// are restored, in the modes it declares.
+	All bool
+
+	// Exclude deselects the entries matching these patterns when Path is a
+	// pattern or All is set. See PersistRule for the syntax.
+	Exclude []string
+
+	// To restores Path to a different location, either absolute or relative
+	// to Worktree.
+	To string
+
+	// Mode is how entries are restored. When empty, each entry is restored
+	// in the mode recorded for it, or copied. Otherwise the mode is recorded
+	// for the restored entries.
+	Mode RestoreMode
+
+	// Link creates a symlink to shared storage instead of copying. It is a
+	// shorthand for Mode RestoreLink and conflicts with any other Mode.
+	Link bool
+
+	// Force overwrites existing files.
+	Force bool
+}
+
+// Restore copies or links persisted files from shared storage into a
+// worktree.
+func (r *Repository) Restore(ctx context.Context, opts RestoreOptions) error {
+	if _, err := os.Stat(r.SharedPath()); os.IsNotExist(err) {
+		return fmt.Errorf("no persisted files found. Use 'wtm persist add <file>' to persist files first")
+	}
+	if opts.Link {
+		if opts.Mode != "" && opts.Mode != RestoreLink {
+			return fmt.Errorf("cannot use --link with --mode %s", opts.Mode)
+		}
+		opts.Mode = RestoreLink
+	}
+	if err := opts.Mode.validate(); err != nil {
+		return err
+	}
+
+	branch := r.worktreeLayer(ctx, opts.Worktree)
+	if opts.All {
+		return r.restoreAll(ctx, opts, branch)
+	}
+	if IsPattern(opts.Path) || len(opts.Exclude) > 0 {
+		return r.restorePattern(ctx, opts, branch)
+	}
+	if branch != "" {
+		return r.restoreLayers(ctx, opts, branch)
+	}
+	if err := r.restoreFile(ctx, opts, ""); err != nil {
+		return err
+	}
+	r.rememberMode(opts.Path, opts.Mode)
+	return nil
+}
+
+// restoreLayers restores the entry opts.Path from the most specific layer
+// of shared storage for branch, followed by the entries of the branch layer
+// inside it.
+func (r *Repository) restoreLayers(ctx context.Context, opts RestoreOptions, branch string) error {
+	key := filepath.ToSlash(filepath.Clean(opts.Path))
+	rules, err := NewPersistRules([]string{EscapePattern(key)}, nil, "")
+	if err != nil {
+		return err
+	}
+	matches, err := r.layeredMatches(branch, rules)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return r.restoreFile(ctx, opts, "")
+	}
+
+	var restored []string
+	for _, match := range matches {
+		entryOpts := opts
+		entryOpts.Path = filepath.FromSlash(match.Path)
+		if opts.To != "" && match.Path != key {
+			entryOpts.To = filepath.Join(opts.To, filepath.FromSlash(strings.TrimPrefix(match.Path, key+"/")))
+		}
+		if match.Overlay && !r.overlayAllowed(&entryOpts, match, restored) {
+			continue
+		}
+		if err := r.restoreFile(ctx, entryOpts, match.Layer); err != nil {
+			return err
+		}
+		if match.Layer == "" {
+			restored = append(restored, match.Path)
+		}
+		r.rememberMode(BranchPath(match.Layer, match.Path), opts.Mode)
+	}
+	return nil
+}
+
+// overlayAllowed reports whether the overlay match is restored with opts.
+// What is at its destination is replaced when the common entry containing
+// it, one of restored, put it there earlier in this run; anything else only
+// with opts.Force, and the match is skipped otherwise.
+func (r *Repository) overlayAllowed(opts *RestoreOptions, match ruleMatch, restored []string) bool {
+	if opts.Force {
+		return true
+	}
+	destPath := restoreDest(*opts)
+	if _, err := os.Lstat(destPath); os.IsNotExist(err) {
+		return true
+	}
+
+	fromCommon := slices.ContainsFunc(restored, func(path string) bool {
+		return strings.HasPrefix(match.Path, path+"/")
+	})
+	if _, err := os.Lstat(r.sharedFile(match.Path)); fromCommon && err == nil {
+		opts.Force = true
+		return true
+	}
+	relDestPath, _ := filepath.Rel(opts.Worktree, destPath)
+	r.printf("Keeping %s: it was not restored from the common layer in this run\nUse --force to replace it with the %s layer\n", relDestPath, match.Layer)
+	return false
+}
+
+// restoreFile restores the entry opts.Path of the layer of branch, or of the
+// common entries when branch is empty.
+func (r *Repository) restoreFile(ctx context.Context, opts RestoreOptions, branch string) error {
+	sharedKey := BranchPath(branch, filepath.ToSlash(filepath.Clean(opts.Path)))
+	sourcePath := r.sharedFile(sharedKey)
+
+	sourceInfo, err := os.Lstat(sourcePath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("file not found in shared storage: %s\nUse 'wtm persist list' to see available files", opts.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("error accessing shared file: %w", err)
+	}
+
+	destPath := restoreDest(opts)
+
+	// Writing below a link would change shared storage itself
+	for dir := filepath.Dir(destPath); strings.HasPrefix(dir, opts.Worktree+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if r.linksToShared(dir) {
+			return fmt.Errorf("%s is linked to shared storage\nUse 'wtm unrestore' first to restore into it", dir)
+		}
+	}
+
+	destInfo, err := os.Lstat(destPath)
+	exists := err == nil
+
+	mode := opts.Mode
+	if mode == "" {
+		entries, err := r.loadManifest()
+		if err != nil {
+			return err
+		}
+		if i := manifestEntry(entries, sharedKey); i >= 0 {
+			mode = entries[i].Mode
+		}
+	}
+
+	// Copied directories are merged into existing ones file by file
+	merge := exists && destInfo.IsDir() && sourceInfo.IsDir() && mode != RestoreLink
+	if exists && !merge && !opts.Force {
+		return fmt.Errorf("file already exists: %s\nUse --force to overwrite", destPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("error creating parent directories: %w", err)
+	}
+
+	action := "Copying"
+	switch mode {
+	case RestoreLink:
+		action = "Linking"
+	case RestoreHardlink:
+		action = "Hard linking"
+	case RestoreReflink:
+		action = "Cloning"
+	case RestoreLinkFiles:
+		action = "Linking the files of"
+	}
+
+	relDestPath, _ := filepath.Rel(opts.Worktree, destPath)
+	r.printf("%s shared/%s to %s...\n", action, sharedKey, relDestPath)
+
+	if exists && opts.Force && !merge {
+		if err := os.RemoveAll(destPath); err != nil {
+			return fmt.Errorf("error removing existing file: %w", err)
+		}
+	}
+
+	if mode == RestoreLink {
+		// Use a relative link so the layout can be moved as a whole
+		relLink, err := filepath.Rel(filepath.Dir(destPath), sourcePath)
+		if err != nil {
+			return fmt.Errorf("error calculating relative link path: %w", err)
+		}
+
+		if err := os.Symlink(relLink, destPath); err != nil {
+			return fmt.Errorf("error creating symlink: %w", err)
+		}
+	} else {
+		copy, copied := modeCopier(mode)
+		copyOpts := copyOptions{File: copy, Skipped: r.warnSkipped, Progress: r.Stderr}
+		if merge {
+			err = mergeDir(ctx, sourcePath, destPath, opts.Force, copyOpts)
+		} else if err = copyPath(ctx, sourcePath, destPath, copyOpts); err != nil {
+			if sourceInfo.IsDir() {
+				err = fmt.Errorf("error copying directory: %w", err)
+			} else {
+				err = fmt.Errorf("error copying file: %w", err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case copied.Load() > 0 && mode == RestoreReflink:
+			r.printf("Warning: the file system cannot clone files, %d file(s) were copied\n", copied.Load())
+		case copied.Load() > 0:
+			r.printf("Warning: %d file(s) could not be hard linked and were copied\n", copied.Load())
+		case mode == RestoreHardlink:
+			r.printf("Warning: the files share their inode with shared/%s. Editing one in place changes it in shared storage and in every worktree restored with hard links\n", sharedKey)
+		}
+	}
+
+	r.printf("Successfully restored to %s\n", relDestPath)
+	return nil
+}
+
+// restoreDest returns where opts restores its entry: opts.To, relative to
+// the worktree unless absolute, or the path of the entry in the worktree.
+func restoreDest(opts RestoreOptions) string {
+	if opts.To == "" {
+		return filepath.Join(opts.Worktree, opts.Path)
+	}
+	if filepath.IsAbs(opts.To) {
+		return opts.To
+	}
+	return filepath.Join(opts.Worktree, opts.To)
+}
+
+// modeCopier returns the function writing a file in mode, which must not be
+// RestoreLink, or nil to copy it with copyFile, and the number of files it
+// copied because the file system could not link or clone them.
+func modeCopier(mode RestoreMode) (func(src, dst string) error, *atomic.Int64) {
+	copied := new(atomic.Int64)
+	var fallback func(src, dst string) (bool, error)
+	switch mode {
+	case RestoreHardlink:
+		fallback = linkFile
+	case RestoreReflink:
+		fallback = cloneFile
+	case RestoreLinkFiles:
+		return symlinkFile, copied
+	default:
+		return nil, copied
+	}
+	return func(src, dst string) error {
+		didCopy, err := fallback(src, dst)
+		if didCopy {
+			copied.Add(1)
+		}
+		return err
+	}, copied
+}
+
+// rememberMode records mode for the manifest entry at path when it is
+// explicitly asked for, so that later restores use it too.
+func (r *Repository) rememberMode(path string, mode RestoreMode) {
+	if mode == "" {
+		return
+	}
+	entries, err := r.loadManifest()
+	if err != nil {
+		r.printf("Warning: could not record the restore mode: %v\n", err)
+		return
+	}
+	i := manifestEntry(entries, filepath.ToSlash(filepath.Clean(path)))
+	if i < 0 || entries[i].Mode == mode {
+		return
+	}
+	entries[i].Mode = mode
+	if err := r.saveManifest(entries); err != nil {
+		r.printf("Warning: could not record the restore mode: %v\n", err)
+	}
+}
+
+// restoreAll restores the entries declared by the .wtmpersist files, or
+// every manifest entry and every unmanaged path in shared storage when there
+// are none. Entries are restored at their own path, so that a persisted
+// src/config.json lands in the worktree's src/ without touching its other
+// files.
+func (r *Repository) restoreAll(ctx context.Context, opts RestoreOptions, branch string) error {
+	rules, err := r.PersistRules(opts.Worktree)
+	if err != nil {
+		return err
+	}
+
+	var matches []ruleMatch
+	if rules != nil {
+		r.printf("Restoring the files declared in %s...\n", PersistFile)
+		excludes, err := NewPersistRules(nil, opts.Exclude, "")
+		if err != nil {
+			return err
+		}
+		if matches, err = r.layeredMatches(branch, append(rules, excludes...)); err != nil {
+			return err
+		}
+	} else {
+		r.printf("Restoring all persisted files...\n")
+		if matches, err = r.matchPersisted(ctx, branch, nil, opts.Exclude); err != nil {
+			return err
+		}
+	}
+	return r.restoreMatches(ctx, opts, matches)
+}
+
+// restorePattern restores the entries matching the pattern opts.Path.
+func (r *Repository) restorePattern(ctx context.Context, opts RestoreOptions, branch string) error {
+	if opts.To != "" {
+		return fmt.Errorf("cannot restore a pattern to a different path")
+	}
+	patterns := []string{opts.Path}
+	if opts.Path == "" {
+		patterns = nil
+	}
+	matches, err := r.matchPersisted(ctx, branch, patterns, opts.Exclude)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no persisted files match %s\nUse 'wtm persist list' to see available files", opts.Path)
+	}
+	return r.restoreMatches(ctx, opts, matches)
+}
+
+// matchPersisted returns the paths in shared storage matching patterns but
+// not excludes, layered for branch. Without patterns, every common entry and
+// every entry of the branch layer is a candidate.
+func (r *Repository) matchPersisted(ctx context.Context, branch string, patterns, excludes []string) ([]ruleMatch, error) {
+	if patterns == nil {
+		entries, err := r.Persisted(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Layer == "" || entry.Layer == branch {
+				patterns = append(patterns, EscapePattern(entry.Key()))
+			}
+		}
+	}
+	rules, err := NewPersistRules(patterns, excludes, "")
+	if err != nil {
+		return nil, err
+	}
+	return r.layeredMatches(branch, rules)
+}
+
+// restoreMatches restores each match at its own path. The mode of the
+// options wins over the mode of the match.
+func (r *Repository) restoreMatches(ctx context.Context, opts RestoreOptions, matches []ruleMatch) error {
+	count := 0
+	var failures, restored []string
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entryOpts := opts
+		entryOpts.Path = filepath.FromSlash(match.Path)
+		entryOpts.To = ""
+		if entryOpts.Mode == "" {
+			entryOpts.Mode = match.Mode
+		}
+
+		r.printf("\nRestoring %s...\n", match.Path)
+		if match.Overlay && !r.overlayAllowed(&entryOpts, match, restored) {
+			continue
+		}
+		if err := r.restoreFile(ctx, entryOpts, match.Layer); err != nil {
+			failure := fmt.Sprintf("  ❌ %s: %v", match.Path, err)
+			r.printf("%s\n", failure)
+			failures = append(failures, failure)
+			continue
+		}
+		if match.Layer == "" {
+			restored = append(restored, match.Path)
+		}
+		r.printf("  ✓ %s\n", match.Path)
+		r.rememberMode(BranchPath(match.Layer, match.Path), opts.Mode)
+		count++
+	}
+
+	r.printf("\nRestored %d file(s)\n", count)
+
+	if len(failures) > 0 {
+		r.printf("\nErrors encountered:\n%s\n", strings.Join(failures, "\n"))
+		return fmt.Errorf("some files failed to restore")
+	}
+
+	return nil
+}
+
+// mergeDir copies the files of the directory src into the existing
+// directory dst with opts, keeping files of dst that src does not have.
+// Files present in both are overwritten when force is set; otherwise nothing
+// is copied and the conflicts are reported. Symlinks to the files of src are
+// left as they are.
+func mergeDir(ctx context.Context, src, dst string, force bool, opts copyOptions) error {
+	var conflicts []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if _, err := os.Lstat(target); err == nil && !linksTo(target, path) {
+			conflicts = append(conflicts, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading shared directory: %w", err)
+	}
+	if len(conflicts) > 0 && !force {
+		return fmt.Errorf("files already exist in %s: %s\nUse --force to overwrite", dst, strings.Join(conflicts, ", "))
+	}
+
+	opts.Merge = true
+	err = copyPath(ctx, src, dst, opts)
+	if err != nil {
+		return fmt.Errorf("error merging directory: %w", err)
+	}
+	return nil
+}
+
+// UnrestoreOptions configures Repository.Unrestore.
+type UnrestoreOptions struct {
+	// Worktree is the root of the worktree to clean up.
+	Worktree string
+
+	// Path is the entry to unrestore, relative to the shared directory, or
+	// a pattern selecting entries. It is ignored when All is set.
+	Path string
+
+	// All unrestores every persisted entry.
+	All bool
+}
+
+// Unrestore removes the symlinks that restore created for persisted entries
+// from a worktree: the links pointing into shared storage, whether they link
+// an entry as a whole or its individual files, and the directories that
+// removing them leaves empty. Local files, including copies of persisted
+// files, are left alone.
+func (r *Repository) Unrestore(ctx context.Context, opts UnrestoreOptions) error {
+	var paths []string
+	if opts.All || IsPattern(opts.Path) {
+		var patterns []string
+		if !opts.All {
+			patterns = []string{opts.Path}
+		}
+		matches, err := r.matchPersisted(ctx, r.worktreeLayer(ctx, opts.Worktree), patterns, nil)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			paths = append(paths, match.Path)
+		}
+	} else {
+		paths = []string{opts.Path}
+	}
+
+	removed, kept := 0, 0
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, k, err := r.unlinkShared(filepath.Join(opts.Worktree, filepath.FromSlash(path)))
+		if err != nil {
+			return fmt.Errorf("error unrestoring %s: %w", path, err)
+		}
+		if n > 0 {
+			r.printf("Removed %d link(s) from %s\n", n, path)
+		}
+		removed += n
+		kept += k
+	}
+
+	r.printf("Successfully removed %d link(s)", removed)
+	if kept > 0 {
+		r.printf(", kept %d local file(s)", kept)
+	}
+	r.printf("\n")
+	return nil
+}
+
+// unlinkShared removes the symlinks into shared storage at or below path,
+// and the directories left empty by it. It returns how many links it removed
+// and how many other files it kept.
+func (r *Repository) unlinkShared(path string) (int, int, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if !info.IsDir() {
+		if !r.linksToShared(path) {
+			return 0, 1, nil
+		}
+		return 1, 0, os.Remove(path)
+	}
+
+	removed, kept := 0, 0
+	var dirs []string
+	emptied := map[string]bool{}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		if !r.linksToShared(p) {
+			kept++
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		for dir := filepath.Dir(p); !emptied[dir] && strings.HasPrefix(dir, path); dir = filepath.Dir(dir) {
+			emptied[dir] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, kept, err
+	}
+
+	// Children come after their parents in walk order
+	for _, dir := range slices.Backward(dirs) {
+		if emptied[dir] {
+			os.Remove(dir) // fails when local files are left
+		}
+	}
+	return removed, kept, nil
+}
+
+// linksToShared reports whether path is a symlink into shared storage.
+func (r *Repository) linksToShared(path string) bool {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	rel, err := filepath.Rel(r.SharedPath(), target)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// linksTo reports whether path is a symlink to target.
+func linksTo(path, target string) bool {
+	link, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(path), link)
+	}
+	return filepath.Clean(link) == filepath.Clean(target)
+}
@@ -0,0 +1,284 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	t.Run("error when nothing persisted", func(t *testing.T) {
+		err := repo.Restore(ctx, RestoreOptions{Worktree: t.TempDir(), All: true})
+		if err == nil || !strings.Contains(err.Error(), "no persisted files") {
+			t.Errorf("Expected 'no persisted files' error, got: %v", err)
+		}
+	})
+
+	sharedDir := repo.SharedPath()
+	if err := os.MkdirAll(filepath.Join(sharedDir, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create shared dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sharedDir, ".env"), []byte("KEY=value"), 0644); err != nil {
+		t.Fatalf("Failed to write shared file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sharedDir, "lib", "util.js"), []byte("util"), 0644); err != nil {
+		t.Fatalf("Failed to write shared file: %v", err)
+	}
+
+	t.Run("copies a file", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: ".env"}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		info, err := os.Lstat(filepath.Join(worktree, ".env"))
+		if err != nil {
+			t.Fatalf("Restored file missing: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			t.Error("Expected regular file, got symlink")
+		}
+	})
+
+	t.Run("links a directory to a custom path", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", To: "vendor/lib", Link: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		linkPath := filepath.Join(worktree, "vendor", "lib")
+		target, err := os.Readlink(linkPath)
+		if err != nil {
+			t.Fatalf("Expected symlink: %v", err)
+		}
+		if filepath.IsAbs(target) {
+			t.Errorf("Expected relative link target, got %q", target)
+		}
+		if _, err := os.Stat(filepath.Join(linkPath, "util.js")); err != nil {
+			t.Errorf("Link does not resolve: %v", err)
+		}
+	})
+
+	t.Run("refuses to overwrite without force", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := os.WriteFile(filepath.Join(worktree, ".env"), []byte("local"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: ".env"})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected 'already exists' error, got: %v", err)
+		}
+
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: ".env", Force: true}); err != nil {
+			t.Fatalf("Restore with Force failed: %v", err)
+		}
+		content, _ := os.ReadFile(filepath.Join(worktree, ".env"))
+		if string(content) != "KEY=value" {
+			t.Errorf("Expected file to be overwritten, got %q", string(content))
+		}
+	})
+
+	t.Run("uses the recorded mode", func(t *testing.T) {
+		if err := repo.saveManifest([]SharedEntry{{Path: "lib", IsDir: true, Mode: RestoreLink}}); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(repo.manifestPath())
+
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib"}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if _, err := os.Readlink(filepath.Join(worktree, "lib")); err != nil {
+			t.Errorf("Expected lib to be linked: %v", err)
+		}
+
+		worktree = t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Mode: RestoreCopy}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if info, err := os.Lstat(filepath.Join(worktree, "lib")); err != nil || !info.IsDir() {
+			t.Errorf("Expected lib to be copied, got %v, %v", info, err)
+		}
+		if entries, _ := repo.loadManifest(); entries[0].Mode != RestoreCopy {
+			t.Errorf("Expected the requested mode to be recorded, got %q", entries[0].Mode)
+		}
+	})
+
+	t.Run("refuses conflicting link and mode", func(t *testing.T) {
+		worktree := t.TempDir()
+		err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Link: true, Mode: RestoreCopy})
+		if err == nil || !strings.Contains(err.Error(), "cannot use --link with --mode copy") {
+			t.Errorf("Expected a conflict error, got: %v", err)
+		}
+		if _, err := os.Lstat(filepath.Join(worktree, "lib")); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing to be restored, got %v", err)
+		}
+	})
+
+	t.Run("hard links files", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Mode: RestoreHardlink}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		dirInfo, err := os.Lstat(filepath.Join(worktree, "lib"))
+		if err != nil || !dirInfo.IsDir() {
+			t.Fatalf("Expected a real directory, got %v, %v", dirInfo, err)
+		}
+		restored, err := os.Stat(filepath.Join(worktree, "lib", "util.js"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shared, _ := os.Stat(filepath.Join(sharedDir, "lib", "util.js"))
+		if !os.SameFile(restored, shared) {
+			t.Error("Expected util.js to share its inode with shared storage")
+		}
+	})
+
+	t.Run("clones files or falls back to copying", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Mode: RestoreReflink}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		restored, err := os.Stat(filepath.Join(worktree, "lib", "util.js"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shared, _ := os.Stat(filepath.Join(sharedDir, "lib", "util.js"))
+		if os.SameFile(restored, shared) {
+			t.Error("Expected util.js to be a file of its own")
+		}
+		if content, _ := os.ReadFile(filepath.Join(worktree, "lib", "util.js")); string(content) != "util" {
+			t.Errorf("Unexpected content %q", content)
+		}
+	})
+
+	t.Run("links files and unrestores them", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Mode: RestoreLinkFiles}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		dirInfo, err := os.Lstat(filepath.Join(worktree, "lib"))
+		if err != nil || !dirInfo.IsDir() {
+			t.Fatalf("Expected a real directory, got %v, %v", dirInfo, err)
+		}
+		target, err := os.Readlink(filepath.Join(worktree, "lib", "util.js"))
+		if err != nil || filepath.IsAbs(target) {
+			t.Fatalf("Expected a relative symlink, got %q, %v", target, err)
+		}
+
+		// Restoring again keeps the links and needs no --force
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Mode: RestoreLinkFiles}); err != nil {
+			t.Fatalf("Restoring again failed: %v", err)
+		}
+
+		local := filepath.Join(worktree, "lib", "local.js")
+		if err := os.WriteFile(local, []byte("local"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Unrestore(ctx, UnrestoreOptions{Worktree: worktree, Path: "lib"}); err != nil {
+			t.Fatalf("Unrestore failed: %v", err)
+		}
+		if _, err := os.Lstat(filepath.Join(worktree, "lib", "util.js")); !os.IsNotExist(err) {
+			t.Errorf("Expected the link to be removed, got %v", err)
+		}
+		if _, err := os.Stat(local); err != nil {
+			t.Errorf("Expected the local file to be kept: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(sharedDir, "lib", "util.js")); err != nil {
+			t.Errorf("Expected shared storage to be left alone: %v", err)
+		}
+
+		os.Remove(local)
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: "lib", Mode: RestoreLinkFiles}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if err := repo.Unrestore(ctx, UnrestoreOptions{Worktree: worktree, All: true}); err != nil {
+			t.Fatalf("Unrestore failed: %v", err)
+		}
+		if _, err := os.Lstat(filepath.Join(worktree, "lib")); !os.IsNotExist(err) {
+			t.Errorf("Expected the emptied directory to be removed, got %v", err)
+		}
+	})
+
+	t.Run("unrestore keeps copies", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, Path: ".env"}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		if err := repo.Unrestore(ctx, UnrestoreOptions{Worktree: worktree, Path: ".env"}); err != nil {
+			t.Fatalf("Unrestore failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(worktree, ".env")); err != nil {
+			t.Errorf("Expected the copy to be kept: %v", err)
+		}
+	})
+
+	t.Run("restores all entries", func(t *testing.T) {
+		worktree := t.TempDir()
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, All: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+
+		for _, path := range []string{".env", filepath.Join("lib", "util.js")} {
+			if _, err := os.Stat(filepath.Join(worktree, path)); err != nil {
+				t.Errorf("Expected %s to be restored: %v", path, err)
+			}
+		}
+	})
+
+	t.Run("restores nested entries into existing directories", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(sharedDir, "src"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sharedDir, "src", "config.json"), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.saveManifest([]SharedEntry{{Path: "src/config.json"}}); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(repo.manifestPath())
+		defer os.RemoveAll(filepath.Join(sharedDir, "src"))
+
+		worktree := t.TempDir()
+		for _, dir := range []string{"src", "lib"} {
+			if err := os.MkdirAll(filepath.Join(worktree, dir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, file := range []string{filepath.Join("src", "main.go"), filepath.Join("lib", "local.js")} {
+			if err := os.WriteFile(filepath.Join(worktree, file), []byte("local"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, All: true}); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		for _, path := range []string{".env", filepath.Join("src", "config.json"), filepath.Join("src", "main.go"), filepath.Join("lib", "util.js"), filepath.Join("lib", "local.js")} {
+			if _, err := os.Stat(filepath.Join(worktree, path)); err != nil {
+				t.Errorf("Expected %s in the worktree: %v", path, err)
+			}
+		}
+
+		// Restoring again conflicts on the files themselves, not their parents
+		err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, All: true})
+		if err == nil {
+			t.Fatal("Expected conflicts when restoring again")
+		}
+		if err := repo.Restore(ctx, RestoreOptions{Worktree: worktree, All: true, Force: true}); err != nil {
+			t.Fatalf("Restore with Force failed: %v", err)
+		}
+		if content, _ := os.ReadFile(filepath.Join(worktree, "src", "main.go")); string(content) != "local" {
+			t.Errorf("Expected unrelated files to be kept, got %q", content)
+		}
+	})
+}
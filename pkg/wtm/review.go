@@ -0,0 +1,181 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultReviewExpiry is how long review worktrees are kept by default.
+const DefaultReviewExpiry = 7 * 24 * time.Hour
+
+// reviewMarker is the file in a worktree's git directory that marks it as a
+// review worktree. It holds the expiry time, or "never".
+const reviewMarker = "wtm-review"
+
+// reviewGuard is the pre-commit hook snippet that blocks commits in review
+// worktrees. Its first line identifies it when the hook is inspected.
+const reviewGuard = `# wtm review guard
+if [ -f "$(git rev-parse --git-dir)/` + reviewMarker + `" ]; then
+	echo "wtm: this is a read-only review worktree, commits are blocked" >&2
+	echo "wtm: use 'wtm checkout <branch>' to work on the branch instead" >&2
+	exit 1
+fi
+`
+
+// ReviewOptions configures Repository.Review.
+type ReviewOptions struct {
+	// Ref is the branch, commit or remote branch to review. Remote branches
+	// are accepted in the forms Checkout understands.
+	Ref string
+
+	// Expires is how long the review worktree is kept before prune removes
+	// it. Zero keeps it until it is removed by hand.
+	Expires time.Duration
+
+	// Restore restores all persisted files into the new worktree.
+	Restore bool
+}
+
+// Review creates a read-only worktree for opts.Ref in tree/review-<name>
+// and returns its path. The worktree is detached, locked with a reason and
+// guarded by a pre-commit hook that blocks commits in it.
+func (r *Repository) Review(ctx context.Context, opts ReviewOptions) (string, error) {
+	commitish := opts.Ref
+	remote, branch, ok, err := r.remoteBranch(ctx, opts.Ref)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		commitish = "refs/remotes/" + remote + "/" + branch
+	}
+	if err := r.ensureCommitish(ctx, commitish); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Join(r.Root, TreeDir), 0755); err != nil {
+		return "", fmt.Errorf("error creating tree directory: %w", err)
+	}
+	worktreePath := r.TreePath("review-" + opts.Ref)
+	if _, err := os.Stat(worktreePath); err == nil {
+		return "", fmt.Errorf("review worktree already exists at %s", worktreePath)
+	}
+
+	r.printf("Creating review worktree for '%s' at %s...\n", opts.Ref, worktreePath)
+	g := r.backend()
+	if err := g.Run(ctx, r.gitDir(), "worktree", "add", "--detach", worktreePath, commitish); err != nil {
+		return "", fmt.Errorf("error creating worktree: %w", err)
+	}
+
+	expiry := "never"
+	reason := "wtm review worktree"
+	if opts.Expires > 0 {
+		expires := time.Now().Add(opts.Expires).UTC().Truncate(time.Second)
+		expiry = expires.Format(time.RFC3339)
+		reason += ", expires " + expiry
+	}
+
+	adminDir, err := g.RevParse(ctx, worktreePath, "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("error locating worktree git directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(adminDir, reviewMarker), []byte(expiry+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("error marking review worktree: %w", err)
+	}
+	if err := r.installReviewGuard(ctx, worktreePath); err != nil {
+		return "", err
+	}
+	if _, err := g.Output(ctx, r.gitDir(), "worktree", "lock", "--reason", reason, worktreePath); err != nil {
+		return "", fmt.Errorf("error locking worktree: %w", err)
+	}
+
+	if opts.Restore {
+		if err := r.Restore(ctx, RestoreOptions{Worktree: worktreePath, All: true}); err != nil {
+			return "", fmt.Errorf("error restoring persisted files: %w", err)
+		}
+	}
+
+	r.printf("Successfully created review worktree at %s (%s)\n", worktreePath, reason)
+	return worktreePath, nil
+}
+
+// installReviewGuard adds the review guard to the pre-commit hook used by
+// worktree. An existing shell hook gets the guard inserted after its
+// shebang line; other hooks are left alone with a warning.
+func (r *Repository) installReviewGuard(ctx context.Context, worktree string) error {
+	hooksDir, err := r.backend().RevParse(ctx, worktree, "--path-format=absolute", "--git-path", "hooks")
+	if err != nil {
+		return fmt.Errorf("error locating hooks directory: %w", err)
+	}
+	hook := filepath.Join(hooksDir, "pre-commit")
+
+	content, err := os.ReadFile(hook)
+	switch {
+	case os.IsNotExist(err):
+		content = []byte("#!/bin/sh\n" + reviewGuard)
+	case err != nil:
+		return fmt.Errorf("error reading pre-commit hook: %w", err)
+	case strings.Contains(string(content), reviewGuard):
+		return nil
+	default:
+		shebang, rest, _ := strings.Cut(string(content), "\n")
+		if !strings.HasPrefix(shebang, "#!") || !strings.HasSuffix(shebang, "sh") {
+			r.printf("Warning: %s is not a shell script, commits in review worktrees are not blocked\n", hook)
+			return nil
+		}
+		content = []byte(shebang + "\n" + reviewGuard + rest)
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return fmt.Errorf("error creating hooks directory: %w", err)
+	}
+	if err := os.WriteFile(hook, content, 0755); err != nil {
+		return fmt.Errorf("error installing pre-commit hook: %w", err)
+	}
+	return nil
+}
+
+// reviewExpiry reads the review marker of the worktree at path. It reports
+// whether the worktree is a review worktree and when it expires; the time
+// is zero when it never does.
+func reviewExpiry(path string) (time.Time, bool) {
+	adminDir, ok := readGitFile(path)
+	if !ok {
+		return time.Time{}, false
+	}
+	content, err := os.ReadFile(filepath.Join(adminDir, reviewMarker))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	expires, err := time.Parse(time.RFC3339, strings.TrimSpace(string(content)))
+	if err != nil {
+		return time.Time{}, true
+	}
+	return expires, true
+}
+
+// ParseExpiry parses a review expiry such as 7d, 12h or never. Days are
+// accepted in addition to the units of time.ParseDuration.
+func ParseExpiry(s string) (time.Duration, error) {
+	if s == "never" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid expiry %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid expiry %q (expected e.g. 7d, 12h or never)", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,173 @@
+package wtm
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expireReview moves the expiry of the review worktree at path into the
+// past.
+func expireReview(t *testing.T, path string) {
+	t.Helper()
+	adminDir, ok := readGitFile(path)
+	if !ok {
+		t.Fatalf("No .git file in %s", path)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if err := os.WriteFile(filepath.Join(adminDir, reviewMarker), []byte(past+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReview(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	path, err := repo.Review(ctx, ReviewOptions{Ref: "feature-branch", Expires: DefaultReviewExpiry})
+	if err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+	if path != repo.TreePath("review-feature-branch") {
+		t.Errorf("Unexpected worktree path %q", path)
+	}
+
+	worktrees, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(worktrees) != 1 {
+		t.Fatalf("Expected 1 worktree, got %+v", worktrees)
+	}
+	wt := worktrees[0]
+	if !wt.Review || !wt.Locked || !wt.Detached {
+		t.Errorf("Expected a detached, locked review worktree, got %+v", wt)
+	}
+	if until := time.Until(wt.Expires); until < 6*24*time.Hour || until > 7*24*time.Hour {
+		t.Errorf("Expected expiry in about 7 days, got %v", wt.Expires)
+	}
+
+	t.Run("commits are blocked", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(path, "oops.txt"), []byte("oops"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, path, "add", "oops.txt")
+
+		output, err := exec.Command("git", "-C", path, "commit", "-m", "Oops").CombinedOutput()
+		if err == nil || !strings.Contains(string(output), "read-only review worktree") {
+			t.Errorf("Expected commit to be blocked, got %v: %s", err, output)
+		}
+		runGit(t, path, "reset", "--hard")
+		os.Remove(filepath.Join(path, "oops.txt"))
+	})
+
+	t.Run("commits elsewhere are allowed", func(t *testing.T) {
+		other, err := repo.Checkout(ctx, CheckoutOptions{Commitish: "main"})
+		if err != nil {
+			t.Fatalf("Checkout failed: %v", err)
+		}
+		runGit(t, other, "commit", "--allow-empty", "-m", "Allowed")
+	})
+
+	t.Run("prune keeps unexpired reviews", func(t *testing.T) {
+		removed, err := repo.Prune(ctx, PruneOptions{})
+		if err != nil {
+			t.Fatalf("Prune failed: %v", err)
+		}
+		if len(removed) != 0 {
+			t.Errorf("Expected nothing to be pruned, got %v", removed)
+		}
+	})
+
+	t.Run("prune keeps dirty expired reviews", func(t *testing.T) {
+		expireReview(t, path)
+		notes := filepath.Join(path, "notes.txt")
+		if err := os.WriteFile(notes, []byte("review notes"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(notes)
+
+		if removed, err := repo.Prune(ctx, PruneOptions{}); err != nil || len(removed) != 0 {
+			t.Errorf("Expected dirty review to be kept, got %v, %v", removed, err)
+		}
+	})
+
+	t.Run("prune removes clean expired reviews", func(t *testing.T) {
+		removed, err := repo.Prune(ctx, PruneOptions{})
+		if err != nil {
+			t.Fatalf("Prune failed: %v", err)
+		}
+		if len(removed) != 1 || removed[0] != path {
+			t.Errorf("Expected %s to be pruned, got %v", path, removed)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected review worktree to be gone, got %v", err)
+		}
+	})
+}
+
+func TestReview_ExistingHook(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+
+	hook := filepath.Join(repo.GitDir, "hooks", "pre-commit")
+	if err := os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho custom hook\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Review(ctx, ReviewOptions{Ref: "main"}); err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+	if _, err := repo.Review(ctx, ReviewOptions{Ref: "feature-branch"}); err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+
+	content, err := os.ReadFile(hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "#!/bin/sh\n"+reviewGuard) || !strings.HasSuffix(string(content), "echo custom hook\n") {
+		t.Errorf("Expected guard to be inserted once before the existing hook, got:\n%s", content)
+	}
+	if strings.Count(string(content), reviewGuard) != 1 {
+		t.Errorf("Expected a single guard, got:\n%s", content)
+	}
+
+	worktrees, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	for _, wt := range worktrees {
+		if !wt.Review || !wt.Expires.IsZero() {
+			t.Errorf("Expected a review worktree without expiry, got %+v", wt)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	tests := map[string]time.Duration{
+		"7d":    7 * 24 * time.Hour,
+		"12h":   12 * time.Hour,
+		"90m":   90 * time.Minute,
+		"never": 0,
+	}
+	for input, expected := range tests {
+		got, err := ParseExpiry(input)
+		if err != nil || got != expected {
+			t.Errorf("ParseExpiry(%q) = %v, %v; want %v", input, got, err, expected)
+		}
+	}
+
+	for _, input := range []string{"soon", "-1d", "-5h", "xd"} {
+		if _, err := ParseExpiry(input); err == nil {
+			t.Errorf("ParseExpiry(%q): expected error", input)
+		}
+	}
+}
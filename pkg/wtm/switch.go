@@ -0,0 +1,113 @@
+package wtm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SwitchOptions configures Repository.Switch.
+type SwitchOptions struct {
+	// Target is the branch or commit to make active in the workspace.
+	Target string
+
+	// Restore restores all persisted files into the workspace afterwards.
+	Restore bool
+}
+
+// Switch makes opts.Target the active workspace. The current workspace is
+// moved to tree/<current-branch> and the target is either moved in from
+// tree/<target> or created as a new worktree. Remote branches are resolved
+// to local tracking branches as in Checkout.
+func (r *Repository) Switch(ctx context.Context, opts SwitchOptions) error {
+	workspacePath := r.WorkspacePath()
+
+	// Resolve the target before touching the workspace so a failure leaves
+	// everything in place
+	target, err := r.localBranchFor(ctx, opts.Target)
+	if err != nil {
+		return err
+	}
+
+	// Create tree directory if it doesn't exist (needed before any moves)
+	if err := os.MkdirAll(filepath.Join(r.Root, TreeDir), 0755); err != nil {
+		return fmt.Errorf("error creating tree directory: %w", err)
+	}
+
+	// If workspace exists, we need to move it to tree/<current-branch>
+	if _, err := os.Stat(workspacePath); err == nil {
+		currentBranch, err := r.backend().CurrentBranch(ctx, workspacePath)
+		if err != nil {
+			return fmt.Errorf("error getting current branch from workspace: %w", err)
+		}
+		if currentBranch == "" {
+			return fmt.Errorf("workspace exists but is in detached HEAD state")
+		}
+
+		sanitizedCurrent := SanitizeBranchName(currentBranch)
+		currentTargetPath := r.TreePath(currentBranch)
+
+		// Check if target already exists (shouldn't happen with git constraints)
+		if _, err := os.Stat(currentTargetPath); err == nil {
+			return fmt.Errorf("tree/%s already exists, this shouldn't happen", sanitizedCurrent)
+		}
+
+		r.printf("Moving current workspace (%s) to tree/%s...\n", currentBranch, sanitizedCurrent)
+		if err := r.moveWorktree(ctx, workspacePath, currentTargetPath); err != nil {
+			return fmt.Errorf("error moving workspace to tree: %w", err)
+		}
+	}
+
+	sanitizedTarget := SanitizeBranchName(target)
+	targetTreePath := r.TreePath(target)
+
+	if _, err := os.Stat(targetTreePath); err == nil {
+		r.printf("Moving tree/%s to workspace...\n", sanitizedTarget)
+		if err := r.moveWorktree(ctx, targetTreePath, workspacePath); err != nil {
+			return fmt.Errorf("error moving tree/%s to workspace: %w", sanitizedTarget, err)
+		}
+	} else {
+		r.printf("Creating new worktree for '%s' at workspace...\n", target)
+		if err := r.createWorktree(ctx, workspacePath, target); err != nil {
+			return fmt.Errorf("error creating worktree: %w", err)
+		}
+	}
+
+	r.printf("Successfully switched to %s\n", target)
+
+	if opts.Restore {
+		if err := r.Restore(ctx, RestoreOptions{Worktree: workspacePath, All: true}); err != nil {
+			return fmt.Errorf("error restoring persisted files: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// moveWorktree moves a worktree from source to destination, together with
+// its wtm metadata
+func (r *Repository) moveWorktree(ctx context.Context, source, destination string) error {
+	g := r.backend()
+
+	// Try using git worktree move first
+	err := g.WorktreeMove(ctx, r.gitDir(), source, destination)
+	if err == nil {
+		return r.moveMetadata(source, destination)
+	}
+
+	// If git worktree move fails (e.g. with submodules), try filesystem move + repair
+	r.printf("git worktree move failed (%v), trying filesystem move...\n", err)
+	if err := os.Rename(source, destination); err != nil {
+		return fmt.Errorf("failed to move directory: %w", err)
+	}
+
+	// Repair git worktree metadata from the moved worktree directory
+	// This updates the worktree's .git file to point to the correct location
+	// and updates the bare repo's worktree metadata to reflect the new path
+	if err := g.WorktreeRepair(ctx, r.gitDir(), destination); err != nil {
+		return fmt.Errorf("moved directory but failed to repair git metadata: %w", err)
+	}
+
+	return r.moveMetadata(source, destination)
+}
@@ -0,0 +1,317 @@
+package wtm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wtm/pkg/git"
+)
+
+func TestGetCurrentBranch(t *testing.T) {
+	// Create a temporary repository
+	tempDir := t.TempDir()
+	repoPath := filepath.Join(tempDir, "test-repo")
+
+	// Initialize repository
+	initCmd := exec.Command("git", "init", repoPath)
+	if err := initCmd.Run(); err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	// Configure git
+	configUserCmd := exec.Command("git", "config", "user.email", "test@example.com")
+	configUserCmd.Dir = repoPath
+	_ = configUserCmd.Run()
+
+	configNameCmd := exec.Command("git", "config", "user.name", "Test User")
+	configNameCmd.Dir = repoPath
+	_ = configNameCmd.Run()
+
+	// Create an initial commit
+	readmeFile := filepath.Join(repoPath, "README.md")
+	if err := os.WriteFile(readmeFile, []byte("# Test\n"), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+
+	addCmd := exec.Command("git", "add", "README.md")
+	addCmd.Dir = repoPath
+	if err := addCmd.Run(); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+
+	commitCmd := exec.Command("git", "commit", "-m", "Initial commit")
+	commitCmd.Dir = repoPath
+	if err := commitCmd.Run(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	// Get the current branch
+	branch, err := (&Repository{}).backend().CurrentBranch(context.Background(), repoPath)
+	if err != nil {
+		t.Fatalf("CurrentBranch failed: %v", err)
+	}
+
+	// Should be either master or main depending on git version
+	if branch != "master" && branch != "main" {
+		t.Errorf("Expected branch 'master' or 'main', got %q", branch)
+	}
+}
+
+func TestMoveWorktree_FilesystemFallback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	// Create a temporary bare repository
+	tempDir := t.TempDir()
+	bareRepoPath := filepath.Join(tempDir, "test-bare-repo")
+
+	// Initialize bare repository
+	initCmd := exec.Command("git", "init", "--bare", bareRepoPath)
+	if err := initCmd.Run(); err != nil {
+		t.Fatalf("Failed to init bare repo: %v", err)
+	}
+
+	// Create initial commit
+	tempClone := filepath.Join(tempDir, "temp-clone")
+	cloneCmd := exec.Command("git", "clone", bareRepoPath, tempClone)
+	if err := cloneCmd.Run(); err != nil {
+		t.Fatalf("Failed to clone bare repo: %v", err)
+	}
+
+	configUserCmd := exec.Command("git", "config", "user.email", "test@example.com")
+	configUserCmd.Dir = tempClone
+	_ = configUserCmd.Run()
+
+	configNameCmd := exec.Command("git", "config", "user.name", "Test User")
+	configNameCmd.Dir = tempClone
+	_ = configNameCmd.Run()
+
+	readmeFile := filepath.Join(tempClone, "README.md")
+	if err := os.WriteFile(readmeFile, []byte("# Test\n"), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+
+	addCmd := exec.Command("git", "add", "README.md")
+	addCmd.Dir = tempClone
+	_ = addCmd.Run()
+
+	commitCmd := exec.Command("git", "commit", "-m", "Initial commit")
+	commitCmd.Dir = tempClone
+	_ = commitCmd.Run()
+
+	pushCmd := exec.Command("git", "push", "origin", "master")
+	pushCmd.Dir = tempClone
+	if err := pushCmd.Run(); err != nil {
+		pushCmd = exec.Command("git", "push", "origin", "main")
+		pushCmd.Dir = tempClone
+		_ = pushCmd.Run()
+	}
+
+	// Create a second branch for the test
+	checkoutCmd := exec.Command("git", "checkout", "-b", "feature-branch")
+	checkoutCmd.Dir = tempClone
+	_ = checkoutCmd.Run()
+
+	featureFile := filepath.Join(tempClone, "feature.txt")
+	os.WriteFile(featureFile, []byte("feature\n"), 0644)
+	addCmd = exec.Command("git", "add", "feature.txt")
+	addCmd.Dir = tempClone
+	_ = addCmd.Run()
+
+	commitCmd = exec.Command("git", "commit", "-m", "Add feature")
+	commitCmd.Dir = tempClone
+	_ = commitCmd.Run()
+
+	pushCmd = exec.Command("git", "push", "origin", "feature-branch")
+	pushCmd.Dir = tempClone
+	_ = pushCmd.Run()
+
+	// Determine branch name
+	branchName := "master"
+	checkCmd := exec.Command("git", "branch", "-r")
+	checkCmd.Dir = bareRepoPath
+	if output, _ := checkCmd.Output(); !strings.Contains(string(output), "master") {
+		branchName = "main"
+	}
+
+	// Create workspace worktree
+	workspacePath := filepath.Join(bareRepoPath, "workspace")
+	addWorktreeCmd := exec.Command("git", "worktree", "add", workspacePath, branchName)
+	addWorktreeCmd.Dir = bareRepoPath
+	if err := addWorktreeCmd.Run(); err != nil {
+		t.Fatalf("Failed to add worktree: %v", err)
+	}
+
+	// Create tree directory
+	treeDir := filepath.Join(bareRepoPath, "tree")
+	if err := os.MkdirAll(treeDir, 0755); err != nil {
+		t.Fatalf("Failed to create tree directory: %v", err)
+	}
+
+	// Test: Move worktree using filesystem move (simulating submodule case)
+	t.Run("filesystem move with repair updates worktree registration", func(t *testing.T) {
+		destination := filepath.Join(treeDir, branchName)
+
+		// Perform the move using our function
+		repo := &Repository{Root: bareRepoPath}
+		err := repo.moveWorktree(context.Background(), workspacePath, destination)
+		if err != nil {
+			t.Fatalf("moveWorktree failed: %v", err)
+		}
+
+		// Verify the worktree was moved
+		if _, err := os.Stat(destination); os.IsNotExist(err) {
+			t.Errorf("Destination directory does not exist")
+		}
+
+		if _, err := os.Stat(workspacePath); !os.IsNotExist(err) {
+			t.Errorf("Source directory still exists after move")
+		}
+
+		// Verify git worktree list shows the new path (not the old path as prunable)
+		listCmd := exec.Command("git", "worktree", "list")
+		listCmd.Dir = bareRepoPath
+		output, err := listCmd.Output()
+		if err != nil {
+			t.Fatalf("Failed to list worktrees: %v", err)
+		}
+
+		if !strings.Contains(string(output), destination) {
+			t.Errorf("Worktree list does not contain new path %s. Output: %s", destination, string(output))
+		}
+
+		// The old workspace path should NOT appear in the list (not even as prunable)
+		// This confirms the repair worked correctly
+		if strings.Contains(string(output), "workspace") && strings.Contains(string(output), "prunable") {
+			t.Errorf("Worktree list still shows old path as prunable (repair failed). Output: %s", string(output))
+		}
+
+		// Verify we can create a new worktree at the original workspace path
+		// This is the key test - if repair didn't work, this would fail with
+		// "is a missing but already registered worktree"
+		// We use a different branch (feature-branch) since the original branch is still checked out
+		newWorktreeCmd := exec.Command("git", "worktree", "add", workspacePath, "feature-branch")
+		newWorktreeCmd.Dir = bareRepoPath
+		output, err = newWorktreeCmd.CombinedOutput()
+		if err != nil {
+			// Check if the error is about "already registered worktree"
+			if strings.Contains(string(output), "already registered worktree") {
+				t.Errorf("Failed to create new worktree - repair did not fix the registration: %s", string(output))
+			} else {
+				t.Logf("Failed to create new worktree (may be expected): %v - %s", err, string(output))
+			}
+		}
+
+		// If worktree was created, verify it
+		if _, err := os.Stat(workspacePath); err == nil {
+			newBranch, err := repo.backend().CurrentBranch(context.Background(), workspacePath)
+			if err != nil {
+				t.Errorf("Failed to get branch of new workspace: %v", err)
+			}
+			if newBranch != "feature-branch" {
+				t.Errorf("New workspace is on wrong branch: expected feature-branch, got %s", newBranch)
+			}
+		}
+	})
+}
+
+func TestSwitch(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := context.Background()
+
+	t.Run("creates workspace", func(t *testing.T) {
+		if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+
+		branch, err := repo.backend().CurrentBranch(ctx, repo.WorkspacePath())
+		if err != nil {
+			t.Fatalf("CurrentBranch failed: %v", err)
+		}
+		if branch != "main" {
+			t.Errorf("Expected workspace on main, got %q", branch)
+		}
+	})
+
+	t.Run("moves workspace to tree and back", func(t *testing.T) {
+		if err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+		if _, err := os.Stat(repo.TreePath("main")); err != nil {
+			t.Errorf("Expected main to be moved to tree/main: %v", err)
+		}
+
+		if err := repo.Switch(ctx, SwitchOptions{Target: "main"}); err != nil {
+			t.Fatalf("Switch back failed: %v", err)
+		}
+		if _, err := os.Stat(repo.TreePath("main")); !os.IsNotExist(err) {
+			t.Errorf("Expected tree/main to be moved to workspace")
+		}
+		if _, err := os.Stat(repo.TreePath("feature-branch")); err != nil {
+			t.Errorf("Expected feature-branch to be moved to tree/feature-branch: %v", err)
+		}
+	})
+
+	t.Run("error when workspace is detached", func(t *testing.T) {
+		runGit(t, repo.WorkspacePath(), "checkout", "--detach")
+		defer runGit(t, repo.WorkspacePath(), "checkout", "main")
+
+		err := repo.Switch(ctx, SwitchOptions{Target: "feature-branch"})
+		if err == nil || !strings.Contains(err.Error(), "detached HEAD") {
+			t.Errorf("Expected detached HEAD error, got: %v", err)
+		}
+	})
+}
+
+func TestSwitch_Fake(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("moves workspace away and creates target", func(t *testing.T) {
+		fake := git.NewFake()
+		fake.Outputs["branch --show-current"] = "feature/current\n"
+
+		repo := &Repository{Root: t.TempDir(), Git: fake}
+		if err := os.MkdirAll(repo.WorkspacePath(), 0755); err != nil {
+			t.Fatalf("Failed to create workspace: %v", err)
+		}
+
+		if err := repo.Switch(ctx, SwitchOptions{Target: "develop"}); err != nil {
+			t.Fatalf("Switch failed: %v", err)
+		}
+
+		if !fake.Called("worktree", "move", repo.WorkspacePath(), repo.TreePath("feature/current")) {
+			t.Errorf("Expected workspace to be moved to tree/feature-current, calls: %v", fake.Calls())
+		}
+		if !fake.Called("worktree", "add", repo.WorkspacePath(), "develop") {
+			t.Errorf("Expected develop to be added at workspace, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("falls back to filesystem move and repair", func(t *testing.T) {
+		fake := git.NewFake()
+		repo := &Repository{Root: t.TempDir(), Git: fake}
+
+		source := filepath.Join(repo.Root, "workspace")
+		destination := filepath.Join(repo.Root, "moved")
+		if err := os.MkdirAll(source, 0755); err != nil {
+			t.Fatalf("Failed to create source: %v", err)
+		}
+		fake.Errors["worktree move "+source+" "+destination] = errors.New("cannot move a worktree containing submodules")
+
+		if err := repo.moveWorktree(ctx, source, destination); err != nil {
+			t.Fatalf("moveWorktree failed: %v", err)
+		}
+		if _, err := os.Stat(destination); err != nil {
+			t.Errorf("Expected directory to be moved: %v", err)
+		}
+		if !fake.Called("worktree", "repair", destination) {
+			t.Errorf("Expected worktree repair, calls: %v", fake.Calls())
+		}
+	})
+}